@@ -0,0 +1,321 @@
+// client/client.go
+
+// Package client talks to a VFS running `vfs serve` over its REST API.
+// Its methods mirror the in-process operations and return the same error categories.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// Folder, File and Query are the types of the in-process operations
+type (
+	Folder = internal.Folder
+	File   = internal.File
+	Query  = internal.Query
+)
+
+// maxRetryDelay caps the delay between two attempts
+const maxRetryDelay = 30 * time.Second
+
+// Client sends requests to a VFS server. It's safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	retryDelay time.Duration
+	token      string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with c instead of http.DefaultClient
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+// WithRetries sets how many times a request is sent again after a retryable failure,
+// waiting delay before the first retry and twice as long before each following one.
+// The default is 2 retries after 100ms.
+func WithRetries(retries int, delay time.Duration) Option {
+	return func(client *Client) {
+		client.retries = retries
+		client.retryDelay = delay
+	}
+}
+
+// WithToken sends token in the Authorization header of every request, as the API token
+// that a server running with --auth requires
+func WithToken(token string) Option {
+	return func(client *Client) {
+		client.token = token
+	}
+}
+
+// New returns a client of the server at baseURL, e.g. http://localhost:8080
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retries:    2,
+		retryDelay: 100 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// RegisterUser registers a new user with a unique username
+func (c *Client) RegisterUser(ctx context.Context, username string) error {
+	return c.do(ctx, http.MethodPost, "/users", map[string]string{"username": username}, nil)
+}
+
+// GetUser returns a user without its folders
+func (c *Client) GetUser(ctx context.Context, username string) (*internal.User, error) {
+	var user internal.User
+	if err := c.do(ctx, http.MethodGet, userPath(username), nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsers lists the names of all users in ascending order
+func (c *Client) ListUsers(ctx context.Context) ([]string, error) {
+	var users []internal.User
+	if err := c.do(ctx, http.MethodGet, "/users", nil, &users); err != nil {
+		return nil, err
+	}
+	usernames := make([]string, len(users))
+	for i, user := range users {
+		usernames[i] = user.Username
+	}
+	return usernames, nil
+}
+
+// CreateFolder creates a new folder for a user
+func (c *Client) CreateFolder(ctx context.Context, username, foldername, description string) error {
+	body := map[string]string{"name": foldername, "description": description}
+	return c.do(ctx, http.MethodPost, userPath(username)+"/folders", body, nil)
+}
+
+// GetFolder returns a user's folder without its files
+func (c *Client) GetFolder(ctx context.Context, username, foldername string) (*Folder, error) {
+	var folder Folder
+	if err := c.do(ctx, http.MethodGet, folderPath(username, foldername), nil, &folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// ListFolders lists all folders for a user sorted by sortBy in the given order
+func (c *Client) ListFolders(ctx context.Context, username, sortBy, order string) ([]*Folder, error) {
+	folders, _, err := c.QueryFolders(ctx, username, Query{Sort: sortBy, Order: order})
+	return folders, err
+}
+
+// QueryFolders lists the folders of a user that match q. It returns the requested page
+// and the number of matching folders.
+func (c *Client) QueryFolders(ctx context.Context, username string, q Query) ([]*Folder, int, error) {
+	var folders []*Folder
+	total, err := c.list(ctx, userPath(username)+"/folders", q, &folders)
+	return folders, total, err
+}
+
+// RenameFolder renames a folder for a user
+func (c *Client) RenameFolder(ctx context.Context, username, foldername, newFolderName string) error {
+	return c.do(ctx, http.MethodPatch, folderPath(username, foldername), map[string]string{"name": newFolderName}, nil)
+}
+
+// DeleteFolder deletes a folder for a user
+func (c *Client) DeleteFolder(ctx context.Context, username, foldername string) error {
+	return c.do(ctx, http.MethodDelete, folderPath(username, foldername), nil, nil)
+}
+
+// CreateFile creates a new file in a user's folder
+func (c *Client) CreateFile(ctx context.Context, username, foldername, filename, description string) error {
+	body := map[string]string{"name": filename, "description": description}
+	return c.do(ctx, http.MethodPost, folderPath(username, foldername)+"/files", body, nil)
+}
+
+// GetFile returns a file in a user's folder
+func (c *Client) GetFile(ctx context.Context, username, foldername, filename string) (*File, error) {
+	var file File
+	if err := c.do(ctx, http.MethodGet, filePath(username, foldername, filename), nil, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// ListFiles lists all files in a user's folder sorted by sortBy in the given order
+func (c *Client) ListFiles(ctx context.Context, username, foldername, sortBy, order string) ([]*File, error) {
+	files, _, err := c.QueryFiles(ctx, username, foldername, Query{Sort: sortBy, Order: order})
+	return files, err
+}
+
+// QueryFiles lists the files in a user's folder that match q. It returns the requested page
+// and the number of matching files.
+func (c *Client) QueryFiles(ctx context.Context, username, foldername string, q Query) ([]*File, int, error) {
+	var files []*File
+	total, err := c.list(ctx, folderPath(username, foldername)+"/files", q, &files)
+	return files, total, err
+}
+
+// DeleteFile deletes a file in a user's folder
+func (c *Client) DeleteFile(ctx context.Context, username, foldername, filename string) error {
+	return c.do(ctx, http.MethodDelete, filePath(username, foldername, filename), nil, nil)
+}
+
+func userPath(username string) string {
+	return "/users/" + url.PathEscape(username)
+}
+
+func folderPath(username, foldername string) string {
+	return userPath(username) + "/folders/" + url.PathEscape(foldername)
+}
+
+func filePath(username, foldername, filename string) string {
+	return folderPath(username, foldername) + "/files/" + url.PathEscape(filename)
+}
+
+// queryValues encodes a query as the parameters of a listing
+func queryValues(q Query) url.Values {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	set("sort", q.Sort)
+	set("order", q.Order)
+	set("name", q.Name)
+	set("name_regex", q.NameRegexp)
+	set("description", q.Description)
+	if q.Reverse {
+		values.Set("reverse", "true")
+	}
+	if !q.CreatedAfter.IsZero() {
+		values.Set("created_after", q.CreatedAfter.Format(time.RFC3339Nano))
+	}
+	if !q.CreatedBefore.IsZero() {
+		values.Set("created_before", q.CreatedBefore.Format(time.RFC3339Nano))
+	}
+	if q.Offset != 0 {
+		values.Set("offset", strconv.Itoa(q.Offset))
+	}
+	if q.Limit != 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return values
+}
+
+// list gets a listing into result and returns the number of matching entries
+func (c *Client) list(ctx context.Context, path string, q Query, result any) (int, error) {
+	if encoded := queryValues(q).Encode(); encoded != "" {
+		path += "?" + encoded
+	}
+	resp, err := c.send(ctx, http.MethodGet, path, nil, result)
+	if err != nil {
+		return 0, err
+	}
+	total, _ := strconv.Atoi(resp.Header.Get("X-Total-Count"))
+	return total, nil
+}
+
+// do sends a request with body encoded as JSON and decodes the response into result
+func (c *Client) do(ctx context.Context, method, path string, body, result any) error {
+	_, err := c.send(ctx, method, path, body, result)
+	return err
+}
+
+// send sends a request, retrying it while it fails with a retryable error.
+// Requests that may have reached the server are retried only when they're GET or HEAD.
+func (c *Client) send(ctx context.Context, method, path string, body, result any) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		resp, retryAfter, err := c.attempt(ctx, method, path, payload, result)
+		if err == nil {
+			return resp, nil
+		}
+		retryable := ctx.Err() == nil && (isRetryable(method, err) || (resp == nil && method == http.MethodGet))
+		if attempt == c.retries || !retryable {
+			return nil, err
+		}
+
+		wait := delay
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		timer := time.NewTimer(min(wait, maxRetryDelay))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// attempt sends a request once. It returns the response when the server answered,
+// and the delay asked for by a Retry-After header.
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, result any) (*http.Response, time.Duration, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var body errorResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return resp, retryAfter, decodeError(resp.StatusCode, body)
+	}
+	if result != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return resp, 0, fmt.Errorf("decoding response of %s %s: %w", method, path, err)
+		}
+	}
+	return resp, 0, nil
+}
@@ -0,0 +1,222 @@
+// client/client_test.go
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"virtual-file-system/internal"
+	"virtual-file-system/internal/auth"
+	"virtual-file-system/internal/httpapi"
+)
+
+// newTestClient starts an in-process server on empty mock data
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	internal.UseMockData(make(map[string]*internal.User))
+	server := httptest.NewServer(httpapi.NewHandler())
+	t.Cleanup(server.Close)
+	return New(server.URL, WithRetries(0, 0))
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	if err := c.RegisterUser(ctx, "Alice"); err != nil {
+		t.Fatalf("RegisterUser returned error: %v", err)
+	}
+	if err := c.CreateFolder(ctx, "alice", "docs", "documents"); err != nil {
+		t.Fatalf("CreateFolder returned error: %v", err)
+	}
+	if err := c.CreateFolder(ctx, "alice", "my photos", ""); err != nil {
+		t.Fatalf("CreateFolder returned error: %v", err)
+	}
+	for _, name := range []string{"b", "a", "c"} {
+		if err := c.CreateFile(ctx, "alice", "docs", name, "file "+name); err != nil {
+			t.Fatalf("CreateFile returned error: %v", err)
+		}
+	}
+
+	if users, err := c.ListUsers(ctx); err != nil || len(users) != 1 || users[0] != "alice" {
+		t.Errorf("ListUsers() = %v, %v; expected [alice]", users, err)
+	}
+	if user, err := c.GetUser(ctx, "alice"); err != nil || user.Username != "alice" {
+		t.Errorf("GetUser(alice) = %+v, %v; expected alice", user, err)
+	}
+	if folder, err := c.GetFolder(ctx, "alice", "docs"); err != nil || folder.Description != "documents" || folder.CreatedAt.IsZero() {
+		t.Errorf("GetFolder(alice, docs) = %+v, %v; expected docs", folder, err)
+	}
+
+	folders, err := c.ListFolders(ctx, "alice", "name", "desc")
+	if err != nil || len(folders) != 2 || folders[0].Name != "my photos" || folders[1].Name != "docs" {
+		t.Errorf("ListFolders(alice, name, desc) = %v, %v; expected [my photos docs]", folders, err)
+	}
+	files, err := c.ListFiles(ctx, "alice", "docs", "name", "asc")
+	if err != nil || len(files) != 3 || files[0].Name != "a" || files[2].Name != "c" {
+		t.Errorf("ListFiles(alice, docs, name, asc) = %v, %v; expected [a b c]", files, err)
+	}
+	files, total, err := c.QueryFiles(ctx, "alice", "docs", Query{Reverse: true, Offset: 1, Limit: 1, CreatedAfter: time.Now().Add(-time.Hour)})
+	if err != nil || total != 3 || len(files) != 1 || files[0].Name != "b" {
+		t.Errorf("QueryFiles = %v, %d, %v; expected [b] of 3", files, total, err)
+	}
+
+	if err := c.RenameFolder(ctx, "alice", "my photos", "photos"); err != nil {
+		t.Errorf("RenameFolder returned error: %v", err)
+	}
+	if err := c.DeleteFile(ctx, "alice", "docs", "a"); err != nil {
+		t.Errorf("DeleteFile returned error: %v", err)
+	}
+	if file, err := c.GetFile(ctx, "alice", "docs", "b"); err != nil || file.Description != "file b" {
+		t.Errorf("GetFile(alice, docs, b) = %+v, %v; expected b", file, err)
+	}
+	if err := c.DeleteFolder(ctx, "alice", "photos"); err != nil {
+		t.Errorf("DeleteFolder returned error: %v", err)
+	}
+	if folders, _, err := c.QueryFolders(ctx, "alice", Query{}); err != nil || len(folders) != 1 {
+		t.Errorf("QueryFolders = %v, %v; expected [docs]", folders, err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	c.RegisterUser(ctx, "alice")
+
+	tests := []struct {
+		err      error
+		category error
+		message  string
+	}{
+		{c.RegisterUser(ctx, "alice"), ErrAlreadyExists, "The alice has already existed."},
+		{c.RegisterUser(ctx, "bad/name"), ErrInvalidName, "The bad/name contains invalid chars."},
+		{c.CreateFolder(ctx, "bob", "docs", ""), ErrNotFound, "The bob doesn't exist."},
+		{c.DeleteFile(ctx, "alice", "docs", "a"), ErrNotFound, "The docs doesn't exist."},
+		{func() error { _, err := c.ListFolders(ctx, "alice", "size", ""); return err }(), ErrInvalidSort, "Unknown sort field size, expected one of name,created,description"},
+		{func() error { _, _, err := c.QueryFolders(ctx, "alice", Query{Limit: -1}); return err }(), ErrInvalidQuery, "Invalid limit -1: must not be negative"},
+	}
+
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.category) || tt.err.Error() != tt.message {
+			t.Errorf("expected %q in category %v but got %v", tt.message, tt.category, tt.err)
+		}
+	}
+
+	// Name errors are the same type as in-process
+	var nameErr *NameError
+	if err := c.RegisterUser(ctx, "alice"); !errors.As(err, &nameErr) || nameErr.Name != "alice" {
+		t.Errorf("expected a *NameError for alice but got %#v", err)
+	}
+	inProcess := internal.RegisterUser("alice")
+	if err := c.RegisterUser(ctx, "alice"); err.Error() != inProcess.Error() {
+		t.Errorf("expected the in-process error %q but got %q", inProcess, err)
+	}
+
+	var apiErr *APIError
+	if _, err := c.ListFolders(ctx, "alice", "size", ""); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != "invalid_sort" {
+		t.Errorf("expected an *APIError with status 400 but got %#v", err)
+	}
+}
+
+func TestClientToken(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	internal.RegisterUser("alice")
+	token, _, _ := internal.CreateToken("alice", internal.ScopeWrite, "", 0)
+	server := httptest.NewServer(auth.Middleware(httpapi.NewHandler()))
+	defer server.Close()
+	ctx := context.Background()
+
+	var apiErr *APIError
+	if err := New(server.URL).CreateFolder(ctx, "alice", "docs", ""); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a request without a token to be answered 401 but got %v", err)
+	}
+	c := New(server.URL, WithToken(token))
+	if err := c.CreateFolder(ctx, "alice", "docs", ""); err != nil {
+		t.Fatalf("CreateFolder returned error: %v", err)
+	}
+	if folders, err := c.ListFolders(ctx, "alice", "", ""); err != nil || len(folders) != 1 || folders[0].Name != "docs" {
+		t.Errorf("ListFolders(alice) = %v, %v; expected [docs]", folders, err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	api := httpapi.NewHandler()
+	var requests atomic.Int32
+	status := http.StatusTooManyRequests
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first two attempts of every request
+		if requests.Add(1)%3 != 0 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "busy", status)
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	c := New(server.URL, WithRetries(2, time.Millisecond))
+	if err := c.RegisterUser(ctx, "alice"); err != nil || requests.Load() != 3 {
+		t.Errorf("expected RegisterUser to succeed on the third attempt but got %v after %d", err, requests.Load())
+	}
+
+	requests.Store(0)
+	c = New(server.URL, WithRetries(1, time.Millisecond))
+	err := c.RegisterUser(ctx, "bob")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Message != "Too Many Requests" || requests.Load() != 2 {
+		t.Errorf("expected 429 after 2 attempts but got %v after %d", err, requests.Load())
+	}
+
+	// Errors caused by the request itself aren't retried
+	requests.Store(2)
+	if err := c.RegisterUser(ctx, "alice"); !errors.Is(err, ErrAlreadyExists) || requests.Load() != 3 {
+		t.Errorf("expected a single attempt failing with ErrAlreadyExists but got %v after %d", err, requests.Load()-2)
+	}
+
+	// A gateway error may come after the server acted on the request, so only GET is retried
+	status = http.StatusBadGateway
+	c = New(server.URL, WithRetries(2, time.Millisecond))
+	requests.Store(0)
+	if err := c.CreateFolder(ctx, "alice", "docs", ""); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || requests.Load() != 1 {
+		t.Errorf("expected a single POST failing with 502 but got %v after %d", err, requests.Load())
+	}
+	requests.Store(0)
+	if _, err := c.ListFolders(ctx, "alice", "", ""); err != nil || requests.Load() != 3 {
+		t.Errorf("expected ListFolders to succeed on the third attempt but got %v after %d", err, requests.Load())
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "busy", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := New(server.URL).ListUsers(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to stop the retries but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected to give up at the deadline but waited %v", elapsed)
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := New(slow.URL).ListUsers(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to cancel the request but got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+// client/errors.go
+package client
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"virtual-file-system/internal"
+)
+
+// The error categories are the ones of the in-process operations, so errors.Is works the
+// same on the errors of both
+var (
+	ErrAlreadyExists = internal.ErrAlreadyExists
+	ErrNotFound      = internal.ErrNotFound
+	ErrInvalidName   = internal.ErrInvalidName
+	ErrInvalidSort   = internal.ErrInvalidSort
+	ErrInvalidQuery  = internal.ErrInvalidQuery
+)
+
+// NameError is returned for errors caused by a user, folder or file name,
+// exactly like the in-process operations return it
+type NameError = internal.NameError
+
+// APIError is returned for the other error responses of the server
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error category matching Code, if any
+func (e *APIError) Unwrap() error {
+	return codeErrors[e.Code]
+}
+
+// codeErrors maps the error codes of the server to the error categories
+var codeErrors = map[string]error{
+	"already_exists": ErrAlreadyExists,
+	"not_found":      ErrNotFound,
+	"invalid_name":   ErrInvalidName,
+	"invalid_sort":   ErrInvalidSort,
+	"invalid_query":  ErrInvalidQuery,
+}
+
+// errorResponse is the body of the error responses of the server
+type errorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Name    string `json:"name"`
+	} `json:"error"`
+}
+
+// decodeError builds the error of a response, a *NameError when the server names the
+// user, folder or file at fault and an *APIError otherwise
+func decodeError(status int, body errorResponse) error {
+	e := body.Error
+	if category, ok := codeErrors[e.Code]; ok && e.Name != "" {
+		return &NameError{Name: e.Name, Err: category}
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(status)
+	}
+	return &APIError{StatusCode: status, Code: e.Code, Message: e.Message}
+}
+
+// isRetryable reports whether a request of method failing with err may succeed when sent again.
+// 429 and dial errors mean the server didn't act on the request, so any method is retried.
+// A gateway error may come after the server did, so only GET and HEAD are retried then.
+func isRetryable(method string, err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return true
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return method == http.MethodGet || method == http.MethodHead
+		}
+		return false
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
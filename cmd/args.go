@@ -0,0 +1,93 @@
+// args.go
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// parseArgs splits the input command into arguments the way a POSIX shell does:
+//   - spaces and tabs separate arguments outside quotes
+//   - single quotes keep everything up to the next single quote literally
+//   - double quotes keep spaces, and `\"` and `\\` inside them stand for `"` and `\`
+//   - outside quotes, a backslash keeps the next character literally
+//
+// Quoted parts join the surrounding text, so `a"b c"d` is the single argument `ab cd`,
+// and `""` is an empty argument.
+func parseArgs(input string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inWord := false
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		switch char {
+		case ' ', '\t', '\n', '\r':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		case '\'':
+			inWord = true
+			end := i + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, usageError("Syntax error: unterminated single quote")
+			}
+			current.WriteString(string(runes[i+1 : end]))
+			i = end
+		case '"':
+			inWord = true
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+				}
+				current.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, usageError("Syntax error: unterminated double quote")
+			}
+		case '\\':
+			if i+1 == len(runes) {
+				return nil, usageError("Syntax error: trailing backslash")
+			}
+			inWord = true
+			i++
+			current.WriteRune(runes[i])
+		default:
+			inWord = true
+			current.WriteRune(char)
+		}
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// extractOptions removes the options followed by a value from args, wherever they appear,
+// as --name value or --name=value. It returns the other arguments and the values by name.
+func extractOptions(usage string, args []string, names ...string) ([]string, map[string]string, error) {
+	values := make(map[string]string)
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !slices.Contains(names, name) {
+			rest = append(rest, args[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, nil, usageError(usage)
+			}
+			i++
+			value = args[i]
+		}
+		values[name] = value
+	}
+	return rest, values, nil
+}
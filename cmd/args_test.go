@@ -0,0 +1,56 @@
+// args_test.go
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		err      string
+	}{
+		{"register user", []string{"register", "user"}, ""},
+		{"  register \t user  ", []string{"register", "user"}, ""},
+		{`create-folder "user a" 'folder a'`, []string{"create-folder", "user a", "folder a"}, ""},
+		{`create-folder user folder "say \"hi\""`, []string{"create-folder", "user", "folder", `say "hi"`}, ""},
+		{`create-folder user folder 'it''s'`, []string{"create-folder", "user", "folder", "its"}, ""},
+		{`create-folder user folder "it's"`, []string{"create-folder", "user", "folder", "it's"}, ""},
+		{`create-folder user folder 'no \"escapes\" here'`, []string{"create-folder", "user", "folder", `no \"escapes\" here`}, ""},
+		{`create-folder user folder "back\\slash \n"`, []string{"create-folder", "user", "folder", `back\slash \n`}, ""},
+		{`create-folder user\ a folder\"b`, []string{"create-folder", "user a", `folder"b`}, ""},
+		{`a"b c"d`, []string{"ab cd"}, ""},
+		{`create-folder user "" ''`, []string{"create-folder", "user", "", ""}, ""},
+		{"", nil, ""},
+		{`create-folder "user`, nil, "Syntax error: unterminated double quote"},
+		{`create-folder 'user`, nil, "Syntax error: unterminated single quote"},
+		{`create-folder "user\"`, nil, "Syntax error: unterminated double quote"},
+		{`create-folder user\`, nil, "Syntax error: trailing backslash"},
+	}
+
+	for _, tt := range tests {
+		args, err := parseArgs(tt.input)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parseArgs(%q) error = %v; expected %v", tt.input, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(args, tt.expected) {
+			t.Errorf("parseArgs(%q) = %q, %v; expected %q", tt.input, args, err, tt.expected)
+		}
+	}
+}
+
+func TestQuoteIfNeededRoundTrip(t *testing.T) {
+	values := []string{"", "plain", "with space", `say "hi"`, `it's`, `back\slash`, `\"`, "tab\tand\nnewline", `'\''`}
+
+	for _, value := range values {
+		args, err := parseArgs(quoteIfNeeded(value))
+		if err != nil || len(args) != 1 || args[0] != value {
+			t.Errorf("parseArgs(quoteIfNeeded(%q)) = %q, %v; expected the original value", value, args, err)
+		}
+	}
+}
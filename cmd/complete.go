@@ -0,0 +1,199 @@
+// complete.go
+package main
+
+import (
+	"sort"
+	"strings"
+	"virtual-file-system/internal"
+)
+
+// Kinds of names completed for command arguments
+const (
+	completeUser = iota
+	completeFolder
+	completeFile
+	completeSessionFolder
+)
+
+// completionArgs lists what each argument of a command names.
+// Arguments that create something new aren't completed.
+var completionArgs = map[string][]int{
+	"create-folder": {completeUser},
+	"create-file":   {completeUser, completeFolder},
+	"list-folders":  {completeUser},
+	"list-files":    {completeUser, completeFolder},
+	"delete-folder": {completeUser, completeFolder},
+	"delete-file":   {completeUser, completeFolder, completeFile},
+	"rename-folder": {completeUser, completeFolder},
+	"create-token":  {completeUser},
+	"list-tokens":   {completeUser},
+	"revoke-token":  {completeUser},
+	"use":           {completeUser},
+	"cd":            {completeSessionFolder},
+}
+
+// completionFlags lists the options of each command besides --output and --columns
+var completionFlags = map[string][]string{
+	"list-folders": {"--created-after", "--created-before", "--description", "--limit", "--name", "--name-regex", "--offset", "--order", "--reverse", "--sort"},
+	"list-files":   {"--created-after", "--created-before", "--description", "--limit", "--name", "--name-regex", "--offset", "--order", "--reverse", "--sort"},
+	"create-token": {"--expires", "--folder", "--scope"},
+	"run":          {"--stop-on-error", "--continue"},
+	"source":       {"--stop-on-error", "--continue"},
+}
+
+// completionSwitches lists the options that aren't followed by a value
+var completionSwitches = map[string]bool{
+	"--stop-on-error": true,
+	"--continue":      true,
+	"--reverse":       true,
+	"--sort-name":     true,
+	"--sort-created":  true,
+}
+
+// commandNames returns the names of all commands, taken from their usage lines
+func commandNames() []string {
+	names := []string{"exit", "help"}
+	for _, usage := range commands {
+		if fields := strings.Fields(usage); len(fields) > 1 && fields[0] == "Usage:" {
+			names = append(names, fields[1])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completionWords splits the text before the cursor like parseArgs, but accepts an
+// unterminated quote. It returns the finished arguments, the unquoted text of the
+// argument under the cursor and the rune index where that argument starts.
+func completionWords(line string) ([]string, string, int) {
+	var args []string
+	var current strings.Builder
+	inWord := false
+	start := 0
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		if !inWord && char != ' ' && char != '\t' {
+			inWord = true
+			start = i
+		}
+		switch char {
+		case ' ', '\t':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		case '\'':
+			for i++; i < len(runes) && runes[i] != '\''; i++ {
+				current.WriteRune(runes[i])
+			}
+		case '"':
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+				}
+				current.WriteRune(runes[i])
+			}
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			}
+		default:
+			current.WriteRune(char)
+		}
+	}
+	if !inWord {
+		return args, "", len(runes)
+	}
+	return args, current.String(), start
+}
+
+// completionNames returns the names an argument can take given the arguments before it
+func completionNames(kind int, args []string) []string {
+	for i := range args {
+		if caseInsensitive {
+			args[i] = strings.ToLower(args[i])
+		}
+	}
+
+	var names []string
+	switch kind {
+	case completeUser:
+		names = listUsers()
+	case completeFolder:
+		folders, _ := listFolders(args[0], "name", "asc")
+		for _, folder := range folders {
+			names = append(names, folder.Name)
+		}
+	case completeSessionFolder:
+		folders, _ := listFolders(session.user, "name", "asc")
+		for _, folder := range folders {
+			names = append(names, folder.Name)
+		}
+	case completeFile:
+		files, _ := listFiles(args[0], args[1], "name", "asc")
+		for _, file := range files {
+			names = append(names, file.Name)
+		}
+	}
+	return names
+}
+
+// completeLine is the completer of the REPL. It completes command names, options and
+// the names of users, folders and files taken from the live data.
+func completeLine(line string) ([]string, int) {
+	args, partial, start := completionWords(line)
+	if len(args) > 0 {
+		// Complete the arguments of an alias like those of the command it expands to
+		if command, rest, err := expandAlias(args[0], args[1:]); err == nil {
+			args = append([]string{command}, rest...)
+		}
+	}
+
+	var options []string
+	switch {
+	case len(args) == 0:
+		options = commandNames()
+		for name := range aliases {
+			options = append(options, name)
+		}
+		sort.Strings(options)
+	case args[len(args)-1] == "--output":
+		options = []string{formatCSV, formatJSON, formatPlain, formatTable}
+	case args[len(args)-1] == "--sort":
+		options = internal.SortFields
+	case args[len(args)-1] == "--order":
+		options = []string{"asc", "desc"}
+	case strings.HasPrefix(partial, "-"):
+		options = append(completionFlags[args[0]], "--columns", "--output")
+	default:
+		// Options and the values following them aren't names
+		var positional []string
+		for i := 1; i < len(args); i++ {
+			if strings.HasPrefix(args[i], "--") {
+				if !strings.Contains(args[i], "=") && !completionSwitches[args[i]] {
+					i++
+				}
+				continue
+			}
+			positional = append(positional, args[i])
+		}
+		kinds := completionArgs[args[0]]
+		if len(positional) < len(kinds) {
+			options = completionNames(kinds[len(positional)], positional)
+		}
+	}
+
+	if caseInsensitive {
+		partial = strings.ToLower(partial)
+	}
+	var candidates []string
+	for _, option := range options {
+		if strings.HasPrefix(option, partial) {
+			candidates = append(candidates, option)
+		}
+	}
+	return candidates, start
+}
@@ -0,0 +1,51 @@
+// complete_test.go
+package main
+
+import (
+	"reflect"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+func TestCompleteLine(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	internal.RegisterUser("alice")
+	internal.RegisterUser("al bundy")
+	internal.RegisterUser("bob")
+	internal.CreateFolder("alice", "docs", "")
+	internal.CreateFolder("alice", "downloads", "")
+	internal.CreateFolder("alice", "my folder", "")
+	internal.CreateFile("alice", "docs", "notes", "")
+	internal.CreateFile("alice", "docs", "novel", "")
+
+	tests := []struct {
+		line       string
+		candidates []string
+		start      int
+	}{
+		{"", []string{"add-webhook", "alias", "cd", "create-file", "create-folder", "create-token", "delete-file", "delete-folder", "exit", "help", "list-files", "list-folders", "list-tokens", "list-webhooks", "redeliver-webhook", "register", "remove-webhook", "rename-folder", "revoke-token", "run", "source", "test-webhook", "unalias", "use"}, 0},
+		{"li", []string{"list-files", "list-folders", "list-tokens", "list-webhooks"}, 0},
+		{"list-folders ", []string{"al bundy", "alice", "bob"}, 13},
+		{"list-folders AL", []string{"al bundy", "alice"}, 13},
+		{"list-folders \"al b", []string{"al bundy"}, 13},
+		{"list-files alice d", []string{"docs", "downloads"}, 17},
+		{"list-files alice 'my", []string{"my folder"}, 17},
+		{"delete-file alice docs no", []string{"notes", "novel"}, 23},
+		{"delete-file alice docs notes ", nil, 29},
+		{"list-files --output json alice ", []string{"docs", "downloads", "my folder"}, 31},
+		{"list-files alice docs --so", []string{"--sort"}, 22},
+		{"list-files alice docs --sort c", []string{"created"}, 29},
+		{"list-folders alice --order ", []string{"asc", "desc"}, 27},
+		{"list-folders --reverse a", []string{"al bundy", "alice"}, 23},
+		{"list-folders alice --output ", []string{"csv", "json", "plain", "table"}, 28},
+		{"register ", nil, 9},
+		{"list-files nobody ", nil, 18},
+	}
+
+	for _, tt := range tests {
+		candidates, start := completeLine(tt.line)
+		if !reflect.DeepEqual(candidates, tt.candidates) || start != tt.start {
+			t.Errorf("completeLine(%q) = %q, %d; expected %q, %d", tt.line, candidates, start, tt.candidates, tt.start)
+		}
+	}
+}
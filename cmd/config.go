@@ -0,0 +1,271 @@
+// config.go
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"virtual-file-system/internal"
+)
+
+var commandAlias = "Usage: alias [name] [command] [args...]?"
+var commandUnalias = "Usage: unalias [name]"
+
+// maxAliasDepth limits how many aliases can expand into each other
+const maxAliasDepth = 10
+
+// config holds the settings read from the configuration file
+type config struct {
+	output   string
+	sort     string
+	order    string
+	timezone string
+	data     string
+	aliases  map[string][]string
+}
+
+// aliases maps alias names to the command and arguments they expand to
+var aliases = map[string][]string{}
+
+// defaultSort and defaultOrder are used by the list commands when no sorting is given
+var defaultSort = "name"
+var defaultOrder = "asc"
+
+// displayLocation is the time zone times are printed in, nil keeps the stored zone
+var displayLocation *time.Location
+
+// defaultConfigPath returns $XDG_CONFIG_HOME/vfs/config, falling back to ~/.config/vfs/config
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "vfs", "config")
+}
+
+// isBuiltinCommand reports whether name is a command of the application rather than an alias
+func isBuiltinCommand(name string) bool {
+	for _, command := range commandNames() {
+		if command == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAlias checks that an alias can be defined as name
+func validateAlias(name string, expansion []string) error {
+	if name == "" || strings.ContainsAny(name, " \t\"'\\") || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid alias name %s", quoteIfNeeded(name))
+	}
+	if isBuiltinCommand(name) {
+		return fmt.Errorf("alias %s would hide the command with the same name", quoteIfNeeded(name))
+	}
+	if len(expansion) == 0 {
+		return fmt.Errorf("alias %s has no command", quoteIfNeeded(name))
+	}
+	return nil
+}
+
+// parseConfig reads a configuration file made of `key = value` lines and
+// `alias name = command [args...]` lines. Blank lines and lines starting with `#` are skipped.
+func parseConfig(path string) (*config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cfg := &config{aliases: map[string][]string{}}
+	scanner := bufio.NewScanner(file)
+	number := 0
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := cfg.set(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, number, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// set applies a line of the configuration file
+func (cfg *config) set(line string) error {
+	key, value, found := strings.Cut(line, "=")
+	if !found {
+		return errors.New("expected `key = value`")
+	}
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+
+	if name, isAlias := strings.CutPrefix(key, "alias "); isAlias {
+		name = strings.TrimSpace(name)
+		expansion, err := parseArgs(value)
+		if err != nil {
+			return err
+		}
+		if err := validateAlias(name, expansion); err != nil {
+			return err
+		}
+		cfg.aliases[name] = expansion
+		return nil
+	}
+
+	switch key {
+	case "output":
+		if !isValidFormat(value) {
+			return fmt.Errorf("unknown output format %s", quoteIfNeeded(value))
+		}
+		cfg.output = value
+	case "sort":
+		if _, err := internal.ParseSortKeys(value, ""); err != nil {
+			return err
+		}
+		cfg.sort = value
+	case "order":
+		if value != "asc" && value != "desc" {
+			return fmt.Errorf("unknown order %s, expected asc or desc", quoteIfNeeded(value))
+		}
+		cfg.order = value
+	case "timezone":
+		if _, err := time.LoadLocation(value); err != nil {
+			return fmt.Errorf("unknown time zone %s", quoteIfNeeded(value))
+		}
+		cfg.timezone = value
+	case "data":
+		cfg.data = value
+	default:
+		return fmt.Errorf("unknown setting %s", quoteIfNeeded(key))
+	}
+	return nil
+}
+
+// loadConfig reads the configuration file at path, or the default one when path is empty,
+// and applies the defaults and aliases it defines. A missing default file is ignored.
+func loadConfig(path string) (*config, error) {
+	aliases = map[string][]string{}
+	defaultSort = "name"
+	defaultOrder = "asc"
+	displayLocation = nil
+
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	if path == "" {
+		return &config{}, nil
+	}
+
+	cfg, err := parseConfig(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return &config{}, nil
+		}
+		return nil, err
+	}
+
+	aliases = cfg.aliases
+	if cfg.sort != "" {
+		defaultSort = cfg.sort
+	}
+	if cfg.order != "" {
+		defaultOrder = cfg.order
+	}
+	if cfg.timezone != "" {
+		displayLocation, _ = time.LoadLocation(cfg.timezone)
+	}
+	return cfg, nil
+}
+
+// expandAlias replaces an alias at the start of a command with its expansion,
+// followed by the remaining arguments. Aliases may expand into other aliases.
+func expandAlias(command string, args []string) (string, []string, error) {
+	seen := map[string]bool{}
+	for depth := 0; ; depth++ {
+		expansion, ok := aliases[command]
+		if !ok {
+			return command, args, nil
+		}
+		if seen[command] || depth == maxAliasDepth {
+			return "", nil, fmt.Errorf("alias %s expands into itself", quoteIfNeeded(command))
+		}
+		seen[command] = true
+		args = append(append([]string{}, expansion[1:]...), args...)
+		command = expansion[0]
+	}
+}
+
+// formatAlias prints an alias the way the config file and the alias command define it
+func formatAlias(name string) string {
+	quoted := make([]string, len(aliases[name]))
+	for i, arg := range aliases[name] {
+		quoted[i] = quoteIfNeeded(arg)
+	}
+	return fmt.Sprintf("alias %s = %s", name, strings.Join(quoted, " "))
+}
+
+// handleAlias executes `alias`, which lists the aliases, shows one, or defines one for the session
+func handleAlias(args []string) error {
+	if len(args) == 0 {
+		names := make([]string, 0, len(aliases))
+		for name := range aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		lines := make([]string, len(names))
+		for i, name := range names {
+			lines[i] = formatAlias(name)
+		}
+		if len(lines) == 0 {
+			printWarning("No aliases are defined.")
+			return nil
+		}
+		printMessage(strings.Join(lines, "\n"))
+		return nil
+	}
+
+	name := args[0]
+	if len(args) == 1 {
+		if _, ok := aliases[name]; !ok {
+			return fmt.Errorf("alias %s isn't defined", quoteIfNeeded(name))
+		}
+		printMessage(formatAlias(name))
+		return nil
+	}
+
+	if err := validateAlias(name, args[1:]); err != nil {
+		return err
+	}
+	aliases[name] = append([]string{}, args[1:]...)
+	printMessage(fmt.Sprintf("Define %s.", formatAlias(name)))
+	return nil
+}
+
+// handleUnalias executes `unalias`, which removes an alias from the session
+func handleUnalias(args []string) error {
+	if len(args) != 1 {
+		return usageError(commandUnalias)
+	}
+	if _, ok := aliases[args[0]]; !ok {
+		return fmt.Errorf("alias %s isn't defined", quoteIfNeeded(args[0]))
+	}
+	delete(aliases, args[0])
+	printMessage(fmt.Sprintf("Remove alias %s.", quoteIfNeeded(args[0])))
+	return nil
+}
@@ -0,0 +1,207 @@
+// config_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+// writeConfig writes a config file into a temporary directory and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseConfig(t *testing.T) {
+	path := writeConfig(t, strings.Join([]string{
+		"# defaults",
+		"output = table",
+		"sort = created",
+		"order = desc",
+		"timezone = Asia/Taipei",
+		"data = /tmp/vfs.json",
+		"",
+		"alias lf = list-files --sort-created desc",
+		"alias mk = create-folder \"my user\"",
+	}, "\n"))
+
+	cfg, err := parseConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &config{
+		output:   "table",
+		sort:     "created",
+		order:    "desc",
+		timezone: "Asia/Taipei",
+		data:     "/tmp/vfs.json",
+		aliases: map[string][]string{
+			"lf": {"list-files", "--sort-created", "desc"},
+			"mk": {"create-folder", "my user"},
+		},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected %+v but got %+v", expected, cfg)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"output", "config:1: expected `key = value`"},
+		{"\noutput = xml", "config:2: unknown output format xml"},
+		{"sort = size", "config:1: Unknown sort field size, expected one of name,created,description"},
+		{"order = up", "config:1: unknown order up, expected asc or desc"},
+		{"timezone = Nowhere/City", "config:1: unknown time zone Nowhere/City"},
+		{"color = red", "config:1: unknown setting color"},
+		{"alias ls = list-folders 'a", "config:1: Syntax error: unterminated single quote"},
+		{"alias help = list-folders", "config:1: alias help would hide the command with the same name"},
+		{"alias -x = list-folders", "config:1: invalid alias name -x"},
+		{"alias empty =", "config:1: alias empty has no command"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseConfig(writeConfig(t, tt.content))
+		if err == nil || !strings.HasSuffix(err.Error(), tt.expected) {
+			t.Errorf("content: %q\nexpected error ending with %q but got %v", tt.content, tt.expected, err)
+		}
+	}
+}
+
+func TestExpandAlias(t *testing.T) {
+	defer func() { aliases = map[string][]string{} }()
+	aliases = map[string][]string{
+		"lf":    {"list-files", "--sort-created", "desc"},
+		"mine":  {"lf", "me"},
+		"loop":  {"again"},
+		"again": {"loop"},
+	}
+
+	tests := []struct {
+		command  string
+		args     []string
+		expected []string
+		err      string
+	}{
+		{"lf", []string{"user", "folder"}, []string{"list-files", "--sort-created", "desc", "user", "folder"}, ""},
+		{"mine", []string{"folder"}, []string{"list-files", "--sort-created", "desc", "me", "folder"}, ""},
+		{"register", []string{"user"}, []string{"register", "user"}, ""},
+		{"loop", nil, nil, "alias loop expands into itself"},
+	}
+
+	for _, tt := range tests {
+		command, args, err := expandAlias(tt.command, tt.args)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("command: %v\nexpected error %q but got %v", tt.command, tt.err, err)
+			}
+			continue
+		}
+		if got := append([]string{command}, args...); err != nil || !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("command: %v\nexpected %q but got %q, %v", tt.command, tt.expected, got, err)
+		}
+	}
+}
+
+func TestAliasCommands(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	defer func() { aliases = map[string][]string{} }()
+
+	tests := []struct {
+		command  string
+		args     []string
+		expected string
+	}{
+		{"alias", nil, "Warning: No aliases are defined.\n"},
+		{"register", []string{"user"}, "Add user successfully.\n"},
+		{"alias", []string{"mk", "create-folder", "user"}, "Define alias mk = create-folder user.\n"},
+		{"alias", []string{"lf", "list-folders", "user", "--sort-name", "desc"}, "Define alias lf = list-folders user --sort-name desc.\n"},
+		{"mk", []string{"folder a", "desc"}, "Create \"folder a\" successfully.\n"},
+		{"mk", []string{"folder b"}, "Create \"folder b\" successfully.\n"},
+		{"lf", nil, "\"folder b\" 2000-01-01 20:34:19 user\n\"folder a\" desc 2000-01-01 20:34:19 user\n"},
+		{"alias", nil, "alias lf = list-folders user --sort-name desc\nalias mk = create-folder user\n"},
+		{"alias", []string{"mk"}, "alias mk = create-folder user\n"},
+		{"alias", []string{"exit", "help"}, "Error: alias exit would hide the command with the same name\n"},
+		{"unalias", []string{"mk"}, "Remove alias mk.\n"},
+		{"unalias", []string{"mk"}, "Error: alias mk isn't defined\n"},
+		{"mk", []string{"folder c"}, "Unrecognized command\n"},
+		{"unalias", nil, "Usage: unalias [name]\n"},
+	}
+
+	for _, tt := range tests {
+		output := captureOutput(func() {
+			executeCommand(tt.command, tt.args)
+		})
+		if !checkOutput(tt.expected, output) {
+			t.Errorf("command: %v, args: %v\nexpected: %q\nbut got: %q", tt.command, tt.args, tt.expected, output)
+		}
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	internal.UseMockData(map[string]*internal.User{})
+	defer func() {
+		loadConfig(writeConfig(t, ""))
+		outputFormat = formatPlain
+	}()
+
+	path := writeConfig(t, "output = csv\nsort = name\norder = desc\ntimezone = UTC\nalias lf = list-folders")
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"--config", path, "register", "user"}, 0, "message\nAdd user successfully.\n"},
+		{[]string{"--config", path, "--output", "plain", "create-folder", "user", "first"}, 0, "Create first successfully.\n"},
+		{[]string{"--config", path, "--output", "plain", "create-folder", "user", "second"}, 0, "Create second successfully.\n"},
+		{[]string{"--config", path, "--output", "plain", "lf", "user"}, 0, "second 2000-01-01 20:34:19 user\nfirst 2000-01-01 20:34:19 user\n"},
+		{[]string{"--config", path, "lf", "user", "--columns", "name,created"}, 0, "name,created_at\nsecond,2000-01-01T20:34:19Z\nfirst,2000-01-01T20:34:19Z\n"},
+		{[]string{"--config", writeConfig(t, "sort = size"), "list-folders", "user"}, 2, "Error: invalid config file: "},
+		{[]string{"--config", filepath.Join(t.TempDir(), "missing"), "list-folders", "user"}, 2, "Error: invalid config file: "},
+	}
+
+	for _, tt := range tests {
+		var code int
+		output := captureOutput(func() {
+			code = run(tt.args)
+		})
+		if code != tt.code {
+			t.Errorf("args: %v\nexpected exit code %d but got %d", tt.args, tt.code, code)
+		}
+		output = normalizeTimes(output)
+		if !checkOutput(tt.expected, output) && !(tt.code != 0 && strings.HasPrefix(output, tt.expected)) {
+			t.Errorf("args: %v\nexpected: %q\nbut got: %q", tt.args, tt.expected, output)
+		}
+	}
+}
+
+func TestRunAlias(t *testing.T) {
+	internal.UseMockData(map[string]*internal.User{})
+	defer loadConfig(writeConfig(t, ""))
+
+	path := writeConfig(t, "alias lf = list-files --sort-created desc")
+	for _, args := range [][]string{{"register", "usera"}, {"create-folder", "usera", "foldera"}, {"create-file", "usera", "foldera", "first"}, {"create-file", "usera", "foldera", "second"}} {
+		captureOutput(func() {
+			run(append([]string{"--config", path}, args...))
+		})
+	}
+
+	var code int
+	output := captureOutput(func() {
+		code = run([]string{"--config", path, "lf", "usera", "foldera"})
+	})
+	expected := "second 2000-01-01 20:34:19 foldera usera\nfirst 2000-01-01 20:34:19 foldera usera\n"
+	if output = normalizeTimes(output); code != 0 || output != expected {
+		t.Errorf("expected exit code 0 and %q but got %d and %q", expected, code, output)
+	}
+}
@@ -0,0 +1,71 @@
+// connect.go
+package main
+
+import (
+	"virtual-file-system/internal"
+	"virtual-file-system/internal/jsonrpc"
+)
+
+// The operations commands run. They act on the data file of this process,
+// or on a daemon after useRemote.
+var (
+	registerUser = internal.RegisterUser
+	createFolder = internal.CreateFolder
+	createFile   = internal.CreateFile
+	queryFolders = internal.QueryFolders
+	queryFiles   = internal.QueryFiles
+	deleteFolder = internal.DeleteFolder
+	deleteFile   = internal.DeleteFile
+	renameFolder = internal.RenameFolder
+	listUsers    = internal.ListUsers
+	listFolders  = internal.ListFolders
+	listFiles    = internal.ListFiles
+	createToken  = internal.CreateToken
+	listTokens   = internal.ListTokens
+	revokeToken  = internal.RevokeToken
+)
+
+// remote is set while the operations are sent to a daemon
+var remote = false
+
+// useRemote sends the operations to the daemon behind c
+func useRemote(c *jsonrpc.Client) {
+	remote = true
+	registerUser = c.RegisterUser
+	createFolder = c.CreateFolder
+	createFile = c.CreateFile
+	queryFolders = c.QueryFolders
+	queryFiles = c.QueryFiles
+	deleteFolder = c.DeleteFolder
+	deleteFile = c.DeleteFile
+	renameFolder = c.RenameFolder
+	// Only completion lists users, where a failure means no candidates
+	listUsers = func() []string {
+		users, _ := c.ListUsers()
+		return users
+	}
+	listFolders = c.ListFolders
+	listFiles = c.ListFiles
+	createToken = c.CreateToken
+	listTokens = c.ListTokens
+	revokeToken = c.RevokeToken
+}
+
+// useLocal restores the operations on the data file
+func useLocal() {
+	remote = false
+	registerUser = internal.RegisterUser
+	createFolder = internal.CreateFolder
+	createFile = internal.CreateFile
+	queryFolders = internal.QueryFolders
+	queryFiles = internal.QueryFiles
+	deleteFolder = internal.DeleteFolder
+	deleteFile = internal.DeleteFile
+	renameFolder = internal.RenameFolder
+	listUsers = internal.ListUsers
+	listFolders = internal.ListFolders
+	listFiles = internal.ListFiles
+	createToken = internal.CreateToken
+	listTokens = internal.ListTokens
+	revokeToken = internal.RevokeToken
+}
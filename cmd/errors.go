@@ -0,0 +1,52 @@
+// errors.go
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"virtual-file-system/internal"
+)
+
+// Process exit codes, one per error category
+const (
+	exitOK            = 0
+	exitFailure       = 1
+	exitUsage         = 2
+	exitNotFound      = 3
+	exitAlreadyExists = 4
+	exitInvalidName   = 5
+	exitIO            = 6
+)
+
+// usageError reports a command that was called with the wrong arguments.
+// Its message is the usage line of the command.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// exitCode maps an error returned by handleCommand to a process exit code
+func exitCode(err error) int {
+	var usage usageError
+	var storage *internal.StorageError
+	var path *fs.PathError
+	var interrupted interruptedError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &interrupted):
+		return signalExitCode(interrupted.signal)
+	case errors.As(err, &usage), errors.Is(err, internal.ErrInvalidSort), errors.Is(err, internal.ErrInvalidQuery):
+		return exitUsage
+	case errors.Is(err, internal.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, internal.ErrAlreadyExists):
+		return exitAlreadyExists
+	case errors.Is(err, internal.ErrInvalidName):
+		return exitInvalidName
+	case errors.As(err, &storage), errors.As(err, &path):
+		return exitIO
+	}
+	return exitFailure
+}
@@ -0,0 +1,453 @@
+// lineedit.go
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errLineCancelled is returned by the line editor when Ctrl-C discards the line being edited
+var errLineCancelled = errors.New("line cancelled")
+
+// maxHistory is the number of lines kept in the history
+const maxHistory = 1000
+
+// Keys that don't stand for a character are returned by readKey as negative values
+const (
+	keyUnknown rune = -1 - iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+)
+
+// Control characters
+const (
+	ctrlA     = 1
+	ctrlB     = 2
+	ctrlC     = 3
+	ctrlD     = 4
+	ctrlE     = 5
+	ctrlF     = 6
+	ctrlG     = 7
+	ctrlH     = 8
+	tab       = 9
+	ctrlJ     = 10
+	ctrlK     = 11
+	ctrlL     = 12
+	enter     = 13
+	ctrlN     = 14
+	ctrlP     = 16
+	ctrlR     = 18
+	ctrlU     = 21
+	ctrlW     = 23
+	escape    = 27
+	backspace = 127
+)
+
+// completer returns the candidates for the word before the end of line,
+// and the rune index in line where that word starts.
+type completer func(line string) (candidates []string, start int)
+
+// lineEditor reads lines from a terminal in raw mode.
+// It supports cursor movement, history with reverse search and tab completion.
+type lineEditor struct {
+	in          *bufio.Reader
+	out         io.Writer
+	complete    completer
+	history     []string
+	historyFile string
+
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+// newLineEditor creates a line editor, loading the history from historyFile unless it's empty
+func newLineEditor(in io.Reader, out io.Writer, complete completer, historyFile string) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(in), out: out, complete: complete, historyFile: historyFile}
+	e.loadHistory()
+	return e
+}
+
+// loadHistory reads the last maxHistory lines of the history file
+func (e *lineEditor) loadHistory() {
+	if e.historyFile == "" {
+		return
+	}
+	file, err := os.Open(e.historyFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+		os.WriteFile(e.historyFile, []byte(strings.Join(e.history, "\n")+"\n"), 0600)
+	}
+}
+
+// addHistory appends line to the history and the history file, skipping repeated lines
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+	file, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, line)
+}
+
+// showPrompt prints the prompt of the next line
+func (e *lineEditor) showPrompt(prompt string) {
+	e.prompt = prompt
+	fmt.Fprint(e.out, prompt)
+}
+
+// readKey reads a character or an escape sequence
+func (e *lineEditor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != escape {
+		return r, err
+	}
+
+	next, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if next != '[' && next != 'O' {
+		return keyUnknown, nil
+	}
+
+	// Read the parameters up to the final byte of the sequence
+	params := ""
+	for {
+		c, _, err := e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if c >= 0x40 && c <= 0x7e {
+			switch {
+			case c == 'A':
+				return keyUp, nil
+			case c == 'B':
+				return keyDown, nil
+			case c == 'C':
+				return keyRight, nil
+			case c == 'D':
+				return keyLeft, nil
+			case c == 'H', c == '~' && (params == "1" || params == "7"):
+				return keyHome, nil
+			case c == 'F', c == '~' && (params == "4" || params == "8"):
+				return keyEnd, nil
+			case c == '~' && params == "3":
+				return keyDelete, nil
+			}
+			return keyUnknown, nil
+		}
+		params += string(c)
+	}
+}
+
+// refresh redraws the prompt and the line, and puts the cursor back in place
+func (e *lineEditor) refresh() {
+	var b strings.Builder
+	b.WriteString("\r" + e.prompt + string(e.buf) + "\x1b[K")
+	if back := len(e.buf) - e.pos; back > 0 {
+		fmt.Fprintf(&b, "\x1b[%dD", back)
+	}
+	io.WriteString(e.out, b.String())
+}
+
+// setLine replaces the line being edited and moves the cursor to its end
+func (e *lineEditor) setLine(line string) {
+	e.buf = []rune(line)
+	e.pos = len(e.buf)
+}
+
+// insert inserts text at the cursor
+func (e *lineEditor) insert(text []rune) {
+	buf := make([]rune, 0, len(e.buf)+len(text))
+	buf = append(buf, e.buf[:e.pos]...)
+	buf = append(buf, text...)
+	e.buf = append(buf, e.buf[e.pos:]...)
+	e.pos += len(text)
+}
+
+// deleteRange removes the runes between from and to and leaves the cursor at from
+func (e *lineEditor) deleteRange(from, to int) {
+	e.buf = append(e.buf[:from], e.buf[to:]...)
+	e.pos = from
+}
+
+// readLine lets the user edit a line after the prompt shown by showPrompt.
+// It returns io.EOF for Ctrl-D on an empty line and errLineCancelled for Ctrl-C.
+func (e *lineEditor) readLine() (string, error) {
+	e.buf = nil
+	e.pos = 0
+	historyIndex := len(e.history)
+	draft := ""
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			if err == io.EOF && len(e.buf) > 0 {
+				break
+			}
+			return "", err
+		}
+
+		switch key {
+		case enter, ctrlJ:
+			io.WriteString(e.out, "\r\n")
+			line := string(e.buf)
+			e.addHistory(line)
+			return line, nil
+		case ctrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", errLineCancelled
+		case ctrlD:
+			if len(e.buf) == 0 {
+				return "", io.EOF
+			}
+			if e.pos < len(e.buf) {
+				e.deleteRange(e.pos, e.pos+1)
+			}
+		case backspace, ctrlH:
+			if e.pos > 0 {
+				e.deleteRange(e.pos-1, e.pos)
+			}
+		case keyDelete:
+			if e.pos < len(e.buf) {
+				e.deleteRange(e.pos, e.pos+1)
+			}
+		case keyLeft, ctrlB:
+			if e.pos > 0 {
+				e.pos--
+			}
+		case keyRight, ctrlF:
+			if e.pos < len(e.buf) {
+				e.pos++
+			}
+		case keyHome, ctrlA:
+			e.pos = 0
+		case keyEnd, ctrlE:
+			e.pos = len(e.buf)
+		case ctrlK:
+			e.buf = e.buf[:e.pos]
+		case ctrlU:
+			e.deleteRange(0, e.pos)
+		case ctrlW:
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.deleteRange(start, e.pos)
+		case ctrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case keyUp, ctrlP:
+			if historyIndex > 0 {
+				if historyIndex == len(e.history) {
+					draft = string(e.buf)
+				}
+				historyIndex--
+				e.setLine(e.history[historyIndex])
+			}
+		case keyDown, ctrlN:
+			if historyIndex < len(e.history) {
+				historyIndex++
+				if historyIndex == len(e.history) {
+					e.setLine(draft)
+				} else {
+					e.setLine(e.history[historyIndex])
+				}
+			}
+		case ctrlR:
+			accepted, err := e.reverseSearch()
+			if err != nil {
+				return "", err
+			}
+			if accepted {
+				e.refresh()
+				io.WriteString(e.out, "\r\n")
+				line := string(e.buf)
+				e.addHistory(line)
+				return line, nil
+			}
+		case tab:
+			e.completeWord()
+		default:
+			if key >= ' ' {
+				e.insert([]rune{key})
+			}
+		}
+		e.refresh()
+	}
+
+	io.WriteString(e.out, "\r\n")
+	return string(e.buf), nil
+}
+
+// searchHistory returns the index of the newest history line at or before from that
+// contains query, or -1
+func (e *lineEditor) searchHistory(query string, from int) int {
+	for i := from; i >= 0; i-- {
+		if strings.Contains(e.history[i], query) {
+			return i
+		}
+	}
+	return -1
+}
+
+// reverseSearch runs an incremental search backwards through the history.
+// Enter accepts the match as the line, Ctrl-C and Ctrl-G restore the line, and any other
+// key leaves the match in the line for editing. It reports whether the match was accepted.
+func (e *lineEditor) reverseSearch() (bool, error) {
+	original := string(e.buf)
+	var query []rune
+	match := -1
+	failed := false
+
+	for {
+		status := "reverse-i-search"
+		if failed {
+			status = "failed reverse-i-search"
+		}
+		found := ""
+		if match >= 0 {
+			found = e.history[match]
+		}
+		fmt.Fprintf(e.out, "\r(%s)`%s': %s\x1b[K", status, string(query), found)
+
+		key, err := e.readKey()
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case key == ctrlR:
+			if match > 0 {
+				if next := e.searchHistory(string(query), match-1); next >= 0 {
+					match = next
+				}
+			}
+		case key == backspace || key == ctrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+			}
+			match = e.searchHistory(string(query), len(e.history)-1)
+			failed = match < 0 && len(query) > 0
+		case key == ctrlC || key == ctrlG:
+			e.setLine(original)
+			return false, nil
+		case key == enter || key == ctrlJ:
+			if match >= 0 {
+				e.setLine(e.history[match])
+			}
+			return true, nil
+		case key >= ' ':
+			query = append(query, key)
+			from := len(e.history) - 1
+			if match >= 0 {
+				from = match
+			}
+			if next := e.searchHistory(string(query), from); next >= 0 {
+				match = next
+				failed = false
+			} else {
+				failed = true
+			}
+		default:
+			if match >= 0 {
+				e.setLine(e.history[match])
+			}
+			return false, nil
+		}
+	}
+}
+
+// completeWord completes the word before the cursor.
+// A single candidate replaces the word, several candidates extend it to their common
+// prefix or are listed when there is nothing to add.
+func (e *lineEditor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	candidates, start := e.complete(string(e.buf[:e.pos]))
+	if len(candidates) == 0 {
+		return
+	}
+
+	if len(candidates) == 1 {
+		e.deleteRange(start, e.pos)
+		e.insert([]rune(quoteIfNeeded(candidates[0]) + " "))
+		return
+	}
+
+	prefix := commonPrefix(candidates)
+	replacement := []rune(quotePrefix(prefix))
+	if string(replacement) != string(e.buf[start:e.pos]) && len(prefix) > 0 {
+		e.deleteRange(start, e.pos)
+		e.insert(replacement)
+		return
+	}
+
+	io.WriteString(e.out, "\r\n")
+	for i, candidate := range candidates {
+		if i > 0 {
+			io.WriteString(e.out, "  ")
+		}
+		io.WriteString(e.out, candidate)
+	}
+	io.WriteString(e.out, "\r\n")
+}
+
+// commonPrefix returns the longest prefix shared by all values
+func commonPrefix(values []string) string {
+	prefix := []rune(values[0])
+	for _, value := range values[1:] {
+		runes := []rune(value)
+		n := 0
+		for n < len(prefix) && n < len(runes) && prefix[n] == runes[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return string(prefix)
+}
+
+// quotePrefix quotes the start of a value like quoteIfNeeded, leaving the quote open
+// so the rest of the value can still be typed or completed.
+func quotePrefix(prefix string) string {
+	quoted := quoteIfNeeded(prefix)
+	if quoted == prefix {
+		return prefix
+	}
+	return strings.TrimSuffix(quoted, "\"")
+}
@@ -0,0 +1,149 @@
+// lineedit_test.go
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readEditedLines feeds keys to a line editor and returns the lines it read until the input ended
+func readEditedLines(editor *lineEditor) ([]string, error) {
+	var lines []string
+	for {
+		line, err := editor.readLine()
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err == errLineCancelled {
+			lines = append(lines, "<cancelled>")
+			continue
+		}
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestLineEditorEditing(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		expected []string
+	}{
+		{"enter", "register user\r", []string{"register user"}},
+		{"backspace", "registerr\x7f user\r", []string{"register user"}},
+		{"arrows", "regiser\x1b[D\x1b[Dt\x1b[C\x1b[C user\r", []string{"register user"}},
+		{"home and end", "egister\x1b[Hr\x1b[F user\r", []string{"register user"}},
+		{"ctrl-a and ctrl-e", "user\x01register \x05\r", []string{"register user"}},
+		{"delete", "xregister user\x1b[H\x1b[3~\r", []string{"register user"}},
+		{"ctrl-k", "register user folder\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x0b\r", []string{"register user"}},
+		{"ctrl-u", "wrong\x15register user\r", []string{"register user"}},
+		{"ctrl-w", "register wrong name\x17\x17user\r", []string{"register user"}},
+		{"ctrl-c", "wrong\x03register user\r", []string{"<cancelled>", "register user"}},
+		{"ctrl-d deletes", "register usser\x02\x02\x02\x04\r", []string{"register user"}},
+		{"utf-8", "create-folder user folder \"déjà\"\r", []string{"create-folder user folder \"déjà\""}},
+		{"end of input", "register user", []string{"register user"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := newLineEditor(strings.NewReader(tt.keys), io.Discard, nil, "")
+			lines, err := readEditedLines(editor)
+			if err != nil || strings.Join(lines, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("expected %q but got %q, %v", tt.expected, lines, err)
+			}
+		})
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "history")
+	os.WriteFile(historyFile, []byte("register first\nlist-folders first\n"), 0600)
+
+	tests := []struct {
+		name     string
+		keys     string
+		expected []string
+	}{
+		{"up", "\x1b[A\r", []string{"list-folders first"}},
+		{"up twice", "\x1b[A\x1b[A\r", []string{"register first"}},
+		{"up and down keeps the draft", "draft\x1b[A\x1b[A\x1b[B\x1b[B\r", []string{"draft"}},
+		{"new lines", "register second\r\x1b[A\r", []string{"register second", "register second"}},
+		{"reverse search", "\x12reg\r", []string{"register first"}},
+		{"reverse search again", "\x12first\x12\r", []string{"register first"}},
+		{"reverse search edit", "\x12list\x05 --sort-name asc\r", []string{"list-folders first --sort-name asc"}},
+		{"reverse search cancel", "draft\x12list\x07\r", []string{"draft"}},
+		{"reverse search backspace", "\x12listx\x7f\r", []string{"list-folders first"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := newLineEditor(strings.NewReader(tt.keys), io.Discard, nil, "")
+			editor.history = []string{"register first", "list-folders first"}
+			lines, err := readEditedLines(editor)
+			if err != nil || strings.Join(lines, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("expected %q but got %q, %v", tt.expected, lines, err)
+			}
+		})
+	}
+
+	editor := newLineEditor(strings.NewReader("register third\r\x1b[A\r\r"), io.Discard, nil, historyFile)
+	if len(editor.history) != 2 {
+		t.Fatalf("expected 2 lines loaded from the history file but got %q", editor.history)
+	}
+	readEditedLines(editor)
+	data, _ := os.ReadFile(historyFile)
+	expected := "register first\nlist-folders first\nregister third\n"
+	if string(data) != expected {
+		t.Errorf("expected history file %q but got %q", expected, string(data))
+	}
+}
+
+func TestLineEditorCompletion(t *testing.T) {
+	complete := func(line string) ([]string, int) {
+		args, partial, start := completionWords(line)
+		var candidates []string
+		options := []string{"folder a", "folder b", "other"}
+		if len(args) == 0 {
+			options = []string{"list-files", "list-folders", "register"}
+		}
+		for _, option := range options {
+			if strings.HasPrefix(option, partial) {
+				candidates = append(candidates, option)
+			}
+		}
+		return candidates, start
+	}
+
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+		output   string
+	}{
+		{"single candidate", "reg\tuser\r", "register user", ""},
+		{"common prefix", "list-fo\t\r", "list-folders ", ""},
+		{"quoted prefix", "list-files user f\t\r", "list-files user \"folder ", ""},
+		{"quoted candidate", "list-files user f\ta\t\r", "list-files user \"folder a\" ", ""},
+		{"candidates listed", "list-files user \"folder \t\r", "list-files user \"folder ", "\r\nfolder a  folder b\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			editor := newLineEditor(strings.NewReader(tt.keys), &out, complete, "")
+			line, err := editor.readLine()
+			if err != nil || line != tt.expected {
+				t.Errorf("expected %q but got %q, %v", tt.expected, line, err)
+			}
+			if !strings.Contains(out.String(), tt.output) {
+				t.Errorf("expected the output to contain %q but got %q", tt.output, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// list.go
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// listOptions are the sorting, filtering and paging options of list-folders and list-files
+type listOptions struct {
+	sort  []string
+	query internal.Query
+}
+
+// listValueOptions are the options of the list commands followed by a value
+var listValueOptions = []string{"--sort", "--order", "--name", "--name-regex", "--description", "--created-after", "--created-before", "--limit", "--offset"}
+
+// timeLayouts are the layouts accepted by --created-after and --created-before
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", timeLayout, "2006-01-02"}
+
+// parseTime parses a time given to a listing option. Times without a zone are taken in
+// the configured time zone, or the local one.
+func parseTime(value string) (time.Time, error) {
+	location := displayLocation
+	if location == nil {
+		location = time.Local
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid time %s, expected YYYY-MM-DD, \"YYYY-MM-DD HH:MM:SS\" or RFC 3339", quoteIfNeeded(value))
+}
+
+// isListValueOption reports whether name is an option of the list commands followed by a value
+func isListValueOption(name string) bool {
+	for _, option := range listValueOptions {
+		if option == name {
+			return true
+		}
+	}
+	return false
+}
+
+// extractListOptions removes the options of the list commands from args, wherever they appear:
+//
+//	--sort field[:asc|desc][,field...]  sorts by the fields in turn, the later ones breaking ties
+//	--order asc|desc                    sets the direction of the fields given without one
+//	--reverse                           reverses the listing
+//	--name glob                         keeps the names matching a glob pattern
+//	--name-regex regexp                 keeps the names matching a regular expression
+//	--description text                  keeps the descriptions containing text, ignoring case
+//	--created-after time                keeps the entries created at or after time
+//	--created-before time               keeps the entries created before time
+//	--offset n                          skips the first n entries
+//	--limit n                           prints at most n entries
+//
+// The legacy `--sort-name` and `--sort-created` options are still accepted, optionally
+// followed by asc or desc. Sort fields and patterns are validated by the internal listings.
+func extractListOptions(usage string, args []string) ([]string, listOptions, error) {
+	rest := make([]string, 0, len(args))
+	var options listOptions
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if field, ok := strings.CutPrefix(arg, "--sort-"); ok {
+			if i+1 < len(args) && (args[i+1] == "asc" || args[i+1] == "desc") {
+				i++
+				field += ":" + args[i]
+			}
+			options.sort = append(options.sort, field)
+			continue
+		}
+		if arg == "--reverse" {
+			options.query.Reverse = true
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !isListValueOption(name) {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, options, usageError(usage)
+			}
+			i++
+			value = args[i]
+		}
+
+		var err error
+		switch name {
+		case "--sort":
+			options.sort = append(options.sort, value)
+		case "--order":
+			options.query.Order = value
+		case "--name":
+			options.query.Name = value
+			if caseInsensitive {
+				options.query.Name = strings.ToLower(value)
+			}
+		case "--name-regex":
+			options.query.NameRegexp = value
+			if caseInsensitive {
+				options.query.NameRegexp = "(?i)" + value
+			}
+		case "--description":
+			options.query.Description = value
+		case "--created-after":
+			options.query.CreatedAfter, err = parseTime(value)
+		case "--created-before":
+			options.query.CreatedBefore, err = parseTime(value)
+		case "--offset", "--limit":
+			n, convErr := strconv.Atoi(value)
+			if convErr != nil {
+				err = fmt.Errorf("Invalid %s %s, expected a number", name, quoteIfNeeded(value))
+			}
+			if name == "--offset" {
+				options.query.Offset = n
+			} else {
+				options.query.Limit = n
+			}
+		}
+		if err != nil {
+			return nil, options, usageError(err.Error())
+		}
+	}
+	return rest, options, nil
+}
+
+// listQuery returns the query of the listing, falling back to the configured sorting
+func (o listOptions) listQuery() internal.Query {
+	q := o.query
+	q.Sort = strings.Join(o.sort, ",")
+	if q.Sort == "" {
+		q.Sort = defaultSort
+	}
+	if q.Order == "" {
+		q.Order = defaultOrder
+	}
+	return q
+}
+
+// filtered reports whether entries are left out of the listing by a filter
+func (o listOptions) filtered() bool {
+	q := o.query
+	return q.Name != "" || q.NameRegexp != "" || q.Description != "" || !q.CreatedAfter.IsZero() || !q.CreatedBefore.IsZero()
+}
+
+// printPageInfo warns that a listing is incomplete, either because the filters matched
+// nothing or because only a page of the matching entries is shown.
+// It reports whether the listing is empty for a reason it explained, in which case
+// the plain and table formats have nothing left to print.
+func printPageInfo(kind string, options listOptions, shown, total int) bool {
+	offset := options.query.Offset
+	switch {
+	case total == 0 && options.filtered():
+		printWarning(fmt.Sprintf("No %s match the filters.", kind))
+		return true
+	case shown == 0 && total > 0:
+		printWarning(fmt.Sprintf("The offset %d is past the %d matching %s.", offset, total, kind))
+		return true
+	case shown < total:
+		printWarning(fmt.Sprintf("Showing %s %d-%d of %d.", kind, offset+1, offset+shown, total))
+	}
+	return false
+}
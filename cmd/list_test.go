@@ -0,0 +1,54 @@
+// list_test.go
+package main
+
+import (
+	"testing"
+	"virtual-file-system/internal"
+)
+
+func TestListOptions(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	captureOutput(func() {
+		executeCommand("register", []string{"user"})
+		executeCommand("create-folder", []string{"user", "docs"})
+		executeCommand("create-file", []string{"user", "docs", "report-2023", "Yearly report"})
+		executeCommand("create-file", []string{"user", "docs", "report-2024", "yearly REPORT"})
+		executeCommand("create-file", []string{"user", "docs", "notes", "meeting"})
+		executeCommand("create-file", []string{"user", "docs", "todo"})
+	})
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"user", "docs", "--name", "Report-*"}, "report-2023 \"Yearly report\" 2000-01-01 20:34:19 docs user\nreport-2024 \"yearly REPORT\" 2000-01-01 20:34:19 docs user\n"},
+		{[]string{"--name-regex", `^R.*4$`, "user", "docs"}, "report-2024 \"yearly REPORT\" 2000-01-01 20:34:19 docs user\n"},
+		{[]string{"user", "docs", "--description=meet"}, "notes meeting 2000-01-01 20:34:19 docs user\n"},
+		{[]string{"user", "docs", "--limit", "2"}, "Warning: Showing files 1-2 of 4.\nnotes meeting 2000-01-01 20:34:19 docs user\nreport-2023 \"Yearly report\" 2000-01-01 20:34:19 docs user\n"},
+		{[]string{"user", "docs", "--limit", "2", "--offset", "3"}, "Warning: Showing files 4-4 of 4.\ntodo 2000-01-01 20:34:19 docs user\n"},
+		{[]string{"user", "docs", "--offset", "4"}, "Warning: The offset 4 is past the 4 matching files.\n"},
+		{[]string{"user", "docs", "--reverse", "--limit", "1"}, "Warning: Showing files 1-1 of 4.\ntodo 2000-01-01 20:34:19 docs user\n"},
+		{[]string{"user", "docs", "--created-after", "2999-01-01"}, "Warning: No files match the filters.\n"},
+		{[]string{"user", "docs", "--created-before", "2000-01-01 00:00:00", "--output", "json"}, "[]\n"},
+		{[]string{"user", "docs", "--created-after", "yesterday"}, "Invalid time yesterday, expected YYYY-MM-DD, \"YYYY-MM-DD HH:MM:SS\" or RFC 3339\n"},
+		{[]string{"user", "docs", "--limit", "ten"}, "Invalid --limit ten, expected a number\n"},
+		{[]string{"user", "docs", "--limit", "-1"}, "Error: Invalid limit -1: must not be negative\n"},
+		{[]string{"user", "docs", "--name", "[a"}, "Error: Invalid name pattern [a: syntax error in pattern\n"},
+	}
+
+	for _, tt := range tests {
+		output := captureOutput(func() {
+			executeCommand("list-files", tt.args)
+		})
+		if !checkOutput(tt.expected, output) {
+			t.Errorf("args: %v\nexpected: %q\nbut got: %q", tt.args, tt.expected, output)
+		}
+	}
+
+	folders := captureOutput(func() {
+		executeCommand("list-folders", []string{"user", "--name", "d*", "--created-after", "2000-01-01T00:00:00Z"})
+	})
+	if !checkOutput("docs 2000-01-01 20:34:19 user\n", folders) {
+		t.Errorf("expected the docs folder but got: %q", folders)
+	}
+}
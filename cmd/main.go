@@ -2,11 +2,15 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"virtual-file-system/internal"
+	"virtual-file-system/internal/jsonrpc"
+	"virtual-file-system/internal/webhook"
 )
 
 var caseInsensitive = true
@@ -16,8 +20,8 @@ var quoteIfNeeded = internal.QuoteIfNeeded
 var commnadRegister = "Usage: register [username]"
 var commnadCreateFolder = "Usage: create-folder [username] [foldername] [description]?"
 var commnadCreateFile = "Usage: create-file [username] [foldername] [filename] [description]?"
-var commnadListFolders = "Usage: list-folders [username] [--sort-name|--sort-created] [asc|desc]"
-var commnadListFiles = "Usage: list-files [username] [foldername] [--sort-name|--sort-created] [asc|desc]"
+var commnadListFolders = "Usage: list-folders [username] [--sort field[:asc|desc],...]? [--order asc|desc]? [--reverse]? [filters]? [--offset n]? [--limit n]?"
+var commnadListFiles = "Usage: list-files [username] [foldername] [--sort field[:asc|desc],...]? [--order asc|desc]? [--reverse]? [filters]? [--offset n]? [--limit n]?"
 var commandDeleteFolder = "Usage: delete-folder [username] [foldername]"
 var commandDeleteFile = "Usage: delete-file [username] [foldername] [filename]"
 var commandRenameFolder = "Usage: rename-folder [username] [foldername] [new-folder-name]"
@@ -30,57 +34,64 @@ var commands = []string{
 	commandDeleteFolder,
 	commandDeleteFile,
 	commandRenameFolder,
+	commandRun,
+	commandSource,
+	commandUse,
+	commandCd,
+	commandAlias,
+	commandUnalias,
+	commandAddWebhook,
+	commandRemoveWebhook,
+	commandListWebhooks,
+	commandTestWebhook,
+	commandRedeliverWebhook,
+	commandCreateToken,
+	commandListTokens,
+	commandRevokeToken,
 	"\nnote: [username] [foldername] and [filename] are case insensitive.",
+	"note: after `use` and `cd`, the leading [username] and [foldername] can be left out.",
+	"note: [filters] are --name glob, --name-regex regexp, --description text, --created-after time and --created-before time.",
+	"note: aliases can also be defined in the config file, see README.",
 }
 
-// parseArgs parses the input command and splits it into arguments considering quotes
-func parseArgs(input string) []string {
-	var args []string
-	var current string
-	inQuotes := false
-	for _, char := range input {
-		switch char {
-		case ' ':
-			if inQuotes {
-				current += string(char)
-			} else if current != "" {
-				args = append(args, current)
-				current = ""
-			}
-		case '"':
-			inQuotes = !inQuotes
-		default:
-			current += string(char)
-		}
+// handleCommand processes a single command.
+// Results are printed to stdout; failures are returned for the caller to report.
+func handleCommand(command string, args []string) error {
+	command, args, err := expandAlias(command, args)
+	if err != nil {
+		return err
 	}
-	if current != "" {
-		args = append(args, current)
+	var listing listOptions
+	var options map[string]string
+	switch command {
+	case "list-folders":
+		args, listing, err = extractListOptions(commnadListFolders, args)
+	case "list-files":
+		args, listing, err = extractListOptions(commnadListFiles, args)
+	case "create-token":
+		args, options, err = extractOptions(commandCreateToken, args, "--scope", "--folder", "--expires")
 	}
-	return args
-}
-
-// handleCommand processes a single command
-func handleCommand(command string, args []string) {
+	if err != nil {
+		return err
+	}
+	args = withSessionContext(command, args)
 	switch command {
 	case "register":
 		if len(args) != 1 {
-			fmt.Println(commnadRegister)
-			return
+			return usageError(commnadRegister)
 		}
 		username := args[0]
 		if caseInsensitive {
 			username = strings.ToLower(username)
 		}
-		err := internal.RegisterUser(username)
+		err := registerUser(username)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-		} else {
-			fmt.Println("Add", quoteIfNeeded(username), "successfully.")
+			return err
 		}
+		printMessage(fmt.Sprintf("Add %s successfully.", quoteIfNeeded(username)))
 	case "create-folder":
 		if len(args) < 2 || len(args) > 3 {
-			fmt.Println(commnadCreateFolder)
-			return
+			return usageError(commnadCreateFolder)
 		}
 		username := args[0]
 		foldername := args[1]
@@ -92,16 +103,14 @@ func handleCommand(command string, args []string) {
 		if len(args) == 3 {
 			description = args[2]
 		}
-		err := internal.CreateFolder(username, foldername, description)
+		err := createFolder(username, foldername, description)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-		} else {
-			fmt.Println("Create", quoteIfNeeded(foldername), "successfully.")
+			return err
 		}
+		printMessage(fmt.Sprintf("Create %s successfully.", quoteIfNeeded(foldername)))
 	case "create-file":
 		if len(args) < 3 || len(args) > 4 {
-			fmt.Println(commnadCreateFile)
-			return
+			return usageError(commnadCreateFile)
 		}
 		username := args[0]
 		foldername := args[1]
@@ -115,51 +124,30 @@ func handleCommand(command string, args []string) {
 		if len(args) == 4 {
 			description = args[3]
 		}
-		err := internal.CreateFile(username, foldername, filename, description)
+		err := createFile(username, foldername, filename, description)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-		} else {
-			fmt.Printf("Create %s in %s/%s successfully.\n", quoteIfNeeded(filename), quoteIfNeeded(username), quoteIfNeeded(foldername))
+			return err
 		}
+		printMessage(fmt.Sprintf("Create %s in %s/%s successfully.", quoteIfNeeded(filename), quoteIfNeeded(username), quoteIfNeeded(foldername)))
 	case "list-folders":
-		if len(args) != 1 && len(args) != 3 {
-			fmt.Println(commnadListFolders)
-			return
+		if len(args) != 1 {
+			return usageError(commnadListFolders)
 		}
 		username := args[0]
 		if caseInsensitive {
 			username = strings.ToLower(username)
 		}
-		sortBy := "name"
-		order := "asc"
-		if len(args) == 3 {
-			sortBy = strings.TrimPrefix(args[1], "--sort-")
-			order = args[2]
-			if order != "asc" && order != "desc" {
-				fmt.Println(commnadListFolders)
-				return
-			}
-		}
-		folders, err := internal.ListFolders(username, sortBy, order)
+		folders, total, err := queryFolders(username, listing.listQuery())
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			return
+			return err
 		}
-		if len(folders) == 0 {
-			fmt.Printf("Warning: The %s doesn't have any folders.\n", quoteIfNeeded(username))
-			return
-		}
-		for _, folder := range folders {
-			if folder.Description != "" {
-				fmt.Printf("%s %s %s %s\n", quoteIfNeeded(folder.Name), quoteIfNeeded(folder.Description), folder.CreatedAt.Format("2006-01-02 15:04:05"), quoteIfNeeded(username))
-			} else {
-				fmt.Printf("%s %s %s\n", quoteIfNeeded(folder.Name), folder.CreatedAt.Format("2006-01-02 15:04:05"), quoteIfNeeded(username))
-			}
+		if printPageInfo("folders", listing, len(folders), total) && (outputFormat == formatPlain || outputFormat == formatTable) {
+			return nil
 		}
+		return printFolders(username, folders)
 	case "list-files":
-		if len(args) != 2 && len(args) != 4 {
-			fmt.Println(commnadListFiles)
-			return
+		if len(args) != 2 {
+			return usageError(commnadListFiles)
 		}
 		username := args[0]
 		foldername := args[1]
@@ -167,36 +155,17 @@ func handleCommand(command string, args []string) {
 			username = strings.ToLower(username)
 			foldername = strings.ToLower(foldername)
 		}
-		sortBy := "name"
-		order := "asc"
-		if len(args) == 4 {
-			sortBy = strings.TrimPrefix(args[2], "--sort-")
-			order = args[3]
-			if order != "asc" && order != "desc" {
-				fmt.Println(commnadListFiles)
-				return
-			}
-		}
-		files, err := internal.ListFiles(username, foldername, sortBy, order)
+		files, total, err := queryFiles(username, foldername, listing.listQuery())
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			return
+			return err
 		}
-		if len(files) == 0 {
-			fmt.Println("Warning: The folder is empty.")
-			return
-		}
-		for _, file := range files {
-			if file.Description != "" {
-				fmt.Printf("%s %s %s %s %s\n", quoteIfNeeded(file.Name), quoteIfNeeded(file.Description), file.CreatedAt.Format("2006-01-02 15:04:05"), quoteIfNeeded(foldername), quoteIfNeeded(username))
-			} else {
-				fmt.Printf("%s %s %s %s\n", quoteIfNeeded(file.Name), file.CreatedAt.Format("2006-01-02 15:04:05"), quoteIfNeeded(foldername), quoteIfNeeded(username))
-			}
+		if printPageInfo("files", listing, len(files), total) && (outputFormat == formatPlain || outputFormat == formatTable) {
+			return nil
 		}
+		return printFiles(username, foldername, files)
 	case "delete-folder":
 		if len(args) != 2 {
-			fmt.Println(commandDeleteFolder)
-			return
+			return usageError(commandDeleteFolder)
 		}
 		username := args[0]
 		foldername := args[1]
@@ -204,16 +173,15 @@ func handleCommand(command string, args []string) {
 			username = strings.ToLower(username)
 			foldername = strings.ToLower(foldername)
 		}
-		err := internal.DeleteFolder(username, foldername)
+		err := deleteFolder(username, foldername)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-		} else {
-			fmt.Println("Delete", quoteIfNeeded(foldername), "successfully.")
+			return err
 		}
+		followRename(username, foldername, "")
+		printMessage(fmt.Sprintf("Delete %s successfully.", quoteIfNeeded(foldername)))
 	case "delete-file":
 		if len(args) != 3 {
-			fmt.Println(commandDeleteFile)
-			return
+			return usageError(commandDeleteFile)
 		}
 		username := args[0]
 		foldername := args[1]
@@ -223,16 +191,14 @@ func handleCommand(command string, args []string) {
 			foldername = strings.ToLower(foldername)
 			filename = strings.ToLower(filename)
 		}
-		err := internal.DeleteFile(username, foldername, filename)
+		err := deleteFile(username, foldername, filename)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-		} else {
-			fmt.Printf("Delete %s in %s/%s successfully.\n", quoteIfNeeded(filename), quoteIfNeeded(username), quoteIfNeeded(foldername))
+			return err
 		}
+		printMessage(fmt.Sprintf("Delete %s in %s/%s successfully.", quoteIfNeeded(filename), quoteIfNeeded(username), quoteIfNeeded(foldername)))
 	case "rename-folder":
 		if len(args) != 3 {
-			fmt.Println(commandRenameFolder)
-			return
+			return usageError(commandRenameFolder)
 		}
 		username := args[0]
 		foldername := args[1]
@@ -242,52 +208,165 @@ func handleCommand(command string, args []string) {
 			foldername = strings.ToLower(foldername)
 			newFolderName = strings.ToLower(newFolderName)
 		}
-		err := internal.RenameFolder(username, foldername, newFolderName)
+		err := renameFolder(username, foldername, newFolderName)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-		} else {
-			fmt.Println("Rename", quoteIfNeeded(foldername), "to", quoteIfNeeded(newFolderName), "successfully.")
-		}
+			return err
+		}
+		followRename(username, foldername, newFolderName)
+		printMessage(fmt.Sprintf("Rename %s to %s successfully.", quoteIfNeeded(foldername), quoteIfNeeded(newFolderName)))
+	case "add-webhook", "remove-webhook", "list-webhooks", "test-webhook", "redeliver-webhook":
+		return handleWebhookCommand(command, args)
+	case "create-token", "list-tokens", "revoke-token":
+		return handleTokenCommand(command, args, options)
+	case "alias":
+		return handleAlias(args)
+	case "unalias":
+		return handleUnalias(args)
+	case "use":
+		return handleUse(args)
+	case "cd":
+		return handleCd(args)
+	case "run":
+		return handleRun(commandRun, args)
+	case "source":
+		return handleRun(commandSource, args)
 	case "exit":
-		fmt.Println("Exiting REPL...")
+		printMessage("Exiting REPL...")
+		webhooks.Close(webhookTimeout)
+		if err := internal.Flush(); err != nil {
+			return err
+		}
 		os.Exit(0)
 	case "help":
-		for _, command := range commands {
-			fmt.Println(command)
-		}
+		printMessage(strings.Join(commands, "\n"))
 	default:
-		fmt.Println("Unrecognized command")
+		return usageError("Unrecognized command")
 	}
+	return nil
 }
 
-func main() {
-	if len(os.Args) > 1 {
-		if err := internal.SetDataFile(os.Args[1]); err != nil {
-			fmt.Fprintln(os.Stderr, "Error: invalid data file path:", err)
-			return
+// run parses the command line, then either executes a single command and returns
+// or starts the REPL when no command is given.
+//
+// The serve, serve-9p, serve-ftp and serve-rpc commands run a server instead.
+// With --connect, commands are sent to a serve-rpc daemon and the data file is left alone.
+// Settings of the config file apply first and are overridden by the options given.
+//
+// Usage: vfs [--config path] [--data path | --connect path] [--output format] [--columns list] [command] [args...]
+func run(arguments []string) int {
+	flags := flag.NewFlagSet("vfs", flag.ContinueOnError)
+	configFile := flags.String("config", "", "path of the config file (default \"$XDG_CONFIG_HOME/vfs/config\")")
+	dataFile := flags.String("data", "", "path of the JSON data file (default \"data.json\")")
+	format := flags.String("output", formatPlain, "output format: json, csv, table or plain")
+	columns := flags.String("columns", "", "comma-separated columns of listings, e.g. name,created,description")
+	connect := flags.String("connect", "", "path of the Unix socket of a serve-rpc daemon to send commands to")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: vfs [--config path] [--data path | --connect path] [--output format] [--columns list] [command] [args...]")
+		fmt.Fprintln(flags.Output(), "       vfs [--config path] [--data path] serve [--addr host:port] [limits] [--auth]")
+		fmt.Fprintln(flags.Output(), "       vfs [--config path] [--data path] serve-9p [--addr host:port | --socket path]")
+		fmt.Fprintln(flags.Output(), "       vfs [--config path] [--data path] serve-ftp [--addr host:port]")
+		fmt.Fprintln(flags.Output(), "       vfs [--config path] [--data path] serve-rpc [--socket path] [--max-batch n]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(arguments); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
 		}
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: invalid config file:", err)
+		return exitUsage
+	}
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["output"] && cfg.output != "" {
+		*format = cfg.output
+	}
+	if !set["data"] && cfg.data != "" {
+		*dataFile = cfg.data
+	}
+
+	if !isValidFormat(*format) {
+		outputFormat = formatPlain
+		reportError(usageError(optionOutput))
+		return exitUsage
 	}
+	outputFormat = *format
 
-	if err := internal.LoadData(); err != nil {
-		fmt.Fprintln(os.Stderr, "Error: loading data:", err)
-		return
+	selectedColumns = nil
+	if *columns != "" {
+		names, err := parseColumns(*columns)
+		if err != nil {
+			reportError(err)
+			return exitUsage
+		}
+		selectedColumns = names
+	}
+
+	if *connect != "" {
+		if set["data"] || strings.HasPrefix(flags.Arg(0), "serve") {
+			fmt.Fprintln(os.Stderr, "Error: --connect can't be combined with --data or a serve command")
+			return exitUsage
+		}
+		client, err := jsonrpc.Dial(*connect)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: cannot connect to the daemon:", err)
+			return exitIO
+		}
+		defer client.Close()
+		useRemote(client)
+		defer useLocal()
+	} else if *dataFile != "" {
+		if err := internal.SetDataFile(*dataFile); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: invalid data file path:", err)
+			return exitUsage
+		}
 	}
 
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("Virtual File System REPL")
-	fmt.Println("Type `help` to show the commands.")
-	fmt.Println("------------------------")
-	for {
-		fmt.Print("# ")
-		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(input)
-		args := parseArgs(input)
-		if len(args) < 1 {
-			fmt.Println("No command provided")
-			continue
+	if *connect == "" {
+		if err := internal.LoadData(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitCode(err)
 		}
+		webhooks = webhook.NewDispatcher(webhook.NewStore(webhookFile(internal.DataFile())))
+		if err := webhooks.Start(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitFailure
+		}
+		// Deliveries still being retried at exit become dead letters
+		defer webhooks.Close(webhookTimeout)
+	}
+
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
 
-		command := args[0]
-		handleCommand(command, args[1:])
+	code := exitOK
+	if flags.Arg(0) == "serve" {
+		code = serve(flags.Args()[1:])
+	} else if flags.Arg(0) == "serve-9p" {
+		code = serve9P(flags.Args()[1:])
+	} else if flags.Arg(0) == "serve-ftp" {
+		code = serveFTP(flags.Args()[1:])
+	} else if flags.Arg(0) == "serve-rpc" {
+		code = serveRPC(flags.Args()[1:])
+	} else if flags.NArg() > 0 {
+		code = exitCode(executeCommand(flags.Arg(0), flags.Args()[1:]))
+	} else {
+		code = repl(newLineReader())
 	}
+
+	if err := internal.Flush(); err != nil {
+		reportError(err)
+		if code == exitOK {
+			code = exitCode(err)
+		}
+	}
+	return code
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
 }
@@ -11,6 +11,18 @@ import (
 	"virtual-file-system/internal"
 )
 
+// TestMain keeps the user's config file from affecting the tests
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "vfs-config")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func captureOutput(f func()) string {
 	reader, writer, err := os.Pipe()
 	if err != nil {
@@ -38,6 +50,47 @@ func captureOutput(f func()) string {
 	return <-out
 }
 
+// captureStreams runs f and returns what it wrote to stdout and stderr separately
+func captureStreams(f func()) (string, string) {
+	var stderr string
+	stdout := captureStdout(func() {
+		stderr = captureStderr(f)
+	})
+	return stdout, stderr
+}
+
+func captureStdout(f func()) string {
+	return captureFile(&os.Stdout, f)
+}
+
+func captureStderr(f func()) string {
+	return captureFile(&os.Stderr, f)
+}
+
+func captureFile(file **os.File, f func()) string {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+
+	original := *file
+	*file = writer
+
+	out := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, reader)
+		out <- buf.String()
+	}()
+
+	f()
+
+	writer.Close()
+	*file = original
+
+	return <-out
+}
+
 func checkOutput(expected, actual string) bool {
 	expectedLines := strings.Split(expected, "\n")
 	actualLines := strings.Split(actual, "\n")
@@ -81,7 +134,13 @@ func TestHandleCommand(t *testing.T) {
 		{"list-folders", []string{"user", "--sort-name", "desc"}, "folder_b 2000-01-01 20:34:19 user\nfolder_a 2000-01-01 20:34:19 user\n"},
 		{"list-folders", []string{"user", "--sort-created", "asc"}, "folder_a 2000-01-01 20:34:19 user\nfolder_b 2000-01-01 20:34:19 user\n"},
 		{"list-folders", []string{"user", "--sort-created", "desc"}, "folder_b 2000-01-01 20:34:19 user\nfolder_a 2000-01-01 20:34:19 user\n"},
-		{"list-folders", []string{"user", "--sort-created"}, "Usage: list-folders [username] [--sort-name|--sort-created] [asc|desc]\n"},
+		{"list-folders", []string{"user", "--sort-created"}, "folder_a 2000-01-01 20:34:19 user\nfolder_b 2000-01-01 20:34:19 user\n"},
+		{"list-folders", []string{"--sort", "created", "user", "--order", "desc"}, "folder_b 2000-01-01 20:34:19 user\nfolder_a 2000-01-01 20:34:19 user\n"},
+		{"list-folders", []string{"user", "--sort=name:desc"}, "folder_b 2000-01-01 20:34:19 user\nfolder_a 2000-01-01 20:34:19 user\n"},
+		{"list-folders", []string{"--reverse", "user"}, "folder_b 2000-01-01 20:34:19 user\nfolder_a 2000-01-01 20:34:19 user\n"},
+		{"list-folders", []string{"user", "--sort", "size"}, "Error: Unknown sort field size, expected one of name,created,description\n"},
+		{"list-folders", []string{"user", "--order", "up"}, "Error: Unknown sort order up, expected asc or desc\n"},
+		{"list-folders", []string{"user", "--sort"}, "Usage: list-folders [username] [--sort field[:asc|desc],...]? [--order asc|desc]? [--reverse]? [filters]? [--offset n]? [--limit n]?\n"},
 		{"create-file", []string{"user", "folder_a", "file_a"}, "Create file_a in user/folder_a successfully.\n"},
 		{"create-file", []string{"user", "folder_a", "file_b"}, "Create file_b in user/folder_a successfully.\n"},
 		{"list-files", []string{"user", "folder_a"}, "file_a 2000-01-01 20:34:19 folder_a user\nfile_b 2000-01-01 20:34:19 folder_a user\n"},
@@ -146,7 +205,7 @@ func TestHandleCommand(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.command, func(t *testing.T) {
 			output := captureOutput(func() {
-				handleCommand(tt.command, tt.args)
+				reportError(handleCommand(tt.command, tt.args))
 			})
 			if !checkOutput(tt.expected, output) {
 				t.Errorf("command: %v, args: %v\nexpected: %q\nbut got: %q", tt.command, tt.args, tt.expected, output)
@@ -154,3 +213,81 @@ func TestHandleCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestRunOneShot(t *testing.T) {
+	mockUsers := make(map[string]*internal.User)
+	internal.UseMockData(mockUsers)
+
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"register", "shot"}, 0, "Add shot successfully.\n"},
+		{[]string{"create-folder", "shot", "folder a", "desc"}, 0, "Create \"folder a\" successfully.\n"},
+		{[]string{"list-folders", "shot", "--sort-name", "asc"}, 0, "\"folder a\" desc 2000-01-01 20:34:19 shot\n"},
+		{[]string{"register", "shot"}, 4, "Error: The shot has already existed.\n"},
+		{[]string{"create-folder", "nobody", "folder"}, 3, "Error: The nobody doesn't exist.\n"},
+		{[]string{"create-file", "shot", "folder a", "!"}, 5, "Error: The ! contains invalid chars.\n"},
+		{[]string{"list-folders", "shot", "--sort-name"}, 0, "\"folder a\" desc 2000-01-01 20:34:19 shot\n"},
+		{[]string{"list-folders", "shot", "--sort", "size"}, 2, "Error: Unknown sort field size, expected one of name,created,description\n"},
+		{[]string{"list-folders", "shot", "--order"}, 2, "Usage: list-folders [username] [--sort field[:asc|desc],...]? [--order asc|desc]? [--reverse]? [filters]? [--offset n]? [--limit n]?\n"},
+		{[]string{"unknown"}, 2, "Unrecognized command\n"},
+		{[]string{"--data", "data/", "list-folders", "shot"}, 2, "Error: invalid data file path: provided path ends with a '/', please provide a valid file path\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			var code int
+			output := captureOutput(func() {
+				code = run(tt.args)
+			})
+			if code != tt.code {
+				t.Errorf("args: %v\nexpected exit code %d but got %d", tt.args, tt.code, code)
+			}
+			if !checkOutput(tt.expected, output) {
+				t.Errorf("args: %v\nexpected: %q\nbut got: %q", tt.args, tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestRunUnknownFlag(t *testing.T) {
+	var code int
+	output := captureOutput(func() {
+		code = run([]string{"--unknown"})
+	})
+	if code != exitUsage {
+		t.Errorf("expected exit code %d but got %d", exitUsage, code)
+	}
+	if !strings.HasPrefix(output, "flag provided but not defined: -unknown\nUsage: vfs ") {
+		t.Errorf("expected a flag error followed by the usage but got: %q", output)
+	}
+}
+
+func TestOutputStreams(t *testing.T) {
+	mockUsers := make(map[string]*internal.User)
+	internal.UseMockData(mockUsers)
+
+	tests := []struct {
+		args   []string
+		stdout string
+		stderr string
+	}{
+		{[]string{"register", "streams"}, "Add streams successfully.\n", ""},
+		{[]string{"register", "streams"}, "", "Error: The streams has already existed.\n"},
+		{[]string{"list-folders", "streams"}, "", "Warning: The streams doesn't have any folders.\n"},
+		{[]string{"delete-folder", "streams"}, "", "Usage: delete-folder [username] [foldername]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			stdout, stderr := captureStreams(func() {
+				run(tt.args)
+			})
+			if stdout != tt.stdout || stderr != tt.stderr {
+				t.Errorf("args: %v\nexpected stdout %q and stderr %q\nbut got stdout %q and stderr %q", tt.args, tt.stdout, tt.stderr, stdout, stderr)
+			}
+		})
+	}
+}
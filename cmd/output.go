@@ -0,0 +1,358 @@
+// output.go
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"virtual-file-system/internal"
+)
+
+// Output formats selected with --output
+const (
+	formatPlain = "plain"
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+var outputFormat = formatPlain
+
+var optionOutput = "Usage: --output json|csv|table|plain"
+
+// timeLayout is used by the plain and table formats, the structured formats use RFC 3339
+var timeLayout = "2006-01-02 15:04:05"
+
+// entry is a folder or a file in a listing
+type entry struct {
+	name        string
+	description string
+	createdAt   time.Time
+	folder      string
+	user        string
+}
+
+// column describes a field of an entry
+type column struct {
+	name     string // selected with --columns
+	key      string // key in the json and csv formats
+	title    string // header in the table format
+	numeric  bool   // right-aligned in the table format
+	truncate bool   // may be shortened to fit the table into the terminal
+	value    func(e entry) string
+}
+
+var columnName = column{"name", "name", "NAME", false, true, func(e entry) string { return e.name }}
+var columnDescription = column{"description", "description", "DESCRIPTION", false, true, func(e entry) string { return e.description }}
+var columnCreated = column{"created", "created_at", "CREATED", false, false, func(e entry) string { return formatTime(e.createdAt) }}
+var columnFolder = column{"folder", "folder", "FOLDER", false, true, func(e entry) string { return e.folder }}
+var columnUser = column{"user", "user", "USER", false, true, func(e entry) string { return e.user }}
+var columnDescriptionLength = column{"desc-len", "description_length", "DESC LEN", true, false, func(e entry) string {
+	return fmt.Sprint(utf8.RuneCountInString(e.description))
+}}
+
+// The default columns of each listing, followed by the extra ones that can be selected with --columns
+var folderColumns = []column{columnName, columnDescription, columnCreated, columnUser}
+var folderExtraColumns = []column{columnDescriptionLength}
+var fileColumns = []column{columnName, columnDescription, columnCreated, columnFolder, columnUser}
+var fileExtraColumns = []column{columnDescriptionLength}
+
+// selectedColumns holds the column names given with --columns, nil for the defaults
+var selectedColumns []string
+
+var optionColumns = "Usage: --columns name,description,created,folder,user,desc-len"
+
+// isValidFormat reports whether format can be used with --output
+func isValidFormat(format string) bool {
+	switch format {
+	case formatPlain, formatTable, formatJSON, formatCSV:
+		return true
+	}
+	return false
+}
+
+// displayOptions holds the --output and --columns options given to a single command
+type displayOptions struct {
+	format  string
+	columns []string
+}
+
+// parseColumns splits the value of --columns
+func parseColumns(value string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, usageError(optionColumns)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// valueOptions are the options of commands followed by a value, which is never taken for
+// --output or --columns
+var valueOptions = append([]string{"--scope", "--folder", "--expires", "--user", "--events", "--secret"}, listValueOptions...)
+
+// extractDisplayOptions removes `--output format` and `--columns list`, or their `--option=value`
+// forms, from args and returns the remaining arguments with the options that were given.
+// Arguments after `--`, values of other options and a trailing option without a value are
+// left as they are, e.g. in `create-file u f x --output` the description is `--output`.
+func extractDisplayOptions(args []string) ([]string, displayOptions, error) {
+	rest := make([]string, 0, len(args))
+	var options displayOptions
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			rest = append(rest, args[i+1:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if slices.Contains(valueOptions, args[i]) && i+1 < len(args) {
+			rest = append(rest, args[i], args[i+1])
+			i++
+			continue
+		}
+		if name != "--output" && name != "--columns" || !hasValue && i+1 == len(args) {
+			rest = append(rest, args[i])
+			continue
+		}
+		if !hasValue {
+			i++
+			value = args[i]
+		}
+
+		if name == "--output" {
+			if !isValidFormat(value) {
+				return nil, options, usageError(optionOutput)
+			}
+			options.format = value
+			continue
+		}
+		columns, err := parseColumns(value)
+		if err != nil {
+			return nil, options, err
+		}
+		options.columns = columns
+	}
+	return rest, options, nil
+}
+
+// executeCommand runs a command with its --output and --columns options applied and reports its error
+// in the same format.
+func executeCommand(command string, args []string) error {
+	args, options, err := extractDisplayOptions(args)
+	if err != nil {
+		reportError(err)
+		return err
+	}
+	if options.format != "" {
+		defer func(previous string) { outputFormat = previous }(outputFormat)
+		outputFormat = options.format
+	}
+	if options.columns != nil {
+		defer func(previous []string) { selectedColumns = previous }(selectedColumns)
+		selectedColumns = options.columns
+	}
+	err = handleCommand(command, args)
+	reportError(err)
+	return err
+}
+
+func formatTime(t time.Time) string {
+	if displayLocation != nil {
+		t = t.In(displayLocation)
+	}
+	if outputFormat == formatJSON || outputFormat == formatCSV {
+		return t.Format(time.RFC3339)
+	}
+	return t.Format(timeLayout)
+}
+
+// jsonString encodes s as a JSON string
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// jsonObject encodes the keys and values as a JSON object keeping their order
+func jsonObject(keys, values []string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(jsonString(keys[i]))
+		b.WriteByte(':')
+		b.WriteString(values[i])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func writeCSV(w io.Writer, records [][]string) {
+	writer := csv.NewWriter(w)
+	writer.WriteAll(records)
+}
+
+// printMessage prints the result of a command that doesn't list anything
+func printMessage(message string) {
+	switch outputFormat {
+	case formatJSON:
+		fmt.Println(jsonObject([]string{"message"}, []string{jsonString(message)}))
+	case formatCSV:
+		writeCSV(os.Stdout, [][]string{{"message"}, {message}})
+	default:
+		fmt.Println(message)
+	}
+}
+
+// printWarning prints a warning to stderr.
+// Warnings are left out of the structured formats, where an empty listing speaks for itself.
+func printWarning(message string) {
+	if outputFormat == formatJSON || outputFormat == formatCSV {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Warning:", message)
+}
+
+// printEntries prints a listing in the current format.
+// The selected columns are taken from defaults and extras; the plain format switches to
+// a table when columns are selected since its layout is fixed.
+func printEntries(defaults, extras []column, entries []entry) error {
+	columns, err := selectColumns(defaults, extras, selectedColumns)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(entries))
+	for i, e := range entries {
+		rows[i] = make([]string, len(columns))
+		for j, c := range columns {
+			rows[i][j] = c.value(e)
+		}
+	}
+
+	switch {
+	case outputFormat == formatJSON:
+		keys := make([]string, len(columns))
+		for i, c := range columns {
+			keys[i] = c.key
+		}
+		lines := make([]string, len(rows))
+		for i, row := range rows {
+			values := make([]string, len(row))
+			for j, value := range row {
+				values[j] = jsonString(value)
+				if columns[j].numeric {
+					values[j] = value
+				}
+			}
+			lines[i] = jsonObject(keys, values)
+		}
+		fmt.Println("[" + strings.Join(lines, ",") + "]")
+	case outputFormat == formatCSV:
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = c.key
+		}
+		writeCSV(os.Stdout, append([][]string{header}, rows...))
+	case outputFormat == formatTable || selectedColumns != nil:
+		renderTable(os.Stdout, columns, rows, tableWidth())
+	default:
+		for _, e := range entries {
+			fields := []string{quoteIfNeeded(e.name)}
+			if e.description != "" {
+				fields = append(fields, quoteIfNeeded(e.description))
+			}
+			fields = append(fields, formatTime(e.createdAt))
+			if e.folder != "" {
+				fields = append(fields, quoteIfNeeded(e.folder))
+			}
+			fields = append(fields, quoteIfNeeded(e.user))
+			fmt.Println(strings.Join(fields, " "))
+		}
+	}
+	return nil
+}
+
+// printFolders prints the folders of a user
+func printFolders(username string, folders []*internal.Folder) error {
+	if len(folders) == 0 {
+		printWarning(fmt.Sprintf("The %s doesn't have any folders.", quoteIfNeeded(username)))
+		if outputFormat == formatPlain || outputFormat == formatTable {
+			return nil
+		}
+	}
+	entries := make([]entry, len(folders))
+	for i, folder := range folders {
+		entries[i] = entry{name: folder.Name, description: folder.Description, createdAt: folder.CreatedAt, user: username}
+	}
+	return printEntries(folderColumns, folderExtraColumns, entries)
+}
+
+// printFiles prints the files in a folder of a user
+func printFiles(username, foldername string, files []*internal.File) error {
+	if len(files) == 0 {
+		printWarning("The folder is empty.")
+		if outputFormat == formatPlain || outputFormat == formatTable {
+			return nil
+		}
+	}
+	entries := make([]entry, len(files))
+	for i, file := range files {
+		entries[i] = entry{name: file.Name, description: file.Description, createdAt: file.CreatedAt, folder: foldername, user: username}
+	}
+	return printEntries(fileColumns, fileExtraColumns, entries)
+}
+
+// errorCode names the category of an error in the structured formats
+func errorCode(err error) string {
+	switch exitCode(err) {
+	case exitUsage:
+		return "usage"
+	case exitNotFound:
+		return "not_found"
+	case exitAlreadyExists:
+		return "already_exists"
+	case exitInvalidName:
+		return "invalid_name"
+	case exitIO:
+		return "io"
+	case exitFailure:
+		return "failure"
+	}
+	return "interrupted"
+}
+
+// reportError prints an error returned by handleCommand to stderr
+func reportError(err error) {
+	if err == nil {
+		return
+	}
+	message := err.Error()
+	switch outputFormat {
+	case formatJSON:
+		keys := []string{"code", "message", "exit_code"}
+		values := []string{jsonString(errorCode(err)), jsonString(message), fmt.Sprint(exitCode(err))}
+		fmt.Fprintln(os.Stderr, jsonObject([]string{"error"}, []string{jsonObject(keys, values)}))
+	case formatCSV:
+		writeCSV(os.Stderr, [][]string{{"code", "message", "exit_code"}, {errorCode(err), message, fmt.Sprint(exitCode(err))}})
+	default:
+		// A script's summary is printed whole, even when its first failure is a usage error
+		var script *scriptError
+		var usage usageError
+		if !errors.As(err, &script) && errors.As(err, &usage) {
+			fmt.Fprintln(os.Stderr, usage)
+			return
+		}
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+}
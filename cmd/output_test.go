@@ -0,0 +1,76 @@
+// output_test.go
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+// normalizeTimes replaces the timestamps of all output formats with a fixed value
+func normalizeTimes(output string) string {
+	rfc3339 := regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(Z|[+-]\d{2}:\d{2})`)
+	layout := regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}`)
+	output = rfc3339.ReplaceAllString(output, "2000-01-01T20:34:19Z")
+	return layout.ReplaceAllString(output, "2000-01-01 20:34:19")
+}
+
+func TestOutputFormats(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+
+	tests := []struct {
+		args   []string
+		stdout string
+		stderr string
+	}{
+		{[]string{"--output", "json", "register", "format"}, "{\"message\":\"Add format successfully.\"}\n", ""},
+		{[]string{"--output", "json", "list-folders", "format"}, "[]\n", ""},
+		{[]string{"--output=csv", "create-folder", "format", "folder b", "say \"hi\", bye"}, "message\n\"Create \"\"folder b\"\" successfully.\"\n", ""},
+		{[]string{"create-folder", "format", "folder a"}, "Create \"folder a\" successfully.\n", ""},
+		{
+			[]string{"--output", "json", "list-folders", "format"},
+			"[{\"name\":\"folder a\",\"description\":\"\",\"created_at\":\"2000-01-01T20:34:19Z\",\"user\":\"format\"}," +
+				"{\"name\":\"folder b\",\"description\":\"say \\\"hi\\\", bye\",\"created_at\":\"2000-01-01T20:34:19Z\",\"user\":\"format\"}]\n",
+			"",
+		},
+		{
+			[]string{"--output", "csv", "list-folders", "format"},
+			"name,description,created_at,user\nfolder a,,2000-01-01T20:34:19Z,format\nfolder b,\"say \"\"hi\"\", bye\",2000-01-01T20:34:19Z,format\n",
+			"",
+		},
+		{
+			[]string{"--output", "table", "list-folders", "format"},
+			"NAME      DESCRIPTION    CREATED              USER\nfolder a                 2000-01-01 20:34:19  format\nfolder b  say \"hi\", bye  2000-01-01 20:34:19  format\n",
+			"",
+		},
+		{[]string{"create-file", "format", "folder a", "file a", "--output", "json"}, "{\"message\":\"Create \\\"file a\\\" in format/\\\"folder a\\\" successfully.\"}\n", ""},
+		{
+			[]string{"--output", "csv", "list-files", "format", "folder a"},
+			"name,description,created_at,folder,user\nfile a,,2000-01-01T20:34:19Z,folder a,format\n",
+			"",
+		},
+		{[]string{"--output", "json", "list-files", "format", "folder b"}, "[]\n", ""},
+		{[]string{"--output", "table", "list-files", "format", "folder b"}, "", "Warning: The folder is empty.\n"},
+		{[]string{"--output", "json", "list-folders", "nobody"}, "", "{\"error\":{\"code\":\"not_found\",\"message\":\"The nobody doesn't exist.\",\"exit_code\":3}}\n"},
+		{[]string{"--output", "csv", "register", "!"}, "", "code,message,exit_code\ninvalid_name,The ! contains invalid chars.,5\n"},
+		{[]string{"--output", "json", "delete-file", "format"}, "", "{\"error\":{\"code\":\"usage\",\"message\":\"Usage: delete-file [username] [foldername] [filename]\",\"exit_code\":2}}\n"},
+		{[]string{"--output", "xml", "list-folders", "format"}, "", optionOutput + "\n"},
+		{[]string{"list-folders", "format", "--output"}, "", commnadListFolders + "\n"},
+		{[]string{"create-file", "format", "folder b", "dash", "--output"}, "Create dash in format/\"folder b\" successfully.\n", ""},
+		{[]string{"create-file", "format", "folder b", "dashes", "--", "--output=json"}, "Create dashes in format/\"folder b\" successfully.\n", ""},
+		{[]string{"list-files", "format", "folder b", "--description", "--output", "--output", "csv", "--columns", "name,description"}, "name,description\ndash,--output\ndashes,--output=json\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			stdout, stderr := captureStreams(func() {
+				run(tt.args)
+			})
+			stdout = normalizeTimes(stdout)
+			if stdout != tt.stdout || stderr != tt.stderr {
+				t.Errorf("args: %v\nexpected stdout %q and stderr %q\nbut got stdout %q and stderr %q", tt.args, tt.stdout, tt.stderr, stdout, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// repl.go
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// historyFileName is the file in the home directory that keeps the REPL history
+const historyFileName = ".vfs_history"
+
+// lineReader reads the lines of the REPL
+type lineReader interface {
+	// showPrompt prints the prompt of the next line
+	showPrompt(prompt string)
+	// readLine reads the next line, returning errLineCancelled when the user discarded it
+	readLine() (string, error)
+	// close restores the terminal when the REPL returns while a line is still being read
+	close()
+}
+
+// plainReader reads lines from a pipe, a file or a terminal in its normal mode
+type plainReader struct {
+	reader *bufio.Reader
+}
+
+func newPlainReader(in io.Reader) *plainReader {
+	return &plainReader{reader: bufio.NewReader(in)}
+}
+
+func (r *plainReader) showPrompt(prompt string) {
+	fmt.Print(prompt)
+}
+
+func (r *plainReader) readLine() (string, error) {
+	return r.reader.ReadString('\n')
+}
+
+func (r *plainReader) close() {}
+
+// terminalReader edits lines on a terminal, which is in raw mode only while a line is read
+type terminalReader struct {
+	fd     uintptr
+	editor *lineEditor
+
+	mu    sync.Mutex
+	state *terminalState // the mode to restore while in raw mode
+}
+
+func (r *terminalReader) showPrompt(prompt string) {
+	r.editor.showPrompt(prompt)
+}
+
+func (r *terminalReader) readLine() (string, error) {
+	state, err := makeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.state = state
+	r.mu.Unlock()
+	defer r.close()
+	return r.editor.readLine()
+}
+
+// close leaves raw mode, either after reading a line or when the REPL returns while the
+// reading goroutine is still blocked
+func (r *terminalReader) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state != nil {
+		restoreTerminal(r.fd, r.state)
+		r.state = nil
+	}
+}
+
+// newLineReader returns a line editor with history and completion when both stdin and
+// stdout are terminals, and a plain reader otherwise.
+func newLineReader() lineReader {
+	if !isTerminal(os.Stdin.Fd()) || !isTerminal(os.Stdout.Fd()) {
+		return newPlainReader(os.Stdin)
+	}
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyFile = filepath.Join(home, historyFileName)
+	}
+	return &terminalReader{
+		fd:     os.Stdin.Fd(),
+		editor: newLineEditor(os.Stdin, os.Stdout, completeLine, historyFile),
+	}
+}
+
+// replLine is a line read from the REPL input, err is set once the input ends
+type replLine struct {
+	text string
+	err  error
+}
+
+// repl reads commands from reader and executes them until `exit`, the end of the input or SIGTERM.
+// SIGINT at the prompt cancels the current line instead of exiting.
+func repl(reader lineReader) int {
+	fmt.Println("Virtual File System REPL")
+	fmt.Println("Type `help` to show the commands.")
+	fmt.Println("------------------------")
+	defer reader.close()
+
+	var pending chan replLine
+	for {
+		// A line that is still being read after SIGINT keeps being read under a new prompt
+		if pending == nil {
+			reader.showPrompt(sessionPrompt())
+			pending = make(chan replLine, 1)
+			go func(lines chan<- replLine) {
+				text, err := reader.readLine()
+				lines <- replLine{text: text, err: err}
+			}(pending)
+		}
+
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGTERM {
+				fmt.Println()
+				return signalExitCode(sig)
+			}
+			fmt.Println("^C")
+			reader.showPrompt(sessionPrompt())
+		case line := <-pending:
+			pending = nil
+			if errors.Is(line.err, errLineCancelled) {
+				continue
+			}
+			if line.err != nil && line.text == "" {
+				fmt.Println()
+				return exitOK
+			}
+
+			args, err := parseArgs(line.text)
+			if err != nil {
+				reportError(err)
+				continue
+			}
+			if len(args) < 1 {
+				reportError(usageError("No command provided"))
+				continue
+			}
+
+			err = executeCommand(args[0], args[1:])
+			var interrupted interruptedError
+			if errors.As(err, &interrupted) && interrupted.signal == syscall.SIGTERM {
+				return signalExitCode(interrupted.signal)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// repl_test.go
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+const replBanner = "Virtual File System REPL\nType `help` to show the commands.\n------------------------\n"
+
+func TestReplEOF(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+
+	var code int
+	output := captureOutput(func() {
+		code = repl(newPlainReader(strings.NewReader("register repl\n\nlist-folders repl")))
+	})
+
+	expected := replBanner +
+		"# Add repl successfully.\n" +
+		"# No command provided\n" +
+		"# Warning: The repl doesn't have any folders.\n" +
+		"# \n"
+	if code != exitOK {
+		t.Errorf("expected exit code %d but got %d", exitOK, code)
+	}
+	if output != expected {
+		t.Errorf("expected: %q\nbut got: %q", expected, output)
+	}
+}
+
+func TestReplSignals(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	original := signals
+	defer func() { signals = original }()
+
+	tests := []struct {
+		signal   os.Signal
+		code     int
+		expected string
+	}{
+		{os.Interrupt, exitOK, replBanner + "# ^C\n# \n"},
+		{syscall.SIGTERM, 143, replBanner + "# \n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.signal.String(), func(t *testing.T) {
+			// An unbuffered channel makes sure the REPL has received the signal before the input ends
+			signals = make(chan os.Signal)
+			reader, writer := io.Pipe()
+			var code int
+			output := captureOutput(func() {
+				done := make(chan struct{})
+				go func() {
+					code = repl(newPlainReader(reader))
+					close(done)
+				}()
+				signals <- tt.signal
+				writer.Close()
+				<-done
+			})
+			if code != tt.code {
+				t.Errorf("expected exit code %d but got %d", tt.code, code)
+			}
+			if output != tt.expected {
+				t.Errorf("expected: %q\nbut got: %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestScriptInterrupted(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	original := signals
+	defer func() { signals = original }()
+
+	signals = make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+	path := writeScript(t, "register interrupted\n")
+	output := captureOutput(func() {
+		if code := exitCode(runScript(path, false)); code != 143 {
+			t.Errorf("expected exit code %d but got %d", 143, code)
+		}
+	})
+	if output != "" {
+		t.Errorf("expected no output but got: %q", output)
+	}
+}
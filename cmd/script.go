@@ -0,0 +1,164 @@
+// script.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var commandRun = "Usage: run [--stop-on-error|--continue] [script]"
+var commandSource = "Usage: source [--stop-on-error|--continue] [script]"
+
+// maxScriptDepth limits how deeply scripts can run other scripts
+const maxScriptDepth = 16
+
+var scriptDepth = 0
+
+// scriptLine is a command read from a script with the line number it starts on
+type scriptLine struct {
+	number int
+	text   string
+}
+
+// scriptFailure is a command of a script that returned an error
+type scriptFailure struct {
+	line int
+	err  error
+}
+
+// scriptError summarizes the failed commands of a script.
+// It unwraps to the first failure so exitCode reports its category.
+type scriptError struct {
+	path     string
+	total    int
+	failures []scriptFailure
+}
+
+func (e *scriptError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d commands in %s failed:", len(e.failures), e.total, quoteIfNeeded(e.path))
+	for _, failure := range e.failures {
+		fmt.Fprintf(&b, "\n  line %d: %v", failure.line, failure.err)
+	}
+	return b.String()
+}
+
+func (e *scriptError) Unwrap() error {
+	return e.failures[0].err
+}
+
+// readScript splits a script into commands.
+// Blank lines and lines starting with `#` are skipped, and a line ending with `\`
+// is joined with the next line by a single space. Lines left empty after joining are skipped.
+func readScript(r io.Reader) ([]scriptLine, error) {
+	var lines []scriptLine
+	var current *scriptLine
+	scanner := bufio.NewScanner(r)
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSpace(scanner.Text())
+		if current == nil && (text == "" || strings.HasPrefix(text, "#")) {
+			continue
+		}
+
+		continued := strings.HasSuffix(text, "\\")
+		text = strings.TrimSpace(strings.TrimSuffix(text, "\\"))
+		if current == nil {
+			current = &scriptLine{number: number, text: text}
+		} else {
+			current.text = strings.TrimSpace(current.text + " " + text)
+		}
+
+		if !continued {
+			if current.text != "" {
+				lines = append(lines, *current)
+			}
+			current = nil
+		}
+	}
+	if current != nil && current.text != "" {
+		lines = append(lines, *current)
+	}
+	return lines, scanner.Err()
+}
+
+// handleRun executes the `run` and `source` commands
+func handleRun(usage string, args []string) error {
+	stopOnError := false
+	path := ""
+	for _, arg := range args {
+		switch arg {
+		case "--stop-on-error":
+			stopOnError = true
+		case "--continue":
+			stopOnError = false
+		default:
+			if path != "" {
+				return usageError(usage)
+			}
+			path = arg
+		}
+	}
+	if path == "" {
+		return usageError(usage)
+	}
+	return runScript(path, stopOnError)
+}
+
+// runScript executes every command of the script at path, reading stdin when path is `-`.
+// Failed commands are reported as they happen and summarized in the returned error.
+func runScript(path string, stopOnError bool) error {
+	if scriptDepth >= maxScriptDepth {
+		return fmt.Errorf("scripts are nested more than %d levels deep", maxScriptDepth)
+	}
+
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	lines, err := readScript(input)
+	if err != nil {
+		return err
+	}
+
+	scriptDepth++
+	defer func() { scriptDepth-- }()
+
+	result := &scriptError{path: path}
+	for _, line := range lines {
+		if sig := pendingSignal(); sig != nil {
+			return interruptedError{signal: sig}
+		}
+		args, err := parseArgs(line.text)
+		if err == nil && len(args) < 1 {
+			continue
+		}
+		result.total++
+		if err != nil {
+			reportError(err)
+		} else {
+			err = executeCommand(args[0], args[1:])
+		}
+		if err != nil {
+			result.failures = append(result.failures, scriptFailure{line: line.number, err: err})
+			if stopOnError {
+				break
+			}
+		}
+	}
+
+	if len(result.failures) > 0 {
+		return result
+	}
+	return nil
+}
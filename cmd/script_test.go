@@ -0,0 +1,143 @@
+// script_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+func writeScript(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "setup.vfs")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadScript(t *testing.T) {
+	script := "# setup\n\nregister user\n  create-folder user folder \\\n    \"folder description\"\n# done\nlist-folders user\n"
+	lines, err := readScript(strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []scriptLine{
+		{3, "register user"},
+		{4, "create-folder user folder \"folder description\""},
+		{7, "list-folders user"},
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("readScript() = %v; expected %v", lines, expected)
+	}
+}
+
+func TestRunScriptTrailingBackslash(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	path := writeScript(t, "register user\n\\\n   \n\\\n")
+	var code int
+	output := captureOutput(func() {
+		code = run([]string{"run", path})
+	})
+	if code != exitOK || output != "Add user successfully.\n" {
+		t.Errorf("expected the empty continuations to be skipped but got %d %q", code, output)
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	script := "register script\ncreate-folder nobody folder\ncreate-folder script folder\ncreate-folder script folder\nlist-folders script\n"
+
+	tests := []struct {
+		flag     string
+		code     int
+		expected string
+	}{
+		{
+			"--continue", exitNotFound,
+			"Add script successfully.\n" +
+				"Error: The nobody doesn't exist.\n" +
+				"Create folder successfully.\n" +
+				"Error: The folder has already existed.\n" +
+				"folder 2000-01-01 20:34:19 script\n" +
+				"Error: 2 of 5 commands in setup.vfs failed:\n" +
+				"  line 2: The nobody doesn't exist.\n" +
+				"  line 4: The folder has already existed.\n",
+		},
+		{
+			"--stop-on-error", exitNotFound,
+			"Add script successfully.\n" +
+				"Error: The nobody doesn't exist.\n" +
+				"Error: 1 of 2 commands in setup.vfs failed:\n" +
+				"  line 2: The nobody doesn't exist.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			internal.UseMockData(make(map[string]*internal.User))
+			path := writeScript(t, script)
+			var code int
+			output := captureOutput(func() {
+				code = run([]string{"run", tt.flag, path})
+			})
+			output = strings.ReplaceAll(output, path, "setup.vfs")
+			if code != tt.code {
+				t.Errorf("expected exit code %d but got %d", tt.code, code)
+			}
+			if !checkOutput(tt.expected, output) {
+				t.Errorf("expected: %q\nbut got: %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestRunScriptUsageError(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	path := writeScript(t, "delete-file script\nregister script\n")
+
+	var code int
+	output := captureOutput(func() {
+		code = run([]string{"run", "--continue", path})
+	})
+	output = strings.ReplaceAll(output, path, "setup.vfs")
+	expected := commandDeleteFile + "\n" +
+		"Add script successfully.\n" +
+		"Error: 1 of 2 commands in setup.vfs failed:\n" +
+		"  line 1: " + commandDeleteFile + "\n"
+	if code != exitUsage || !checkOutput(expected, output) {
+		t.Errorf("expected exit code %d and %q\nbut got %d and %q", exitUsage, expected, code, output)
+	}
+}
+
+func TestRunScriptErrors(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+
+	output := captureOutput(func() {
+		if code := run([]string{"run"}); code != exitUsage {
+			t.Errorf("expected exit code %d but got %d", exitUsage, code)
+		}
+	})
+	if !checkOutput(commandRun+"\n", output) {
+		t.Errorf("expected: %q\nbut got: %q", commandRun+"\n", output)
+	}
+
+	output = captureOutput(func() {
+		if code := run([]string{"run", filepath.Join(t.TempDir(), "missing.vfs")}); code != exitIO {
+			t.Errorf("expected exit code %d but got %d", exitIO, code)
+		}
+	})
+	if !strings.Contains(output, "no such file or directory") {
+		t.Errorf("expected a missing file error but got: %q", output)
+	}
+
+	path := filepath.Join(t.TempDir(), "loop.vfs")
+	os.WriteFile(path, []byte("source "+path+"\n"), 0644)
+	captureOutput(func() {
+		if code := run([]string{"run", "--stop-on-error", path}); code != exitFailure {
+			t.Errorf("expected exit code %d but got %d", exitFailure, code)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+// serve.go
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"virtual-file-system/internal"
+	"virtual-file-system/internal/admin"
+	"virtual-file-system/internal/auth"
+	"virtual-file-system/internal/eventstream"
+	"virtual-file-system/internal/httpapi"
+	"virtual-file-system/internal/limit"
+	"virtual-file-system/internal/metrics"
+	"virtual-file-system/internal/webdav"
+)
+
+var commandServe = "Usage: vfs serve [--addr host:port] [--ip-rate n] [--ip-burst n] [--user-rate n] [--user-burst n] [--max-body bytes] [--auth]"
+
+// shutdownTimeout is how long a server waits for the requests in progress when it stops
+const shutdownTimeout = 5 * time.Second
+
+// newServeMux routes the REST API, the WebDAV endpoint under /dav/, the event streams
+// of /events, which end when events is closed, the Prometheus metrics of /metrics, and the
+// health checks and admin endpoints of health. Everything but the metrics and the health
+// checks is subject to limits. With authenticate, the REST API, WebDAV and the event streams
+// require an API token, and the admin endpoints only answer local clients.
+// The limit per user applies to the user of the token with authenticate, and otherwise to the
+// user of the path from each client IP, so the UserOf of limits is ignored.
+func newServeMux(events *eventstream.Handler, health *admin.Handler, limits limit.Config, authenticate bool) *http.ServeMux {
+	mux := http.NewServeMux()
+	// Anybody may name any user in a path, so clients can only use up their own requests
+	limits.UserOf = func(r *http.Request) string {
+		if user := requestUser(r); user != "" {
+			return limit.ClientIP(r) + " " + user
+		}
+		return ""
+	}
+	limited := limit.Middleware(limits)
+	guarded, local := limited, limited
+	if authenticate {
+		// The users of the tokens are only charged once their token is checked, so nobody
+		// else can use up their requests. The client IPs are charged before.
+		byIP := limit.Middleware(limit.Config{IPRate: limits.IPRate, IPBurst: limits.IPBurst, MaxBodySize: limits.MaxBodySize})
+		byUser := limit.Middleware(limit.Config{UserRate: limits.UserRate, UserBurst: limits.UserBurst, UserOf: auth.User})
+		guarded = func(next http.Handler) http.Handler { return byIP(auth.Middleware(byUser(next))) }
+		local = func(next http.Handler) http.Handler { return byIP(auth.LoopbackOnly(next)) }
+	}
+	api := guarded(httpapi.NewHandler())
+	mux.Handle("/users", api)
+	mux.Handle("/users/", api)
+	dav := guarded(webdav.NewHandler("/dav"))
+	mux.Handle("/dav", dav)
+	mux.Handle("/dav/", dav)
+	mux.Handle("/events", guarded(events))
+	mux.Handle("/metrics", metrics.Default)
+	mux.Handle("/healthz", health)
+	mux.Handle("/readyz", health)
+	mux.Handle("/admin/", local(health))
+	return mux
+}
+
+// requestUser returns the user of /users/{u}/..., /dav/{u}/... and /events?user={u}, or ""
+func requestUser(r *http.Request) string {
+	user := r.URL.Query().Get("user")
+	segments := strings.SplitN(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/", 3)
+	if len(segments) >= 2 && (segments[0] == "users" || segments[0] == "dav") {
+		user, _ = url.PathUnescape(segments[1])
+	}
+	if caseInsensitive {
+		user = strings.ToLower(user)
+	}
+	return user
+}
+
+// serve runs the REST API, WebDAV, the event streams, the metrics and the admin endpoints until SIGINT or SIGTERM, then lets the requests in progress finish
+func serve(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	var limits limit.Config
+	flags.Float64Var(&limits.IPRate, "ip-rate", 20, "requests per second allowed per client IP, 0 for no limit")
+	flags.IntVar(&limits.IPBurst, "ip-burst", 40, "requests allowed at once per client IP")
+	flags.Float64Var(&limits.UserRate, "user-rate", 10, "requests per second allowed per user, per client IP without --auth, 0 for no limit")
+	flags.IntVar(&limits.UserBurst, "user-burst", 20, "requests allowed at once per user")
+	flags.Int64Var(&limits.MaxBodySize, "max-body", 1<<20, "size in bytes a request body may have, 0 for no limit")
+	authenticate := flags.Bool("auth", false, "require an API token, see create-token, and restrict the admin endpoints to local clients")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), commandServe)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() > 0 || limits.IPRate < 0 || limits.UserRate < 0 || limits.MaxBodySize < 0 {
+		fmt.Fprintln(os.Stderr, commandServe)
+		return exitUsage
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+	internal.CaseInsensitive = caseInsensitive
+	events := eventstream.NewHandler()
+	health := admin.NewHandler()
+	server := &http.Server{Handler: newServeMux(events, health, limits, *authenticate), ReadHeaderTimeout: 10 * time.Second}
+	// Streams never finish on their own, so they're ended for Shutdown to return
+	server.RegisterOnShutdown(events.Close)
+	// Readiness fails first so no more traffic is sent
+	server.RegisterOnShutdown(health.Close)
+	fmt.Fprintf(os.Stderr, "Serving the REST API on http://%s\n", listener.Addr())
+	fmt.Fprintf(os.Stderr, "Serving WebDAV on http://%s/dav/\n", listener.Addr())
+	fmt.Fprintf(os.Stderr, "Serving events on http://%s/events\n", listener.Addr())
+	fmt.Fprintf(os.Stderr, "Serving metrics on http://%s/metrics\n", listener.Addr())
+	fmt.Fprintf(os.Stderr, "Serving health checks on http://%s/healthz and /readyz, admin on /admin/\n", listener.Addr())
+	if *authenticate {
+		fmt.Fprintln(os.Stderr, "Requiring API tokens, admin endpoints answer local clients only")
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	case sig := <-signals:
+		fmt.Fprintf(os.Stderr, "Received %s, shutting down...\n", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,72 @@
+// serve9p.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"virtual-file-system/internal/ninep"
+)
+
+var commandServe9P = "Usage: vfs serve-9p [--addr host:port | --socket path]"
+
+// serve9P serves the tree over 9P2000 on TCP or a Unix socket until SIGINT or SIGTERM
+func serve9P(args []string) int {
+	flags := flag.NewFlagSet("serve-9p", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:5640", "TCP address to listen on")
+	socket := flags.String("socket", "", "path of a Unix socket to listen on instead of TCP")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), commandServe9P)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if flags.NArg() > 0 || (set["addr"] && set["socket"]) {
+		fmt.Fprintln(os.Stderr, commandServe9P)
+		return exitUsage
+	}
+
+	network, address := "tcp", *addr
+	if *socket != "" {
+		network, address = "unix", *socket
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+	server := ninep.NewServer()
+	fmt.Fprintf(os.Stderr, "Serving 9P2000 on %s!%s\n", network, listener.Addr())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	case sig := <-signals:
+		fmt.Fprintf(os.Stderr, "Received %s, shutting down...\n", sig)
+	}
+
+	// 9P sessions last as long as the mount, so they're hung up rather than drained
+	if err := server.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+	if err := <-served; !errors.Is(err, ninep.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+	return exitOK
+}
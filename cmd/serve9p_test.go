@@ -0,0 +1,58 @@
+// serve9p_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestServe9P(t *testing.T) {
+	original := signals
+	defer func() { signals = original }()
+
+	tests := []struct {
+		args   []string
+		prefix string
+	}{
+		{[]string{"--addr", "127.0.0.1:0"}, "Serving 9P2000 on tcp!127.0.0.1:"},
+		{[]string{"--socket", filepath.Join(t.TempDir(), "vfs.sock")}, "Serving 9P2000 on unix!"},
+	}
+
+	for _, tt := range tests {
+		signals = make(chan os.Signal, 1)
+		signals <- syscall.SIGTERM
+		var code int
+		output := captureOutput(func() {
+			code = serve9P(tt.args)
+		})
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		if code != exitOK || len(lines) != 2 || !strings.HasPrefix(lines[0], tt.prefix) || lines[1] != "Received terminated, shutting down..." {
+			t.Errorf("args: %v\nexpected the server to start and shut down but got %d %q", tt.args, code, output)
+		}
+	}
+}
+
+func TestServe9PErrors(t *testing.T) {
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"extra"}, exitUsage, commandServe9P + "\n"},
+		{[]string{"--addr", "localhost:0", "--socket", "vfs.sock"}, exitUsage, commandServe9P + "\n"},
+		{[]string{"--addr", "invalid address"}, exitFailure, "Error: listen tcp: address invalid address: missing port in address\n"},
+	}
+
+	for _, tt := range tests {
+		var code int
+		output := captureOutput(func() {
+			code = serve9P(tt.args)
+		})
+		if code != tt.code || output != tt.expected {
+			t.Errorf("args: %v\nexpected %d %q but got %d %q", tt.args, tt.code, tt.expected, code, output)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// serve_test.go
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"virtual-file-system/internal"
+	"virtual-file-system/internal/admin"
+	"virtual-file-system/internal/eventstream"
+	"virtual-file-system/internal/limit"
+)
+
+func TestServe(t *testing.T) {
+	original := signals
+	defer func() { signals = original }()
+	signals = make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+
+	var code int
+	output := captureOutput(func() {
+		code = serve([]string{"--addr", "127.0.0.1:0"})
+	})
+	if code != exitOK {
+		t.Errorf("expected exit code %d but got %d", exitOK, code)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 6 || !strings.HasPrefix(lines[0], "Serving the REST API on http://127.0.0.1:") || !strings.HasSuffix(lines[1], "/dav/") || !strings.HasSuffix(lines[2], "/events") || !strings.HasSuffix(lines[3], "/metrics") || !strings.HasSuffix(lines[4], "/admin/") || lines[5] != "Received terminated, shutting down..." {
+		t.Errorf("expected the server to start and shut down but got: %q", output)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"extra"}, exitUsage, commandServe + "\n"},
+		{[]string{"--user-rate", "-1"}, exitUsage, commandServe + "\n"},
+		{[]string{"--addr", "invalid address"}, exitFailure, "Error: listen tcp: address invalid address: missing port in address\n"},
+	}
+
+	for _, tt := range tests {
+		var code int
+		output := captureOutput(func() {
+			code = serve(tt.args)
+		})
+		if code != tt.code || output != tt.expected {
+			t.Errorf("args: %v\nexpected %d %q but got %d %q", tt.args, tt.code, tt.expected, code, output)
+		}
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	internal.RegisterUser("alice")
+	events := eventstream.NewHandler()
+	defer events.Close()
+	server := httptest.NewServer(newServeMux(events, admin.NewHandler(), limit.Config{}, false))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("expected the metrics but got %d %v", resp.StatusCode, resp.Header)
+	}
+	for _, line := range []string{"vfs_users 1\n", `vfs_operations_total{operation="register_user",outcome="ok"} `, "# TYPE vfs_operation_duration_seconds histogram\n"} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("expected %q in\n%s", line, body)
+		}
+	}
+}
+
+func TestServeHealth(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	events := eventstream.NewHandler()
+	defer events.Close()
+	server := httptest.NewServer(newServeMux(events, admin.NewHandler(), limit.Config{}, false))
+	defer server.Close()
+
+	for _, path := range []string{"/healthz", "/readyz", "/admin/runtime"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected 200 but got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestServeLimits(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	events := eventstream.NewHandler()
+	defer events.Close()
+	limits := limit.Config{UserRate: 0.001, UserBurst: 2, MaxBodySize: 64}
+	server := httptest.NewServer(newServeMux(events, admin.NewHandler(), limits, false))
+	defer server.Close()
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"POST", "/users", `{"username":"alice"}`, 201},
+		{"POST", "/users/Alice/folders", `{"name":"a"}`, 201},
+		{"POST", "/users/alice/folders", `{"name":"b"}`, 201},
+		{"GET", "/dav/alice/", "", 429},
+		{"GET", "/events?user=ALICE", "", 429},
+		{"GET", "/metrics", "", 200},
+		{"GET", "/healthz", "", 200},
+		{"POST", "/users", `{"username":"` + strings.Repeat("b", 64) + `"}`, 413},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: expected %d but got %d", tt.method, tt.path, tt.status, resp.StatusCode)
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "" {
+			t.Errorf("%s %s: expected a Retry-After header", tt.method, tt.path)
+		}
+	}
+}
+
+func TestServeLimitsPerClient(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	events := eventstream.NewHandler()
+	defer events.Close()
+	mux := newServeMux(events, admin.NewHandler(), limit.Config{UserRate: 0.001, UserBurst: 1}, false)
+
+	get := func(remoteAddr string) int {
+		req := httptest.NewRequest("GET", "/users/alice/folders", nil)
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	// Without tokens, a client using up the requests of alice leaves those of other clients
+	if status := get("10.0.0.1:1234"); status == http.StatusTooManyRequests {
+		t.Errorf("expected the first request to pass but got %d", status)
+	}
+	if status := get("10.0.0.1:1235"); status != http.StatusTooManyRequests {
+		t.Errorf("expected the second request of the client to be limited but got %d", status)
+	}
+	if status := get("10.0.0.2:1234"); status == http.StatusTooManyRequests {
+		t.Errorf("expected the request of another client to pass but got %d", status)
+	}
+}
+
+func TestRequestUser(t *testing.T) {
+	tests := map[string]string{
+		"/users":                      "",
+		"/users/Alice":                "alice",
+		"/users/folder%20A/folders/x": "folder a",
+		"/dav/bob/docs/notes":         "bob",
+		"/events?user=Carol&folder=x": "carol",
+		"/admin/save":                 "",
+		"/usersx/alice":               "",
+	}
+	for path, expected := range tests {
+		if user := requestUser(httptest.NewRequest("GET", path, nil)); user != expected {
+			t.Errorf("%s: expected %q but got %q", path, expected, user)
+		}
+	}
+}
+
+func TestServeAuth(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	internal.RegisterUser("alice")
+	internal.RegisterUser("bob")
+	internal.CreateFolder("alice", "docs", "")
+	write, _, _ := internal.CreateToken("alice", internal.ScopeWrite, "", 0)
+	read, _, _ := internal.CreateToken("alice", internal.ScopeRead, "docs", 0)
+	events := eventstream.NewHandler()
+	defer events.Close()
+	server := httptest.NewServer(newServeMux(events, admin.NewHandler(), limit.Config{}, true))
+	defer server.Close()
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"GET", "/users/alice/folders", "", 401},
+		{"GET", "/users/alice/folders", "vfs_0_0", 401},
+		{"GET", "/users/alice/folders", write, 200},
+		{"GET", "/users/bob/folders", write, 403},
+		{"POST", "/users/alice/folders", write, 201},
+		{"GET", "/users/alice/folders", read, 403},
+		{"GET", "/users/alice/folders/docs/files", read, 200},
+		{"POST", "/users/alice/folders/docs/files", read, 403},
+		{"GET", "/metrics", "", 200},
+		{"GET", "/healthz", "", 200},
+		{"GET", "/admin/runtime", "", 200},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(`{"name":"tmp"}`))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: expected %d but got %d", tt.method, tt.path, tt.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestServeAuthLimitsAuthenticatedUsers(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	internal.RegisterUser("alice")
+	token, _, _ := internal.CreateToken("alice", internal.ScopeRead, "", 0)
+	events := eventstream.NewHandler()
+	defer events.Close()
+	limits := limit.Config{UserRate: 0.001, UserBurst: 1}
+	server := httptest.NewServer(newServeMux(events, admin.NewHandler(), limits, true))
+	defer server.Close()
+
+	get := func(token string) int {
+		req, _ := http.NewRequest("GET", server.URL+"/users/alice/folders", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Requests without a valid token don't use up the requests of alice
+	for _, bogus := range []string{"", "", "vfs_0_0"} {
+		if status := get(bogus); status != http.StatusUnauthorized {
+			t.Errorf("expected 401 but got %d", status)
+		}
+	}
+	if status := get(token); status != http.StatusOK {
+		t.Errorf("expected the first request of alice to succeed but got %d", status)
+	}
+	if status := get(token); status != http.StatusTooManyRequests {
+		t.Errorf("expected the second request of alice to be limited but got %d", status)
+	}
+}
@@ -0,0 +1,64 @@
+// serveftp.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"virtual-file-system/internal/ftp"
+)
+
+var commandServeFTP = "Usage: vfs serve-ftp [--addr host:port]"
+
+// serveFTP serves the folders and files of the users over FTP until SIGINT or SIGTERM
+func serveFTP(args []string) int {
+	flags := flag.NewFlagSet("serve-ftp", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:2121", "address of the control connection")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), commandServeFTP)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, commandServeFTP)
+		return exitUsage
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+	server := ftp.NewServer()
+	fmt.Fprintf(os.Stderr, "Serving FTP on ftp://%s\n", listener.Addr())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	case sig := <-signals:
+		fmt.Fprintf(os.Stderr, "Received %s, shutting down...\n", sig)
+	}
+
+	if err := server.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+	if err := <-served; !errors.Is(err, ftp.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,46 @@
+// serveftp_test.go
+package main
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestServeFTP(t *testing.T) {
+	original := signals
+	defer func() { signals = original }()
+	signals = make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+
+	var code int
+	output := captureOutput(func() {
+		code = serveFTP([]string{"--addr", "127.0.0.1:0"})
+	})
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if code != exitOK || len(lines) != 2 || !strings.HasPrefix(lines[0], "Serving FTP on ftp://127.0.0.1:") || lines[1] != "Received terminated, shutting down..." {
+		t.Errorf("expected the server to start and shut down but got %d %q", code, output)
+	}
+}
+
+func TestServeFTPErrors(t *testing.T) {
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"extra"}, exitUsage, commandServeFTP + "\n"},
+		{[]string{"--addr", "invalid address"}, exitFailure, "Error: listen tcp: address invalid address: missing port in address\n"},
+	}
+
+	for _, tt := range tests {
+		var code int
+		output := captureOutput(func() {
+			code = serveFTP(tt.args)
+		})
+		if code != tt.code || output != tt.expected {
+			t.Errorf("args: %v\nexpected %d %q but got %d %q", tt.args, tt.code, tt.expected, code, output)
+		}
+	}
+}
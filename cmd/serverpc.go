@@ -0,0 +1,104 @@
+// serverpc.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"virtual-file-system/internal/jsonrpc"
+)
+
+var commandServeRPC = "Usage: vfs serve-rpc [--socket path] [--max-batch n]"
+
+// defaultSocket is $XDG_RUNTIME_DIR/vfs.sock, or a per-user socket in the temp dir
+func defaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "vfs.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("vfs-%d.sock", os.Getuid()))
+}
+
+// listenUnix listens on the socket at path, replacing a socket left behind by a daemon
+// that is gone. Only the owner may connect.
+func listenUnix(path string) (net.Listener, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		info, statErr := os.Lstat(path)
+		if statErr != nil || info.Mode()&os.ModeSocket == 0 {
+			return nil, err
+		}
+		if conn, dialErr := net.Dial("unix", path); dialErr == nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+		if listener, err = net.Listen("unix", path); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// serveRPC serves the operations as JSON-RPC 2.0 methods on a Unix socket until SIGINT or SIGTERM
+func serveRPC(args []string) int {
+	flags := flag.NewFlagSet("serve-rpc", flag.ContinueOnError)
+	socket := flags.String("socket", defaultSocket(), "path of the Unix socket to listen on")
+	maxBatch := flags.Int("max-batch", 100, "requests a batch may have, 0 for no limit")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), commandServeRPC)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() > 0 || *maxBatch < 0 {
+		fmt.Fprintln(os.Stderr, commandServeRPC)
+		return exitUsage
+	}
+
+	listener, err := listenUnix(*socket)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+	// Closing removes the socket, even when Serve never got to the listener
+	defer listener.Close()
+	server := jsonrpc.NewServer()
+	server.MaxBatch = *maxBatch
+	fmt.Fprintf(os.Stderr, "Serving JSON-RPC on unix!%s\n", listener.Addr())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	case sig := <-signals:
+		fmt.Fprintf(os.Stderr, "Received %s, shutting down...\n", sig)
+	}
+
+	if err := server.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+	if err := <-served; !errors.Is(err, jsonrpc.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,168 @@
+// serverpc_test.go
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"testing"
+	"virtual-file-system/internal"
+	"virtual-file-system/internal/jsonrpc"
+)
+
+func TestServeRPC(t *testing.T) {
+	original := signals
+	defer func() { signals = original }()
+
+	socket := filepath.Join(t.TempDir(), "vfs.sock")
+	// A socket left behind by a daemon that is gone is replaced
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix sockets are unavailable:", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	signals = make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+	var code int
+	output := captureOutput(func() {
+		code = serveRPC([]string{"--socket", socket})
+	})
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if code != exitOK || len(lines) != 2 || lines[0] != "Serving JSON-RPC on unix!"+socket || lines[1] != "Received terminated, shutting down..." {
+		t.Errorf("expected the server to start and shut down but got %d %q", code, output)
+	}
+	if _, err := os.Lstat(socket); err == nil {
+		t.Errorf("expected the socket to be removed on shutdown")
+	}
+}
+
+func TestServeRPCErrors(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "vfs.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix sockets are unavailable:", err)
+	}
+	defer listener.Close()
+
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"extra"}, exitUsage, commandServeRPC + "\n"},
+		{[]string{"--max-batch", "-1"}, exitUsage, commandServeRPC + "\n"},
+		{[]string{"--socket", socket}, exitFailure, "Error: listen unix " + socket + ": bind: address already in use\n"},
+	}
+
+	for _, tt := range tests {
+		var code int
+		output := captureOutput(func() {
+			code = serveRPC(tt.args)
+		})
+		if code != tt.code || output != tt.expected {
+			t.Errorf("args: %v\nexpected %d %q but got %d %q", tt.args, tt.code, tt.expected, code, output)
+		}
+	}
+}
+
+func TestListenUnixMode(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "vfs.sock")
+	listener, err := listenUnix(socket)
+	if err != nil {
+		t.Skip("unix sockets are unavailable:", err)
+	}
+	defer listener.Close()
+	if info, err := os.Lstat(socket); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the socket to be private but got %v, %v", info.Mode(), err)
+	}
+}
+
+func TestRunConnect(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	socket := filepath.Join(t.TempDir(), "vfs.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix sockets are unavailable:", err)
+	}
+	server := jsonrpc.NewServer()
+	go server.Serve(listener)
+	defer server.Close()
+	missing := filepath.Join(t.TempDir(), "none.sock")
+
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"--connect", socket, "register", "remote"}, 0, "Add remote successfully.\n"},
+		{[]string{"--connect", socket, "create-folder", "remote", "docs", "desc"}, 0, "Create docs successfully.\n"},
+		{[]string{"--connect", socket, "list-folders", "remote"}, 0, "docs desc 2000-01-01 20:34:19 remote\n"},
+		{[]string{"--connect", socket, "register", "remote"}, 4, "Error: The remote has already existed.\n"},
+		{[]string{"--connect", socket, "delete-folder", "nobody", "docs"}, 3, "Error: The nobody doesn't exist.\n"},
+		{[]string{"--connect", socket, "list-folders", "remote", "--sort", "size"}, 2, "Error: Unknown sort field size, expected one of name,created,description\n"},
+		{[]string{"--connect", socket, "--data", "data.json", "list-folders", "remote"}, 2, "Error: --connect can't be combined with --data or a serve command\n"},
+		{[]string{"--connect", socket, "serve"}, 2, "Error: --connect can't be combined with --data or a serve command\n"},
+		{[]string{"--connect", missing, "list-folders", "remote"}, 6, "Error: cannot connect to the daemon: dial unix " + missing + ": connect: no such file or directory\n"},
+	}
+
+	for _, tt := range tests {
+		var code int
+		output := captureOutput(func() {
+			code = run(tt.args)
+		})
+		if code != tt.code || !checkOutput(tt.expected, output) {
+			t.Errorf("args: %v\nexpected %d %q but got %d %q", tt.args, tt.code, tt.expected, code, output)
+		}
+	}
+
+	// The commands ran in the daemon
+	if _, err := internal.GetFolder("remote", "docs"); err != nil {
+		t.Errorf("expected the daemon to have remote/docs but got %v", err)
+	}
+}
+
+func TestRunConnectTokens(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	internal.RegisterUser("remote")
+	socket := filepath.Join(t.TempDir(), "vfs.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix sockets are unavailable:", err)
+	}
+	server := jsonrpc.NewServer()
+	go server.Serve(listener)
+	defer server.Close()
+
+	output := captureOutput(func() {
+		run([]string{"--connect", socket, "create-token", "remote", "--scope", "write", "--expires", "30d"})
+	})
+	match := regexp.MustCompile(`^Create token ([0-9a-f]{16}) for remote successfully, the token is (vfs_\S+)\.\n$`).FindStringSubmatch(output)
+	if match == nil {
+		t.Fatalf("unexpected output %q", output)
+	}
+	// The daemon keeps the token through its next save
+	captureOutput(func() {
+		run([]string{"--connect", socket, "create-folder", "remote", "docs"})
+	})
+	if username, token, err := internal.Authenticate(match[2]); err != nil || username != "remote" || token.ID != match[1] || token.Scope != internal.ScopeWrite || token.ExpiresAt.IsZero() {
+		t.Fatalf("expected the daemon to have the write token of remote but got %s %+v %v", username, token, err)
+	}
+
+	output = captureOutput(func() {
+		run([]string{"--connect", socket, "--output", "csv", "list-tokens", "remote"})
+	})
+	if !strings.HasPrefix(output, "id,scope,folder,created_at,expires_at\n"+match[1]+",write,,") {
+		t.Errorf("unexpected tokens %q", output)
+	}
+	output = captureOutput(func() {
+		run([]string{"--connect", socket, "revoke-token", "remote", match[1]})
+	})
+	if _, _, err := internal.Authenticate(match[2]); output != "Revoke token "+match[1]+" of remote successfully.\n" || err == nil {
+		t.Errorf("expected the daemon to revoke the token but got %q, %v", output, err)
+	}
+}
@@ -0,0 +1,157 @@
+// session.go
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var commandUse = "Usage: use [username]?"
+var commandCd = "Usage: cd [foldername|..]?"
+
+// session is the current user and working folder set with `use` and `cd`.
+// Commands can leave out their leading [username] and [foldername] arguments to use them.
+var session struct {
+	user   string
+	folder string
+}
+
+// contextArgs describes the leading arguments a command can take from the session:
+// min and max are the numbers of positional arguments it takes, more than min when it takes
+// an optional description, and count how many of the leading ones, in the order
+// [username] [foldername], may come from the session.
+var contextArgs = map[string]struct{ min, max, count int }{
+	"create-folder": {2, 3, 1},
+	"create-file":   {3, 4, 2},
+	"list-folders":  {1, 1, 1},
+	"list-files":    {2, 2, 2},
+	"delete-folder": {2, 2, 1},
+	"delete-file":   {3, 3, 2},
+	"rename-folder": {3, 3, 1},
+	"create-token":  {1, 1, 1},
+	"list-tokens":   {1, 1, 1},
+	"revoke-token":  {2, 2, 1},
+}
+
+// sessionPrompt returns the REPL prompt showing the session context
+func sessionPrompt() string {
+	switch {
+	case session.folder != "":
+		return quoteIfNeeded(session.user) + "/" + quoteIfNeeded(session.folder) + "# "
+	case session.user != "":
+		return quoteIfNeeded(session.user) + "# "
+	}
+	return "# "
+}
+
+// withSessionContext prepends the session user and folder to args when the command was
+// given fewer positional arguments than it requires. Fully-qualified commands are left as they are.
+// With an optional description, the arguments may be read with more or fewer of them left
+// out, e.g. `create-file x desc` in a folder; the first reading whose user, and folder, exist wins.
+func withSessionContext(command string, args []string) []string {
+	spec, ok := contextArgs[command]
+	if !ok {
+		return args
+	}
+
+	var readings [][]string
+	for missing := 0; missing <= spec.count; missing++ {
+		if n := len(args) + missing; n < spec.min || n > spec.max {
+			continue
+		}
+		context := []string{session.user, session.folder}[:missing]
+		if slices.Contains(context, "") {
+			continue
+		}
+		readings = append(readings, append(context, args...))
+	}
+	switch len(readings) {
+	case 0:
+		return args
+	case 1:
+		return readings[0]
+	}
+	for _, reading := range readings {
+		if contextExists(reading[:spec.count]) {
+			return reading
+		}
+	}
+	return readings[0]
+}
+
+// contextExists reports whether the leading [username] and [foldername] of a reading exist
+func contextExists(names []string) bool {
+	names = slices.Clone(names)
+	if caseInsensitive {
+		for i := range names {
+			names[i] = strings.ToLower(names[i])
+		}
+	}
+	var err error
+	if len(names) == 1 {
+		_, err = listFolders(names[0], "name", "asc")
+	} else {
+		_, err = listFiles(names[0], names[1], "name", "asc")
+	}
+	return err == nil
+}
+
+// handleUse executes `use`, which sets the session user or clears the session without arguments
+func handleUse(args []string) error {
+	if len(args) > 1 {
+		return usageError(commandUse)
+	}
+	if len(args) == 0 {
+		session.user = ""
+		session.folder = ""
+		printMessage("Clear the current user.")
+		return nil
+	}
+
+	username := args[0]
+	if caseInsensitive {
+		username = strings.ToLower(username)
+	}
+	if _, err := listFolders(username, "name", "asc"); err != nil {
+		return err
+	}
+	session.user = username
+	session.folder = ""
+	printMessage(fmt.Sprintf("Use %s.", quoteIfNeeded(username)))
+	return nil
+}
+
+// handleCd executes `cd`, which sets the working folder of the session user.
+// `cd ..` or `cd` without arguments leaves the working folder.
+func handleCd(args []string) error {
+	if len(args) > 1 {
+		return usageError(commandCd)
+	}
+	if session.user == "" {
+		return usageError("No current user, run `use [username]` first")
+	}
+	if len(args) == 0 || args[0] == ".." || args[0] == "/" {
+		session.folder = ""
+		printMessage(fmt.Sprintf("Leave the folder of %s.", quoteIfNeeded(session.user)))
+		return nil
+	}
+
+	foldername := args[0]
+	if caseInsensitive {
+		foldername = strings.ToLower(foldername)
+	}
+	if _, err := listFiles(session.user, foldername, "name", "asc"); err != nil {
+		return err
+	}
+	session.folder = foldername
+	printMessage(fmt.Sprintf("Change folder to %s.", quoteIfNeeded(foldername)))
+	return nil
+}
+
+// followRename keeps the working folder when it's renamed or deleted
+func followRename(username, foldername, newFolderName string) {
+	if session.user == username && session.folder == foldername {
+		session.folder = newFolderName
+	}
+}
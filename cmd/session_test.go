@@ -0,0 +1,64 @@
+// session_test.go
+package main
+
+import (
+	"testing"
+	"virtual-file-system/internal"
+)
+
+func TestSessionContext(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	defer func() { session.user, session.folder = "", "" }()
+
+	tests := []struct {
+		command  string
+		args     []string
+		expected string
+		prompt   string
+	}{
+		{"register", []string{"user"}, "Add user successfully.\n", "# "},
+		{"register", []string{"other"}, "Add other successfully.\n", "# "},
+		{"cd", []string{"folder"}, "No current user, run `use [username]` first\n", "# "},
+		{"use", []string{"nobody"}, "Error: The nobody doesn't exist.\n", "# "},
+		{"use", []string{"User"}, "Use user.\n", "user# "},
+		{"create-folder", []string{"folder a"}, "Create \"folder a\" successfully.\n", "user# "},
+		{"create-folder", []string{"other", "folder b", "description"}, "Create \"folder b\" successfully.\n", "user# "},
+		{"list-folders", []string{}, "\"folder a\" 2000-01-01 20:34:19 user\n", "user# "},
+		{"list-folders", []string{"--sort-name", "desc"}, "\"folder a\" 2000-01-01 20:34:19 user\n", "user# "},
+		{"list-folders", []string{"other"}, "\"folder b\" description 2000-01-01 20:34:19 other\n", "user# "},
+		{"cd", []string{"nothing"}, "Error: The nothing doesn't exist.\n", "user# "},
+		{"cd", []string{"Folder A"}, "Change folder to \"folder a\".\n", "user/\"folder a\"# "},
+		{"create-file", []string{"file"}, "Create file in user/\"folder a\" successfully.\n", "user/\"folder a\"# "},
+		{"create-file", []string{"user", "folder a", "described", "description"}, "Create described in user/\"folder a\" successfully.\n", "user/\"folder a\"# "},
+		{"list-files", []string{"--sort-name", "desc"}, "file 2000-01-01 20:34:19 \"folder a\" user\ndescribed description 2000-01-01 20:34:19 \"folder a\" user\n", "user/\"folder a\"# "},
+		{"delete-file", []string{"described"}, "Delete described in user/\"folder a\" successfully.\n", "user/\"folder a\"# "},
+		{"create-file", []string{"x", "desc"}, "Create x in user/\"folder a\" successfully.\n", "user/\"folder a\"# "},
+		{"create-file", []string{"Folder A", "y"}, "Create y in user/\"folder a\" successfully.\n", "user/\"folder a\"# "},
+		{"list-files", []string{"--name", "[xy]"}, "x desc 2000-01-01 20:34:19 \"folder a\" user\ny 2000-01-01 20:34:19 \"folder a\" user\n", "user/\"folder a\"# "},
+		{"delete-file", []string{"x"}, "Delete x in user/\"folder a\" successfully.\n", "user/\"folder a\"# "},
+		{"delete-file", []string{"y"}, "Delete y in user/\"folder a\" successfully.\n", "user/\"folder a\"# "},
+		{"rename-folder", []string{"folder a", "folder c"}, "Rename \"folder a\" to \"folder c\" successfully.\n", "user/\"folder c\"# "},
+		{"list-files", []string{}, "file 2000-01-01 20:34:19 \"folder c\" user\n", "user/\"folder c\"# "},
+		{"cd", []string{".."}, "Leave the folder of user.\n", "user# "},
+		{"list-files", []string{}, "Usage: list-files [username] [foldername] [--sort field[:asc|desc],...]? [--order asc|desc]? [--reverse]? [filters]? [--offset n]? [--limit n]?\n", "user# "},
+		{"cd", []string{"folder c"}, "Change folder to \"folder c\".\n", "user/\"folder c\"# "},
+		{"delete-folder", []string{"folder c"}, "Delete \"folder c\" successfully.\n", "user# "},
+		{"create-folder", []string{"folder d", "described"}, "Create \"folder d\" successfully.\n", "user# "},
+		{"list-folders", []string{}, "\"folder d\" described 2000-01-01 20:34:19 user\n", "user# "},
+		{"delete-folder", []string{"folder d"}, "Delete \"folder d\" successfully.\n", "user# "},
+		{"use", []string{}, "Clear the current user.\n", "# "},
+		{"list-folders", []string{}, "Usage: list-folders [username] [--sort field[:asc|desc],...]? [--order asc|desc]? [--reverse]? [filters]? [--offset n]? [--limit n]?\n", "# "},
+	}
+
+	for _, tt := range tests {
+		output := captureOutput(func() {
+			executeCommand(tt.command, tt.args)
+		})
+		if !checkOutput(tt.expected, output) {
+			t.Errorf("command: %v, args: %v\nexpected: %q\nbut got: %q", tt.command, tt.args, tt.expected, output)
+		}
+		if prompt := sessionPrompt(); prompt != tt.prompt {
+			t.Errorf("command: %v, args: %v\nexpected prompt %q but got %q", tt.command, tt.args, tt.prompt, prompt)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// signal.go
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// signals receives SIGINT and SIGTERM while run is executing.
+// The REPL waits on it between commands and scripts poll it between lines.
+var signals = make(chan os.Signal, 1)
+
+// interruptedError reports a signal that stopped a script
+type interruptedError struct {
+	signal os.Signal
+}
+
+func (e interruptedError) Error() string {
+	return "interrupted by " + e.signal.String()
+}
+
+// signalExitCode follows the shell convention of 128 plus the signal number
+func signalExitCode(sig os.Signal) int {
+	if sig == syscall.SIGTERM {
+		return 128 + 15
+	}
+	return 128 + 2
+}
+
+// pendingSignal returns a signal received since the last check, if any
+func pendingSignal() os.Signal {
+	select {
+	case sig := <-signals:
+		return sig
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+// table.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// columnGap separates the columns of a table
+const columnGap = "  "
+
+// minTruncatedWidth is the narrowest a truncated column can become
+const minTruncatedWidth = 8
+
+// selectColumns returns the columns called names, looked up in defaults and extras,
+// or defaults when no names are given.
+func selectColumns(defaults, extras []column, names []string) ([]column, error) {
+	if names == nil {
+		return defaults, nil
+	}
+
+	available := append(append([]column{}, defaults...), extras...)
+	columns := make([]column, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, c := range available {
+			if c.name == name {
+				columns = append(columns, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			valid := make([]string, len(available))
+			for i, c := range available {
+				valid[i] = c.name
+			}
+			return nil, usageError(fmt.Sprintf("Unknown column %s, expected one of %s", quoteIfNeeded(name), strings.Join(valid, ",")))
+		}
+	}
+	return columns, nil
+}
+
+// tableWidth returns the width tables are fitted into, taken from $COLUMNS or the terminal
+// stdout is connected to. 0 means tables are never truncated.
+func tableWidth() int {
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width >= 0 {
+		return width
+	}
+	return terminalWidth(os.Stdout.Fd())
+}
+
+// fitWidths shrinks the widest truncatable columns until the table fits into width
+func fitWidths(columns []column, widths []int, width int) {
+	if width <= 0 {
+		return
+	}
+	total := len(columnGap) * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+
+	for total > width {
+		widest := -1
+		for i, c := range columns {
+			if c.truncate && widths[i] > minTruncatedWidth && (widest < 0 || widths[i] > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+// truncate shortens s to width runes, marking the cut with an ellipsis
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+// pad aligns s within width runes
+func pad(s string, width int, right bool) string {
+	padding := strings.Repeat(" ", width-utf8.RuneCountInString(s))
+	if right {
+		return padding + s
+	}
+	return s + padding
+}
+
+// renderTable writes rows under a header of column titles, aligning every column and
+// truncating the text columns when the table is wider than width.
+func renderTable(w io.Writer, columns []column, rows [][]string, width int) {
+	widths := make([]int, len(columns))
+	for i, c := range columns {
+		widths[i] = utf8.RuneCountInString(c.title)
+		for _, row := range rows {
+			if n := utf8.RuneCountInString(row[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	fitWidths(columns, widths, width)
+
+	writeRow := func(values []string) {
+		cells := make([]string, len(values))
+		for i, value := range values {
+			cells[i] = pad(truncate(value, widths[i]), widths[i], columns[i].numeric)
+		}
+		fmt.Fprintln(w, strings.TrimRight(strings.Join(cells, columnGap), " "))
+	}
+
+	titles := make([]string, len(columns))
+	for i, c := range columns {
+		titles[i] = c.title
+	}
+	writeRow(titles)
+	for _, row := range rows {
+		writeRow(row)
+	}
+}
@@ -0,0 +1,118 @@
+// table_test.go
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+func TestRenderTable(t *testing.T) {
+	columns := []column{columnName, columnDescription, columnDescriptionLength}
+	rows := [][]string{
+		{"folder a", "a rather long description that doesn't fit", "43"},
+		{"b", "", "0"},
+	}
+
+	tests := []struct {
+		width    int
+		expected string
+	}{
+		{
+			0,
+			"NAME      DESCRIPTION                                 DESC LEN\n" +
+				"folder a  a rather long description that doesn't fit        43\n" +
+				"b                                                            0\n",
+		},
+		{
+			40,
+			"NAME      DESCRIPTION           DESC LEN\n" +
+				"folder a  a rather long descr…        43\n" +
+				"b                                      0\n",
+		},
+		{
+			10,
+			"NAME      DESCRIP…  DESC LEN\n" +
+				"folder a  a rathe…        43\n" +
+				"b                          0\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		renderTable(&buf, columns, rows, tt.width)
+		if buf.String() != tt.expected {
+			t.Errorf("renderTable(width %d)\nexpected:\n%s\nbut got:\n%s", tt.width, tt.expected, buf.String())
+		}
+	}
+}
+
+func TestSelectColumns(t *testing.T) {
+	columns, err := selectColumns(folderColumns, folderExtraColumns, []string{"desc-len", "name"})
+	if err != nil || len(columns) != 2 || columns[0].name != "desc-len" || columns[1].name != "name" {
+		t.Errorf("selectColumns(desc-len,name) = %v, %v", columns, err)
+	}
+
+	_, err = selectColumns(folderColumns, folderExtraColumns, []string{"folder"})
+	expected := "Unknown column folder, expected one of name,description,created,user,desc-len"
+	if err == nil || err.Error() != expected {
+		t.Errorf("selectColumns(folder) = %v; expected %v", err, expected)
+	}
+}
+
+func TestColumnsOption(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	captureOutput(func() {
+		run([]string{"register", "columns"})
+		run([]string{"create-folder", "columns", "folder", "folder description"})
+		run([]string{"create-file", "columns", "folder", "file"})
+	})
+
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{
+			[]string{"--columns", "name,created,description", "list-folders", "columns"},
+			exitOK,
+			"NAME    CREATED              DESCRIPTION\nfolder  2000-01-01 20:34:19  folder description\n",
+		},
+		{
+			[]string{"list-files", "columns", "folder", "--columns=user,folder,name,desc-len"},
+			exitOK,
+			"USER     FOLDER  NAME  DESC LEN\ncolumns  folder  file         0\n",
+		},
+		{
+			[]string{"--output", "json", "list-folders", "columns", "--columns", "name,desc-len"},
+			exitOK,
+			"[{\"name\":\"folder\",\"description_length\":18}]\n",
+		},
+		{
+			[]string{"list-folders", "columns", "--columns", "name,,user"},
+			exitUsage,
+			optionColumns + "\n",
+		},
+		{
+			[]string{"list-folders", "columns", "--columns", "size"},
+			exitUsage,
+			"Unknown column size, expected one of name,description,created,user,desc-len\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			var code int
+			output := captureOutput(func() {
+				code = run(tt.args)
+			})
+			if code != tt.code {
+				t.Errorf("expected exit code %d but got %d", tt.code, code)
+			}
+			if normalizeTimes(output) != tt.expected {
+				t.Errorf("args: %v\nexpected: %q\nbut got: %q", tt.args, tt.expected, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+// term_linux.go
+package main
+
+import "syscall"
+
+const ioctlGetTermios = syscall.TCGETS
+const ioctlSetTermios = syscall.TCSETS
@@ -0,0 +1,29 @@
+// term_other.go
+
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+import "errors"
+
+// terminalState is the terminal configuration restored after raw mode
+type terminalState struct{}
+
+// isTerminal reports whether fd refers to a terminal.
+// Raw mode isn't supported on this platform, so the REPL reads plain lines.
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (*terminalState, error) {
+	return nil, errors.New("raw terminal mode isn't supported on this platform")
+}
+
+func restoreTerminal(fd uintptr, state *terminalState) error {
+	return nil
+}
+
+// terminalWidth returns the number of columns of the terminal, or 0 if unknown
+func terminalWidth(fd uintptr) int {
+	return 0
+}
@@ -0,0 +1,169 @@
+// tokens.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"virtual-file-system/internal"
+)
+
+var commandCreateToken = "Usage: create-token [username] [--scope read|write]? [--folder foldername]? [--expires 30d]?"
+var commandListTokens = "Usage: list-tokens [username]"
+var commandRevokeToken = "Usage: revoke-token [username] [id]"
+
+// parseExpiry parses the --expires of create-token, a duration like 12h or a number of days like 30d
+func parseExpiry(s string) (time.Duration, error) {
+	var ttl time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		ttl = time.Duration(n) * 24 * time.Hour
+	} else {
+		ttl, err = time.ParseDuration(s)
+	}
+	if err != nil || ttl <= 0 {
+		return 0, usageError(fmt.Sprintf("Invalid expiry %s, expected a duration like 30d or 12h", quoteIfNeeded(s)))
+	}
+	return ttl, nil
+}
+
+// handleTokenCommand executes create-token, list-tokens and revoke-token. With --connect, they
+// run in the daemon, which keeps the tokens with the users it saves.
+func handleTokenCommand(command string, args []string, options map[string]string) error {
+	switch command {
+	case "create-token":
+		if len(args) != 1 {
+			return usageError(commandCreateToken)
+		}
+		username := args[0]
+		foldername := options["--folder"]
+		if caseInsensitive {
+			username = strings.ToLower(username)
+			foldername = strings.ToLower(foldername)
+		}
+		scope := internal.ScopeRead
+		if s, ok := options["--scope"]; ok {
+			var err error
+			if scope, err = internal.ParseScope(s); err != nil {
+				return usageError(err.Error())
+			}
+		}
+		var ttl time.Duration
+		if s, ok := options["--expires"]; ok {
+			var err error
+			if ttl, err = parseExpiry(s); err != nil {
+				return err
+			}
+		}
+		secret, token, err := createToken(username, scope, foldername, ttl)
+		if err != nil {
+			return err
+		}
+		printMessage(fmt.Sprintf("Create token %s for %s successfully, the token is %s.", token.ID, quoteIfNeeded(username), secret))
+	case "list-tokens":
+		if len(args) != 1 {
+			return usageError(commandListTokens)
+		}
+		username := args[0]
+		if caseInsensitive {
+			username = strings.ToLower(username)
+		}
+		return printTokens(username)
+	case "revoke-token":
+		if len(args) != 2 {
+			return usageError(commandRevokeToken)
+		}
+		username := args[0]
+		if caseInsensitive {
+			username = strings.ToLower(username)
+		}
+		if err := revokeToken(username, args[1]); err != nil {
+			return err
+		}
+		printMessage(fmt.Sprintf("Revoke token %s of %s successfully.", args[1], quoteIfNeeded(username)))
+	}
+	return nil
+}
+
+// Columns of list-tokens
+var tokenColumns = []column{
+	{name: "id", key: "id", title: "ID"},
+	{name: "scope", key: "scope", title: "SCOPE"},
+	{name: "folder", key: "folder", title: "FOLDER", truncate: true},
+	{name: "created", key: "created_at", title: "CREATED"},
+	{name: "expires", key: "expires_at", title: "EXPIRES"},
+}
+
+// printTokens prints the tokens of username, without their secrets. A token of every folder is
+// printed with the folder * and one that doesn't expire with never in the plain and table formats.
+func printTokens(username string) error {
+	tokens, err := listTokens(username)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, len(tokens))
+	for i, t := range tokens {
+		expires := ""
+		if !t.ExpiresAt.IsZero() {
+			expires = formatTime(t.ExpiresAt)
+		}
+		rows[i] = []string{t.ID, string(t.Scope), t.Folder, formatTime(t.CreatedAt), expires}
+	}
+
+	if len(rows) == 0 {
+		printWarning("There are no tokens.")
+		if outputFormat == formatPlain || outputFormat == formatTable {
+			return nil
+		}
+	}
+
+	switch outputFormat {
+	case formatJSON:
+		keys := make([]string, len(tokenColumns))
+		for i, c := range tokenColumns {
+			keys[i] = c.key
+		}
+		lines := make([]string, len(rows))
+		for i, row := range rows {
+			values := make([]string, len(row))
+			for j, value := range row {
+				values[j] = jsonString(value)
+			}
+			if row[4] == "" {
+				values[4] = "null"
+			}
+			lines[i] = jsonObject(keys, values)
+		}
+		fmt.Println("[" + strings.Join(lines, ",") + "]")
+	case formatCSV:
+		header := make([]string, len(tokenColumns))
+		for i, c := range tokenColumns {
+			header[i] = c.key
+		}
+		writeCSV(os.Stdout, append([][]string{header}, rows...))
+	default:
+		for _, row := range rows {
+			if row[2] == "" {
+				row[2] = "*"
+			}
+			if row[4] == "" {
+				row[4] = "never"
+			}
+		}
+		if outputFormat == formatTable {
+			renderTable(os.Stdout, tokenColumns, rows, tableWidth())
+			return nil
+		}
+		for _, row := range rows {
+			for i := range row {
+				row[i] = quoteIfNeeded(row[i])
+			}
+			fmt.Println(strings.Join(row, " "))
+		}
+	}
+	return nil
+}
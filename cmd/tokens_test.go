@@ -0,0 +1,85 @@
+// tokens_test.go
+package main
+
+import (
+	"regexp"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+func TestTokenCommands(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	internal.RegisterUser("alice")
+	internal.CreateFolder("alice", "docs", "")
+	created := regexp.MustCompile(`^Create token ([0-9a-f]{16}) for alice successfully, the token is (vfs_[0-9a-f]{16}_[0-9a-f]{64})\.\n$`)
+
+	output := captureOutput(func() {
+		executeCommand("create-token", []string{"Alice", "--scope", "write", "--folder=Docs", "--expires", "30d"})
+	})
+	match := created.FindStringSubmatch(output)
+	if match == nil {
+		t.Fatalf("unexpected output %q", output)
+	}
+	username, token, err := internal.Authenticate(match[2])
+	if err != nil || username != "alice" || token.ID != match[1] || token.Scope != internal.ScopeWrite || token.Folder != "docs" || token.ExpiresAt.IsZero() {
+		t.Fatalf("expected a write token of alice/docs but got %s %+v %v", username, token, err)
+	}
+	id := match[1]
+
+	tests := []struct {
+		command  string
+		args     []string
+		expected string
+	}{
+		{"list-tokens", []string{"alice"}, id + " write docs " + quoteIfNeeded(formatTime(token.CreatedAt)) + " " + quoteIfNeeded(formatTime(token.ExpiresAt)) + "\n"},
+		{"revoke-token", []string{"alice", id}, "Revoke token " + id + " of alice successfully.\n"},
+		{"revoke-token", []string{"alice", id}, "Error: The " + id + " doesn't exist.\n"},
+		{"list-tokens", []string{"alice"}, "Warning: There are no tokens.\n"},
+		{"list-tokens", []string{"bob"}, "Error: The bob doesn't exist.\n"},
+		{"create-token", []string{"alice", "--scope", "admin"}, "Invalid scope admin, expected read or write\n"},
+		{"create-token", []string{"alice", "--expires", "-1d"}, "Invalid expiry -1d, expected a duration like 30d or 12h\n"},
+		{"create-token", []string{"alice", "--expires", "soon"}, "Invalid expiry soon, expected a duration like 30d or 12h\n"},
+		{"create-token", []string{"alice", "--folder", "music"}, "Error: The music doesn't exist.\n"},
+		{"create-token", []string{"alice", "--scope"}, commandCreateToken + "\n"},
+		{"revoke-token", []string{"alice"}, commandRevokeToken + "\n"},
+	}
+
+	for _, tt := range tests {
+		output := captureOutput(func() {
+			executeCommand(tt.command, tt.args)
+		})
+		if output != tt.expected {
+			t.Errorf("%s %v\nexpected %q\nbut got  %q", tt.command, tt.args, tt.expected, output)
+		}
+	}
+
+	output = captureOutput(func() {
+		executeCommand("create-token", []string{"alice"})
+		executeCommand("list-tokens", []string{"alice"})
+	})
+	if !regexp.MustCompile(`\n[0-9a-f]{16} read \* .+ never\n$`).MatchString(output) {
+		t.Errorf("expected a read token of every folder that doesn't expire but got %q", output)
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"30d", "720h0m0s"},
+		{"12h", "12h0m0s"},
+		{"90m", "1h30m0s"},
+	}
+	for _, tt := range tests {
+		ttl, err := parseExpiry(tt.input)
+		if err != nil || ttl.String() != tt.expected {
+			t.Errorf("parseExpiry(%q) = %v, %v; expected %s", tt.input, ttl, err, tt.expected)
+		}
+	}
+	for _, input := range []string{"", "0d", "d", "0s", "1w"} {
+		if _, err := parseExpiry(input); err == nil {
+			t.Errorf("parseExpiry(%q): expected an error", input)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// webhooks.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"virtual-file-system/internal"
+	"virtual-file-system/internal/webhook"
+)
+
+var commandAddWebhook = "Usage: add-webhook [url] [--user username]? [--folder foldername]? [--events type,...]? [--secret secret]?"
+var commandRemoveWebhook = "Usage: remove-webhook [id]"
+var commandListWebhooks = "Usage: list-webhooks [username]?"
+var commandTestWebhook = "Usage: test-webhook [id]"
+var commandRedeliverWebhook = "Usage: redeliver-webhook [id]"
+
+// webhookTimeout is how long deliveries may take when the application exits, and how long
+// test-webhook and redeliver-webhook wait
+const webhookTimeout = 10 * time.Second
+
+// webhooks delivers the events to the webhooks kept next to the data file, see webhookFile
+var webhooks = webhook.NewDispatcher(webhook.NewStore(webhookFile("data.json")))
+
+// webhookFile returns the path of the webhooks of a data file, e.g. data.webhooks.json for data.json
+func webhookFile(dataFile string) string {
+	return strings.TrimSuffix(dataFile, filepath.Ext(dataFile)) + ".webhooks.json"
+}
+
+// webhookID parses the id argument of the webhook commands
+func webhookID(usage string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, usageError(usage)
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, usageError(fmt.Sprintf("Invalid webhook id %s, expected a number", quoteIfNeeded(args[0])))
+	}
+	return id, nil
+}
+
+// handleWebhookCommand executes add-webhook, remove-webhook, list-webhooks, test-webhook and
+// redeliver-webhook. Webhooks are kept by the process that owns the data file, so they can't
+// be managed through a daemon.
+func handleWebhookCommand(command string, args []string) error {
+	if remote {
+		return usageError("Webhooks are kept next to the data file, run the command with the --data of the daemon instead of --connect")
+	}
+	switch command {
+	case "add-webhook":
+		return handleAddWebhook(args)
+	case "remove-webhook":
+		id, err := webhookID(commandRemoveWebhook, args)
+		if err != nil {
+			return err
+		}
+		if err := webhooks.Store.Remove(id); err != nil {
+			return err
+		}
+		printMessage(fmt.Sprintf("Remove webhook %d successfully.", id))
+	case "list-webhooks":
+		if len(args) > 1 {
+			return usageError(commandListWebhooks)
+		}
+		username := ""
+		if len(args) == 1 {
+			username = args[0]
+			if caseInsensitive {
+				username = strings.ToLower(username)
+			}
+		}
+		return printWebhooks(username)
+	case "test-webhook":
+		id, err := webhookID(commandTestWebhook, args)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+		defer cancel()
+		status, err := webhooks.Test(ctx, id)
+		if err != nil {
+			return err
+		}
+		printMessage(fmt.Sprintf("Deliver a test event to webhook %d successfully (%d).", id, status))
+	case "redeliver-webhook":
+		id, err := webhookID(commandRedeliverWebhook, args)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+		defer cancel()
+		delivered, left, err := webhooks.Redeliver(ctx, id)
+		if err != nil {
+			return err
+		}
+		printMessage(fmt.Sprintf("Redeliver %d dead letters of webhook %d, %d left.", delivered, id, left))
+	}
+	return nil
+}
+
+// handleAddWebhook executes add-webhook. The options may appear anywhere, as --name value or --name=value.
+func handleAddWebhook(args []string) error {
+	rest, options, err := extractOptions(commandAddWebhook, args, "--user", "--folder", "--events", "--secret")
+	if err != nil {
+		return err
+	}
+	w := webhook.Webhook{Username: options["--user"], Folder: options["--folder"], Secret: options["--secret"]}
+	if events, ok := options["--events"]; ok {
+		for _, t := range strings.Split(events, ",") {
+			w.Events = append(w.Events, internal.EventType(strings.TrimSpace(t)))
+		}
+	}
+	if len(rest) != 1 {
+		return usageError(commandAddWebhook)
+	}
+	w.URL = rest[0]
+	if caseInsensitive {
+		w.Username = strings.ToLower(w.Username)
+		w.Folder = strings.ToLower(w.Folder)
+	}
+	if err := webhook.Validate(w); err != nil {
+		return usageError(err.Error())
+	}
+
+	secret := w.Secret
+	w, err = webhooks.Store.Add(w)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		printMessage(fmt.Sprintf("Add webhook %d successfully, its secret is %s.", w.ID, w.Secret))
+	} else {
+		printMessage(fmt.Sprintf("Add webhook %d successfully.", w.ID))
+	}
+	return nil
+}
+
+// Columns of list-webhooks
+var webhookColumns = []column{
+	{name: "id", key: "id", title: "ID", numeric: true},
+	{name: "url", key: "url", title: "URL", truncate: true},
+	{name: "user", key: "user", title: "USER", truncate: true},
+	{name: "folder", key: "folder", title: "FOLDER", truncate: true},
+	{name: "events", key: "events", title: "EVENTS", truncate: true},
+	{name: "dead-letters", key: "dead_letters", title: "DEAD LETTERS", numeric: true},
+}
+
+// printWebhooks prints the webhooks receiving the events of username, or all webhooks.
+// Empty filters are printed as * in the plain and table formats.
+func printWebhooks(username string) error {
+	all, err := webhooks.Store.List()
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, w := range all {
+		if username != "" && w.Username != "" && w.Username != username {
+			continue
+		}
+		letters, err := webhooks.Store.DeadLetters(w.ID)
+		if err != nil {
+			return err
+		}
+		events := make([]string, len(w.Events))
+		for i, t := range w.Events {
+			events[i] = string(t)
+		}
+		rows = append(rows, []string{strconv.Itoa(w.ID), w.URL, w.Username, w.Folder, strings.Join(events, ","), strconv.Itoa(len(letters))})
+	}
+
+	if len(rows) == 0 {
+		printWarning("There are no webhooks.")
+		if outputFormat == formatPlain || outputFormat == formatTable {
+			return nil
+		}
+	}
+
+	switch outputFormat {
+	case formatJSON:
+		keys := make([]string, len(webhookColumns))
+		for i, c := range webhookColumns {
+			keys[i] = c.key
+		}
+		lines := make([]string, len(rows))
+		for i, row := range rows {
+			values := make([]string, len(row))
+			for j, value := range row {
+				values[j] = jsonString(value)
+				if webhookColumns[j].numeric {
+					values[j] = value
+				}
+			}
+			lines[i] = jsonObject(keys, values)
+		}
+		fmt.Println("[" + strings.Join(lines, ",") + "]")
+	case formatCSV:
+		header := make([]string, len(webhookColumns))
+		for i, c := range webhookColumns {
+			header[i] = c.key
+		}
+		writeCSV(os.Stdout, append([][]string{header}, rows...))
+	default:
+		for _, row := range rows {
+			for i := 2; i <= 4; i++ {
+				if row[i] == "" {
+					row[i] = "*"
+				}
+			}
+		}
+		if outputFormat == formatTable {
+			renderTable(os.Stdout, webhookColumns, rows, tableWidth())
+			return nil
+		}
+		for _, row := range rows {
+			for i := range row {
+				row[i] = quoteIfNeeded(row[i])
+			}
+			fmt.Println(strings.Join(row, " "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// webhooks_test.go
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"virtual-file-system/internal"
+	"virtual-file-system/internal/webhook"
+)
+
+// useTestWebhooks keeps the webhooks in a temp dir for the duration of a test
+func useTestWebhooks(t *testing.T) {
+	t.Helper()
+	original := webhooks
+	webhooks = webhook.NewDispatcher(webhook.NewStore(filepath.Join(t.TempDir(), "data.webhooks.json")))
+	t.Cleanup(func() { webhooks = original })
+}
+
+func TestWebhookCommands(t *testing.T) {
+	useTestWebhooks(t)
+	var failing bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+	webhooks.Store.AddDeadLetter(webhook.DeadLetter{Webhook: 2, Event: internal.Event{Seq: 1, Type: internal.FileCreated}})
+
+	tests := []struct {
+		command  string
+		args     []string
+		expected string
+	}{
+		{"list-webhooks", nil, "Warning: There are no webhooks.\n"},
+		{"add-webhook", []string{receiver.URL, "--secret", "s"}, "Add webhook 1 successfully.\n"},
+		{"add-webhook", []string{"--user", "Alice", "--folder=docs", "--events", "file.created,file.deleted", "--secret=s", receiver.URL + "/files"}, "Add webhook 2 successfully.\n"},
+		{"add-webhook", []string{"--user", "bob", "--secret", "s", "https://example.com/hook"}, "Add webhook 3 successfully.\n"},
+		{"list-webhooks", nil, "1 " + receiver.URL + " * * * 0\n2 " + receiver.URL + "/files alice docs file.created,file.deleted 1\n3 https://example.com/hook bob * * 0\n"},
+		{"list-webhooks", []string{"ALICE"}, "1 " + receiver.URL + " * * * 0\n2 " + receiver.URL + "/files alice docs file.created,file.deleted 1\n"},
+		{"test-webhook", []string{"2"}, "Deliver a test event to webhook 2 successfully (200).\n"},
+		{"redeliver-webhook", []string{"2"}, "Redeliver 1 dead letters of webhook 2, 0 left.\n"},
+		{"remove-webhook", []string{"3"}, "Remove webhook 3 successfully.\n"},
+		{"remove-webhook", []string{"3"}, "Error: The webhook 3 doesn't exist.\n"},
+		{"test-webhook", []string{"first"}, "Invalid webhook id first, expected a number\n"},
+		{"test-webhook", nil, commandTestWebhook + "\n"},
+		{"add-webhook", []string{"ftp://example.com"}, "Invalid URL ftp://example.com, expected an http or https URL\n"},
+		{"add-webhook", []string{receiver.URL, "--events", "file.renamed"}, "Unknown event type file.renamed, expected one of user.registered,folder.created,folder.renamed,folder.deleted,file.created,file.updated,file.moved,file.deleted\n"},
+		{"add-webhook", []string{receiver.URL, "--user"}, commandAddWebhook + "\n"},
+		{"list-webhooks", []string{"alice", "bob"}, commandListWebhooks + "\n"},
+	}
+
+	for _, tt := range tests {
+		output := captureOutput(func() {
+			executeCommand(tt.command, tt.args)
+		})
+		if output != tt.expected {
+			t.Errorf("%s %v\nexpected %q\nbut got  %q", tt.command, tt.args, tt.expected, output)
+		}
+	}
+
+	failing = true
+	var code int
+	output := captureOutput(func() {
+		code = exitCode(executeCommand("test-webhook", []string{"1"}))
+	})
+	if code != exitFailure || output != "Error: "+receiver.URL+" answered 503 Service Unavailable\n" {
+		t.Errorf("expected the test to fail but got %d %q", code, output)
+	}
+}
+
+func TestRunDeliversWebhooks(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	received := make(chan string, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r.Header.Get(webhook.HeaderEvent) + " " + string(body)
+	}))
+	defer receiver.Close()
+	data := filepath.Join(t.TempDir(), "data.json")
+	original := webhooks
+	defer func() { webhooks = original }()
+
+	for _, args := range [][]string{
+		{"--data", data, "add-webhook", receiver.URL, "--events", "user.registered"},
+		{"--data", data, "register", "hooked"},
+		{"--data", data, "create-folder", "hooked", "docs"},
+	} {
+		var code int
+		output := captureOutput(func() {
+			code = run(args)
+		})
+		if code != exitOK {
+			t.Fatalf("%v: expected exit code 0 but got %d: %s", args, code, output)
+		}
+	}
+	// The delivery is done before the one-shot command returns
+	if len(received) != 1 || !strings.HasPrefix(<-received, `user.registered {"seq":`) {
+		t.Errorf("expected the registration to be delivered")
+	}
+}
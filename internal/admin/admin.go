@@ -0,0 +1,222 @@
+// internal/admin/admin.go
+
+// Package admin serves the health checks of the virtual file system for orchestrators, and
+// endpoints to save, snapshot and reload the data file and to inspect the running process.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+	"virtual-file-system/internal"
+	"virtual-file-system/internal/httpapi"
+)
+
+// Handler serves the health checks and the admin endpoints
+type Handler struct {
+	started time.Time
+
+	mu      sync.Mutex
+	closing bool
+}
+
+// NewHandler returns the handler of:
+//
+//	GET  /healthz          the process is up
+//	GET  /readyz           the data file was loaded and can be written
+//	POST /admin/save       saves the data file
+//	POST /admin/snapshot   writes a copy of the data next to the data file
+//	POST /admin/reload     reads the data file again
+//	GET  /admin/build      build information
+//	GET  /admin/runtime    runtime statistics
+func NewHandler() *Handler {
+	return &Handler{started: time.Now()}
+}
+
+// Close makes /readyz fail, so no more traffic is sent while the server shuts down
+func (h *Handler) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closing = true
+}
+
+// statusJSON is the body of the health checks
+type statusJSON struct {
+	Status string `json:"status"`
+}
+
+// pathJSON is the body of the save and snapshot responses
+type pathJSON struct {
+	Path string `json:"path"`
+}
+
+// countsJSON is the body of the reload response
+type countsJSON struct {
+	Users   int `json:"users"`
+	Folders int `json:"folders"`
+	Files   int `json:"files"`
+}
+
+// buildJSON is the body of /admin/build. The VCS fields are empty when the binary wasn't built
+// from a repository.
+type buildJSON struct {
+	GoVersion    string `json:"go_version"`
+	Path         string `json:"path"`
+	Version      string `json:"version"`
+	Revision     string `json:"revision"`
+	RevisionTime string `json:"revision_time"`
+	Modified     bool   `json:"modified"`
+}
+
+// runtimeJSON is the body of /admin/runtime
+type runtimeJSON struct {
+	StartedAt       time.Time `json:"started_at"`
+	UptimeSeconds   float64   `json:"uptime_seconds"`
+	Goroutines      int       `json:"goroutines"`
+	GOMAXPROCS      int       `json:"gomaxprocs"`
+	NumCPU          int       `json:"num_cpu"`
+	HeapAllocBytes  uint64    `json:"heap_alloc_bytes"`
+	HeapObjects     uint64    `json:"heap_objects"`
+	TotalAllocBytes uint64    `json:"total_alloc_bytes"`
+	SysBytes        uint64    `json:"sys_bytes"`
+	NumGC           uint32    `json:"num_gc"`
+	countsJSON
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz":
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, statusJSON{"ok"})
+		}
+	case "/readyz":
+		if allowMethod(w, r, http.MethodGet) {
+			h.ready(w)
+		}
+	case "/admin/save":
+		if allowMethod(w, r, http.MethodPost) {
+			if err := internal.SaveData(); err != nil {
+				writeInternalError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, pathJSON{internal.DataFile()})
+		}
+	case "/admin/snapshot":
+		if allowMethod(w, r, http.MethodPost) {
+			path, err := internal.Snapshot()
+			if err != nil {
+				writeInternalError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, pathJSON{path})
+		}
+	case "/admin/reload":
+		if allowMethod(w, r, http.MethodPost) {
+			if err := internal.ReloadData(); err != nil {
+				writeInternalError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, counts())
+		}
+	case "/admin/build":
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, buildInfo())
+		}
+	case "/admin/runtime":
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, h.runtimeStats())
+		}
+	default:
+		httpapi.WriteError(w, http.StatusNotFound, "not_found", "No such resource.")
+	}
+}
+
+// ready answers /readyz, failing with 503 until the data can be written and after Close
+func (h *Handler) ready(w http.ResponseWriter) {
+	h.mu.Lock()
+	closing := h.closing
+	h.mu.Unlock()
+	if closing {
+		httpapi.WriteError(w, http.StatusServiceUnavailable, "not_ready", "The server is shutting down.")
+		return
+	}
+	if err := internal.Ready(); err != nil {
+		httpapi.WriteError(w, http.StatusServiceUnavailable, "not_ready", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, statusJSON{"ready"})
+}
+
+func counts() countsJSON {
+	users, folders, files := internal.CountEntries()
+	return countsJSON{Users: users, Folders: folders, Files: files}
+}
+
+func buildInfo() buildJSON {
+	build := buildJSON{GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	build.Path = info.Main.Path
+	build.Version = info.Main.Version
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Revision = setting.Value
+		case "vcs.time":
+			build.RevisionTime = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	return build
+}
+
+func (h *Handler) runtimeStats() runtimeJSON {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return runtimeJSON{
+		StartedAt:       h.started,
+		UptimeSeconds:   time.Since(h.started).Seconds(),
+		Goroutines:      runtime.NumGoroutine(),
+		GOMAXPROCS:      runtime.GOMAXPROCS(0),
+		NumCPU:          runtime.NumCPU(),
+		HeapAllocBytes:  mem.HeapAlloc,
+		HeapObjects:     mem.HeapObjects,
+		TotalAllocBytes: mem.TotalAlloc,
+		SysBytes:        mem.Sys,
+		NumGC:           mem.NumGC,
+		countsJSON:      counts(),
+	}
+}
+
+// allowMethod answers 405 and returns false unless the request uses method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	httpapi.WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed, expected "+method+".")
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeInternalError writes a failed save, snapshot or reload
+func writeInternalError(w http.ResponseWriter, err error) {
+	if errors.Is(err, internal.ErrUnsavedChanges) {
+		httpapi.WriteError(w, http.StatusConflict, "unsaved_changes", err.Error())
+		return
+	}
+	httpapi.WriteError(w, http.StatusInternalServerError, "io", err.Error())
+}
@@ -0,0 +1,121 @@
+// internal/admin/admin_test.go
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+// request sends a request to h and returns the status and the trimmed body
+func request(h http.Handler, method, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	body, _ := io.ReadAll(recorder.Body)
+	return recorder.Code, strings.TrimSpace(string(body))
+}
+
+func TestAdmin(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data.json")
+	if err := internal.SetDataFile(dataFile); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler()
+
+	tests := []struct {
+		method   string
+		path     string
+		setup    func()
+		status   int
+		expected string
+	}{
+		{"GET", "/healthz", nil, 200, `{"status":"ok"}`},
+		{"GET", "/readyz", nil, 503, `{"error":{"code":"not_ready","message":"The data file hasn't been loaded yet."}}`},
+		{"GET", "/readyz", func() { internal.LoadData() }, 200, `{"status":"ready"}`},
+		{"POST", "/admin/save", func() { internal.RegisterUser("alice") }, 200, `{"path":"` + dataFile + `"}`},
+		{"POST", "/admin/reload", func() {
+			os.WriteFile(dataFile, []byte(`{"bob":{"username":"bob","folders":{"docs":{"name":"docs","files":{}}}}}`), 0644)
+		}, 200, `{"users":1,"folders":1,"files":0}`},
+		{"POST", "/healthz", nil, 405, `{"error":{"code":"method_not_allowed","message":"Method not allowed, expected GET."}}`},
+		{"GET", "/admin/save", nil, 405, `{"error":{"code":"method_not_allowed","message":"Method not allowed, expected POST."}}`},
+		{"GET", "/admin", nil, 404, `{"error":{"code":"not_found","message":"No such resource."}}`},
+	}
+
+	for _, tt := range tests {
+		if tt.setup != nil {
+			tt.setup()
+		}
+		status, body := request(h, tt.method, tt.path)
+		if status != tt.status || body != tt.expected {
+			t.Errorf("%s %s\nexpected %d %s\nbut got %d %s", tt.method, tt.path, tt.status, tt.expected, status, body)
+		}
+	}
+	if users := internal.ListUsers(); len(users) != 1 || users[0] != "bob" {
+		t.Errorf("expected the users of the data file after reloading but got %v", users)
+	}
+
+	status, body := request(h, "POST", "/admin/snapshot")
+	var snapshot pathJSON
+	json.Unmarshal([]byte(body), &snapshot)
+	data, err := os.ReadFile(snapshot.Path)
+	if status != 201 || filepath.Dir(snapshot.Path) != dir || !strings.HasPrefix(filepath.Base(snapshot.Path), "data.snapshot-") || err != nil || !strings.Contains(string(data), `"bob"`) {
+		t.Errorf("expected a snapshot next to the data file but got %d %s: %s %v", status, body, data, err)
+	}
+
+	h.Close()
+	if status, body := request(h, "GET", "/readyz"); status != 503 || !strings.Contains(body, "The server is shutting down.") {
+		t.Errorf("expected not to be ready after Close but got %d %s", status, body)
+	}
+	if status, _ := request(h, "GET", "/healthz"); status != 200 {
+		t.Errorf("expected to be healthy after Close but got %d", status)
+	}
+}
+
+func TestReloadUnsavedChanges(t *testing.T) {
+	dir := t.TempDir()
+	if err := internal.SetDataFile(filepath.Join(dir, "data.json")); err != nil {
+		t.Fatal(err)
+	}
+	internal.LoadData()
+	os.RemoveAll(dir)
+	if err := internal.RegisterUser("carol"); err == nil {
+		t.Fatal("expected saving to a removed directory to fail")
+	}
+	h := NewHandler()
+
+	if status, body := request(h, "POST", "/admin/reload"); status != 409 || body != `{"error":{"code":"unsaved_changes","message":"Some changes haven't been saved to the data file yet."}}` {
+		t.Errorf("expected the reload to be refused but got %d %s", status, body)
+	}
+	if status, body := request(h, "GET", "/readyz"); status != 503 || !strings.Contains(body, "checking data") {
+		t.Errorf("expected not to be ready without a directory but got %d %s", status, body)
+	}
+	if status, body := request(h, "POST", "/admin/save"); status != 500 || !strings.Contains(body, `"code":"io"`) {
+		t.Errorf("expected the save to fail but got %d %s", status, body)
+	}
+}
+
+func TestBuildAndRuntime(t *testing.T) {
+	h := NewHandler()
+	var build buildJSON
+	status, body := request(h, "GET", "/admin/build")
+	if err := json.Unmarshal([]byte(body), &build); status != 200 || err != nil || build.GoVersion != runtime.Version() {
+		t.Errorf("expected the build information but got %d %s", status, body)
+	}
+
+	var stats runtimeJSON
+	status, body = request(h, "GET", "/admin/runtime")
+	if err := json.Unmarshal([]byte(body), &stats); status != 200 || err != nil || stats.Goroutines == 0 || stats.NumCPU == 0 || stats.HeapAllocBytes == 0 || stats.StartedAt.IsZero() || stats.UptimeSeconds < 0 {
+		t.Errorf("expected the runtime statistics but got %d %s", status, body)
+	}
+	if !strings.Contains(body, `"users":`) {
+		t.Errorf("expected the counts in %s", body)
+	}
+}
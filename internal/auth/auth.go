@@ -0,0 +1,137 @@
+// internal/auth/auth.go
+
+// Package auth authenticates the requests to the HTTP servers of the virtual file system with
+// the API tokens of the users, sent as bearer tokens. A token may only access the folders and
+// files of its user, or of one of their folders when it's restricted to it, and read-only
+// tokens may only read.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"virtual-file-system/internal"
+	"virtual-file-system/internal/httpapi"
+)
+
+// userKey is the context key of the user whose token was checked
+type userKey struct{}
+
+// User returns the user whose token Middleware checked for r, or "" when it wasn't checked
+func User(r *http.Request) string {
+	username, _ := r.Context().Value(userKey{}).(string)
+	return username
+}
+
+// readMethods are the methods a read token may use
+var readMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+}
+
+// target is the user and folder a request accesses. all is set when it accesses every
+// folder of the user, e.g. to list them, and user is empty when it accesses every user.
+type target struct {
+	user   string
+	folder string
+	all    bool
+}
+
+// Middleware requires a valid bearer token on the requests to next, the REST API under /users,
+// WebDAV under /dav and the event streams of /events, and checks the token may make them
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="vfs"`)
+			httpapi.WriteError(w, http.StatusUnauthorized, "unauthorized", "A bearer token is required.")
+			return
+		}
+		username, t, err := internal.Authenticate(strings.TrimSpace(token))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="vfs", error="invalid_token"`)
+			httpapi.WriteError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+			return
+		}
+
+		targets := []target{targetOf(r.URL)}
+		if destination := r.Header.Get("Destination"); destination != "" {
+			// WebDAV COPY and MOVE write to the destination too
+			u, err := url.Parse(destination)
+			if err != nil {
+				httpapi.WriteError(w, http.StatusBadRequest, "invalid_destination", "Invalid Destination header.")
+				return
+			}
+			targets = append(targets, targetOf(u))
+		}
+		for _, target := range targets {
+			if err := allow(username, t, target); err != nil {
+				httpapi.WriteError(w, http.StatusForbidden, "forbidden", err.Error())
+				return
+			}
+		}
+		if t.Scope == internal.ScopeRead && !readMethods[r.Method] {
+			httpapi.WriteError(w, http.StatusForbidden, "forbidden", "The token is read-only.")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, username)))
+	})
+}
+
+// targetOf returns what a URL of the REST API, WebDAV or the event streams accesses
+func targetOf(u *url.URL) target {
+	if strings.Trim(u.EscapedPath(), "/") == "events" {
+		query := u.Query()
+		return target{user: internal.NormalizeName(query.Get("user")), folder: internal.NormalizeName(query.Get("folder")), all: query.Get("folder") == ""}
+	}
+	segments := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return target{}
+		}
+		// Scopes are checked against the names the handler will look up
+		segments[i] = internal.NormalizeName(unescaped)
+	}
+	switch {
+	case len(segments) < 2 || (segments[0] != "users" && segments[0] != "dav"):
+		return target{}
+	case segments[0] == "dav" && len(segments) >= 3:
+		return target{user: segments[1], folder: segments[2]}
+	case segments[0] == "users" && len(segments) >= 4 && segments[2] == "folders":
+		return target{user: segments[1], folder: segments[3]}
+	case segments[0] == "users" && len(segments) == 2:
+		// The user itself, without their folders
+		return target{user: segments[1]}
+	}
+	return target{user: segments[1], all: true}
+}
+
+// allow checks a token of username may access target
+func allow(username string, t *internal.Token, target target) error {
+	if target.user != username {
+		return fmt.Errorf("The token of %s can't access other users.", internal.QuoteIfNeeded(username))
+	}
+	if t.Folder != "" && (target.all || (target.folder != "" && target.folder != t.Folder)) {
+		return fmt.Errorf("The token is restricted to the folder %s.", internal.QuoteIfNeeded(t.Folder))
+	}
+	return nil
+}
+
+// LoopbackOnly answers the requests to next from the local host only, for the endpoints
+// tokens don't cover
+func LoopbackOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			httpapi.WriteError(w, http.StatusForbidden, "forbidden", "Only local clients may use this endpoint.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
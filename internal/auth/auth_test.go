@@ -0,0 +1,93 @@
+// internal/auth/auth_test.go
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"virtual-file-system/internal"
+)
+
+func TestMiddleware(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	internal.RegisterUser("alice")
+	internal.RegisterUser("bob")
+	internal.CreateFolder("alice", "docs", "")
+	internal.CreateFolder("alice", "tmp", "")
+	write, _, _ := internal.CreateToken("alice", internal.ScopeWrite, "", 0)
+	read, _, _ := internal.CreateToken("alice", internal.ScopeRead, "", 0)
+	docs, _, _ := internal.CreateToken("alice", internal.ScopeWrite, "docs", 0)
+	expired, _, _ := internal.CreateToken("alice", internal.ScopeWrite, "", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	// The requests let through carry the user of their token
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if User(r) != "alice" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	tests := []struct {
+		method      string
+		path        string
+		token       string
+		destination string
+		status      int
+		expected    string
+	}{
+		{"GET", "/users/alice/folders", "", "", 401, `{"error":{"code":"unauthorized","message":"A bearer token is required."}}`},
+		{"GET", "/users/alice/folders", "vfs_0_0", "", 401, `{"error":{"code":"unauthorized","message":"The token is invalid."}}`},
+		{"GET", "/users/alice/folders", expired, "", 401, `{"error":{"code":"unauthorized","message":"The token has expired."}}`},
+		{"GET", "/users/alice/folders", write, "", 200, ``},
+		{"POST", "/users/Alice/folders", write, "", 200, ``},
+		{"GET", "/users/bob", write, "", 403, `{"error":{"code":"forbidden","message":"The token of alice can't access other users."}}`},
+		{"GET", "/users", write, "", 403, `{"error":{"code":"forbidden","message":"The token of alice can't access other users."}}`},
+		{"GET", "/users/alice/folders/docs/files", read, "", 200, ``},
+		{"PROPFIND", "/dav/alice/", read, "", 200, ``},
+		{"DELETE", "/users/alice/folders/docs", read, "", 403, `{"error":{"code":"forbidden","message":"The token is read-only."}}`},
+		{"GET", "/users/alice", docs, "", 200, ``},
+		{"PATCH", "/users/alice/folders/DOCS", docs, "", 200, ``},
+		{"POST", "/users/alice/folders/docs/files", docs, "", 200, ``},
+		{"GET", "/users/alice/folders", docs, "", 403, `{"error":{"code":"forbidden","message":"The token is restricted to the folder docs."}}`},
+		{"DELETE", "/users/alice/folders/tmp", docs, "", 403, `{"error":{"code":"forbidden","message":"The token is restricted to the folder docs."}}`},
+		{"PUT", "/dav/alice/docs/notes", docs, "", 200, ``},
+		{"PROPFIND", "/dav/alice", docs, "", 403, `{"error":{"code":"forbidden","message":"The token is restricted to the folder docs."}}`},
+		{"MOVE", "/dav/alice/docs/notes", docs, "http://localhost/dav/alice/tmp/notes", 403, `{"error":{"code":"forbidden","message":"The token is restricted to the folder docs."}}`},
+		{"MOVE", "/dav/alice/docs/notes", docs, "/dav/alice/docs/todo", 200, ``},
+		{"GET", "/events?user=alice&folder=docs", docs, "", 200, ``},
+		{"GET", "/events?user=alice", docs, "", 403, `{"error":{"code":"forbidden","message":"The token is restricted to the folder docs."}}`},
+		{"GET", "/events", read, "", 403, `{"error":{"code":"forbidden","message":"The token of alice can't access other users."}}`},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		if tt.destination != "" {
+			req.Header.Set("Destination", tt.destination)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if body := strings.TrimSpace(recorder.Body.String()); recorder.Code != tt.status || body != tt.expected {
+			t.Errorf("%s %s\nexpected %d %s\nbut got %d %s", tt.method, tt.path, tt.status, tt.expected, recorder.Code, body)
+		}
+		if recorder.Code == 401 && !strings.HasPrefix(recorder.Header().Get("WWW-Authenticate"), `Bearer realm="vfs"`) {
+			t.Errorf("%s %s: expected a WWW-Authenticate header", tt.method, tt.path)
+		}
+	}
+}
+
+func TestLoopbackOnly(t *testing.T) {
+	handler := LoopbackOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for remote, expected := range map[string]int{"127.0.0.1:4000": 200, "[::1]:4000": 200, "10.0.0.1:4000": 403, "invalid": 403} {
+		req := httptest.NewRequest("POST", "/admin/save", nil)
+		req.RemoteAddr = remote
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != expected {
+			t.Errorf("%s: expected %d but got %d", remote, expected, recorder.Code)
+		}
+	}
+}
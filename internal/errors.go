@@ -0,0 +1,110 @@
+// internal/errors.go
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrAlreadyExists is reported when a user, folder or file with the same name already exists
+var ErrAlreadyExists = errors.New("already exists")
+
+// ErrNotFound is reported when a user, folder or file doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrInvalidName is reported when a name doesn't pass the validation rules
+var ErrInvalidName = errors.New("invalid name")
+
+// ErrInvalidSort is reported when a listing is sorted by an unknown field or order
+var ErrInvalidSort = errors.New("invalid sort")
+
+// NameError records an error caused by a user, folder or file name.
+// Use errors.Is with ErrAlreadyExists, ErrNotFound or ErrInvalidName to check its category.
+type NameError struct {
+	Name string
+	Err  error
+}
+
+func (e *NameError) Error() string {
+	switch e.Err {
+	case ErrAlreadyExists:
+		return fmt.Sprintf("The %s has already existed.", QuoteIfNeeded(e.Name))
+	case ErrNotFound:
+		return fmt.Sprintf("The %s doesn't exist.", QuoteIfNeeded(e.Name))
+	case ErrInvalidName:
+		return fmt.Sprintf("The %s contains invalid chars.", QuoteIfNeeded(e.Name))
+	}
+	return fmt.Sprintf("The %s: %v", QuoteIfNeeded(e.Name), e.Err)
+}
+
+func (e *NameError) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidQuery is reported when a listing is filtered or paged with an invalid value
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ErrUnsavedChanges is reported when reloading the data file would lose changes that
+// couldn't be saved
+var ErrUnsavedChanges = errors.New("Some changes haven't been saved to the data file yet.")
+
+// SortError records an unknown sort field or order.
+// errors.Is reports it as ErrInvalidSort.
+type SortError struct {
+	Field string
+	Order string
+}
+
+func (e *SortError) Error() string {
+	if e.Order != "" {
+		return fmt.Sprintf("Unknown sort order %s, expected asc or desc", QuoteIfNeeded(e.Order))
+	}
+	return fmt.Sprintf("Unknown sort field %s, expected one of %s", QuoteIfNeeded(e.Field), strings.Join(SortFields, ","))
+}
+
+func (e *SortError) Unwrap() error {
+	return ErrInvalidSort
+}
+
+// QueryError records an invalid filter or paging option of a listing.
+// errors.Is reports it as ErrInvalidQuery.
+type QueryError struct {
+	Option string
+	Value  string
+	Err    error
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("Invalid %s %s: %v", e.Option, QuoteIfNeeded(e.Value), e.Err)
+}
+
+func (e *QueryError) Unwrap() []error {
+	return []error{ErrInvalidQuery, e.Err}
+}
+
+// StorageError records a failure while reading or writing the data file
+type StorageError struct {
+	Op  string
+	Err error
+}
+
+func (e *StorageError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+func errorAlreayExisted(name string) error {
+	return &NameError{Name: name, Err: ErrAlreadyExists}
+}
+
+func errorDoesntExisted(name string) error {
+	return &NameError{Name: name, Err: ErrNotFound}
+}
+
+func errorInvalidChars(name string) error {
+	return &NameError{Name: name, Err: ErrInvalidName}
+}
@@ -0,0 +1,184 @@
+// internal/events.go
+package internal
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// EventType names the change an event reports
+type EventType string
+
+// The events emitted by the operations
+const (
+	UserRegistered EventType = "user.registered"
+	FolderCreated  EventType = "folder.created"
+	FolderRenamed  EventType = "folder.renamed"
+	FolderDeleted  EventType = "folder.deleted"
+	FileCreated    EventType = "file.created"
+	FileUpdated    EventType = "file.updated"
+	FileMoved      EventType = "file.moved"
+	FileDeleted    EventType = "file.deleted"
+)
+
+// EventTypes lists the types of the events emitted by the operations
+var EventTypes = []EventType{UserRegistered, FolderCreated, FolderRenamed, FolderDeleted, FileCreated, FileUpdated, FileMoved, FileDeleted}
+
+// Event is a change made by an operation. Seq numbers the events of the process from 1.
+// Renames and moves set NewFolder and NewFile to the new names; creations and updates
+// set Description.
+type Event struct {
+	Seq         uint64    `json:"seq"`
+	Type        EventType `json:"type"`
+	Time        time.Time `json:"time"`
+	Username    string    `json:"username"`
+	Folder      string    `json:"folder,omitempty"`
+	File        string    `json:"file,omitempty"`
+	NewFolder   string    `json:"new_folder,omitempty"`
+	NewFile     string    `json:"new_file,omitempty"`
+	Description string    `json:"description,omitempty"`
+}
+
+// EventFilter selects the events of a user, and of one of their folders if Folder is set.
+// The zero value selects all events.
+type EventFilter struct {
+	Username string
+	Folder   string
+}
+
+// Match reports whether e is selected. An event about a folder matches by its old and new name.
+func (f EventFilter) Match(e Event) bool {
+	if f.Username != "" && e.Username != f.Username {
+		return false
+	}
+	if f.Folder != "" && e.Folder != f.Folder && e.NewFolder != f.Folder {
+		return false
+	}
+	return true
+}
+
+// ErrEventsExpired is reported when resuming after events that are no longer kept
+var ErrEventsExpired = errors.New("events expired")
+
+// ErrSubscriberTooSlow ends a subscription that fell too far behind
+var ErrSubscriberTooSlow = errors.New("subscriber too slow")
+
+// eventHistory is how many recent events are kept to resume from
+const eventHistory = 1024
+
+// subscriptionBuffer is how many events a subscriber may fall behind before it's dropped
+const subscriptionBuffer = 256
+
+// eventsMu guards the event history and the subscriptions. It's taken while holding mu,
+// never the other way round.
+var eventsMu sync.Mutex
+var lastSeq uint64
+var history []Event
+var subscriptions = make(map[*Subscription]struct{})
+
+// Subscription receives the events matching its filter
+type Subscription struct {
+	filter EventFilter
+	events chan Event
+	err    error
+}
+
+// Events is closed when the subscription ends, see Err
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err returns ErrSubscriberTooSlow after the subscription was dropped, and nil otherwise
+func (s *Subscription) Err() error {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if _, ok := subscriptions[s]; ok {
+		delete(subscriptions, s)
+		close(s.events)
+	}
+}
+
+// Subscribe subscribes to the events matching filter that come after the event numbered after.
+// Kept events after it are delivered first; 0 subscribes to new events only.
+// It returns ErrEventsExpired when some of the events to resume from are no longer kept,
+// or when after is ahead of the latest event, as numbers restart with the process.
+func Subscribe(filter EventFilter, after uint64) (*Subscription, error) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	if after > lastSeq {
+		// Numbers of another run of the process
+		return nil, ErrEventsExpired
+	}
+	var missed []Event
+	if after > 0 && after < lastSeq {
+		if len(history) == 0 || history[0].Seq > after+1 {
+			return nil, ErrEventsExpired
+		}
+		for _, e := range history[after+1-history[0].Seq:] {
+			if filter.Match(e) {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	s := &Subscription{filter: filter, events: make(chan Event, subscriptionBuffer+len(missed))}
+	for _, e := range missed {
+		s.events <- e
+	}
+	subscriptions[s] = struct{}{}
+	return s, nil
+}
+
+// LastEventSeq returns the number of the latest event, 0 if there was none
+func LastEventSeq() uint64 {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	return lastSeq
+}
+
+// commit saves a change and emits its event, only once the change is saved.
+// The caller must hold mu.
+func commit(e Event) error {
+	if err := persist(); err != nil {
+		return err
+	}
+	emit(e)
+	return nil
+}
+
+// emit numbers an event, keeps it and delivers it to the subscribers.
+// It never blocks: subscribers that fell behind are dropped.
+func emit(e Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	lastSeq++
+	e.Seq = lastSeq
+	e.Time = time.Now()
+	if len(history) == eventHistory {
+		history = append(history[:0], history[1:]...)
+	}
+	history = append(history, e)
+
+	for s := range subscriptions {
+		if !s.filter.Match(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			s.err = ErrSubscriberTooSlow
+			delete(subscriptions, s)
+			close(s.events)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// internal/events_test.go
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// receive takes the events waiting in a subscription
+func receive(s *Subscription) []Event {
+	var events []Event
+	for {
+		select {
+		case e, ok := <-s.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	UseMockData(make(map[string]*User))
+	start := LastEventSeq()
+	all, err := Subscribe(EventFilter{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer all.Close()
+	docs, _ := Subscribe(EventFilter{Username: "alice", Folder: "docs"}, 0)
+	defer docs.Close()
+
+	RegisterUser("alice")
+	RegisterUser("bob")
+	CreateFolder("alice", "docs", "documents")
+	CreateFolder("alice", "tmp", "")
+	CreateFile("alice", "docs", "a", "first")
+	SetFileDescription("alice", "docs", "a", "second")
+	MoveFile("alice", "docs", "a", "tmp", "b")
+	RenameFolder("alice", "tmp", "docs2")
+	DeleteFile("alice", "docs2", "b")
+	DeleteFolder("alice", "docs2")
+	// Failed operations change nothing
+	RegisterUser("alice")
+	DeleteFolder("bob", "docs")
+
+	expected := []Event{
+		{Type: UserRegistered, Username: "alice"},
+		{Type: UserRegistered, Username: "bob"},
+		{Type: FolderCreated, Username: "alice", Folder: "docs", Description: "documents"},
+		{Type: FolderCreated, Username: "alice", Folder: "tmp"},
+		{Type: FileCreated, Username: "alice", Folder: "docs", File: "a", Description: "first"},
+		{Type: FileUpdated, Username: "alice", Folder: "docs", File: "a", Description: "second"},
+		{Type: FileMoved, Username: "alice", Folder: "docs", File: "a", NewFolder: "tmp", NewFile: "b"},
+		{Type: FolderRenamed, Username: "alice", Folder: "tmp", NewFolder: "docs2"},
+		{Type: FileDeleted, Username: "alice", Folder: "docs2", File: "b"},
+		{Type: FolderDeleted, Username: "alice", Folder: "docs2"},
+	}
+	events := receive(all)
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events but got %+v", len(expected), events)
+	}
+	for i, e := range events {
+		if e.Seq != start+uint64(i)+1 || e.Time.IsZero() {
+			t.Errorf("event %d: expected seq %d and a time but got %+v", i, start+uint64(i)+1, e)
+		}
+		e.Seq, e.Time = 0, expected[i].Time
+		if e != expected[i] {
+			t.Errorf("event %d: expected %+v but got %+v", i, expected[i], e)
+		}
+	}
+
+	// The folder filter matches the old and the new folder of moves
+	var types []EventType
+	for _, e := range receive(docs) {
+		types = append(types, e.Type)
+	}
+	if len(types) != 4 || types[0] != FolderCreated || types[1] != FileCreated || types[2] != FileUpdated || types[3] != FileMoved {
+		t.Errorf("expected the events of alice/docs but got %v", types)
+	}
+
+	// Resuming replays the kept events after the given one
+	resumed, err := Subscribe(EventFilter{Username: "bob"}, start+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Close()
+	if events := receive(resumed); len(events) != 1 || events[0].Seq != start+2 {
+		t.Errorf("expected the registration of bob but got %+v", events)
+	}
+	if _, err := Subscribe(EventFilter{}, LastEventSeq()+1); !errors.Is(err, ErrEventsExpired) {
+		t.Errorf("expected ErrEventsExpired for a future event but got %v", err)
+	}
+}
+
+func TestEventsExpiredAndTooSlow(t *testing.T) {
+	UseMockData(make(map[string]*User))
+	RegisterUser("alice")
+	first := LastEventSeq()
+
+	slow, _ := Subscribe(EventFilter{}, 0)
+	for i := 0; i <= eventHistory; i++ {
+		SetFileDescription("alice", "none", "none", "")
+		CreateFolder("alice", "docs", "")
+		DeleteFolder("alice", "docs")
+	}
+
+	if _, ok := <-slow.Events(); !ok {
+		t.Fatalf("expected the buffered events before the end of the subscription")
+	}
+	for range slow.Events() {
+	}
+	if err := slow.Err(); !errors.Is(err, ErrSubscriberTooSlow) {
+		t.Errorf("expected ErrSubscriberTooSlow but got %v", err)
+	}
+	slow.Close()
+
+	if _, err := Subscribe(EventFilter{}, first); !errors.Is(err, ErrEventsExpired) {
+		t.Errorf("expected ErrEventsExpired but got %v", err)
+	}
+	latest, err := Subscribe(EventFilter{}, LastEventSeq()-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer latest.Close()
+	if events := receive(latest); len(events) != 1 {
+		t.Errorf("expected the latest event but got %+v", events)
+	}
+}
+
+func TestEventsOnlyAfterSaving(t *testing.T) {
+	originalFile, originalMock := dataFile, useMockData
+	defer func() {
+		dataFile = originalFile
+		UseMockData(make(map[string]*User))
+		useMockData = originalMock
+	}()
+	UseMockData(make(map[string]*User))
+	useMockData = false
+	dataFile = filepath.Join(t.TempDir(), "missing", "data.json")
+
+	s, _ := Subscribe(EventFilter{}, 0)
+	defer s.Close()
+	var storageErr *StorageError
+	if err := RegisterUser("alice"); !errors.As(err, &storageErr) {
+		t.Fatalf("expected saving to a missing directory to fail but got %v", err)
+	}
+	if events := receive(s); len(events) != 0 {
+		t.Errorf("expected no events of the unsaved change but got %+v", events)
+	}
+
+	dataFile = filepath.Join(t.TempDir(), "data.json")
+	if err := CreateFolder("alice", "docs", ""); err != nil {
+		t.Fatal(err)
+	}
+	if events := receive(s); len(events) != 1 || events[0].Type != FolderCreated {
+		t.Errorf("expected the folder.created event once saved but got %+v", events)
+	}
+}
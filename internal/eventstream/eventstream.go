@@ -0,0 +1,144 @@
+// internal/eventstream/eventstream.go
+
+// Package eventstream streams the events of the virtual file system over Server-Sent Events
+// and WebSocket. A request with the Upgrade: websocket header gets a WebSocket (RFC 6455)
+// sending one text message per event, any other GET an SSE stream.
+package eventstream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"virtual-file-system/internal"
+	"virtual-file-system/internal/httpapi"
+)
+
+// heartbeatInterval is how often an idle stream sends something, so proxies keep it open
+var heartbeatInterval = 15 * time.Second
+
+// Handler serves the event streams until Close
+type Handler struct {
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+}
+
+// NewHandler returns the handler of the event streams:
+//
+//	GET /events?user=&folder=&since=
+//
+// user and folder select the events of a user and one of their folders, and since resumes
+// after the event with that number. SSE clients reconnecting with Last-Event-ID resume after it.
+func NewHandler() *Handler {
+	return &Handler{done: make(chan struct{})}
+}
+
+// Close ends the streams, e.g. when the server shuts down
+func (h *Handler) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closed {
+		h.closed = true
+		close(h.done)
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		httpapi.WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed, expected GET.")
+		return
+	}
+	websocket := strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+
+	filter, after, err := parseRequest(r, !websocket)
+	if err != nil {
+		httpapi.WriteError(w, http.StatusBadRequest, "invalid_query", err.Error())
+		return
+	}
+	if websocket && !validHandshake(w, r) {
+		return
+	}
+
+	sub, err := internal.Subscribe(filter, after)
+	if errors.Is(err, internal.ErrEventsExpired) {
+		httpapi.WriteError(w, http.StatusGone, "events_expired", fmt.Sprintf("The events after %d are no longer kept, subscribe without since to start over.", after))
+		return
+	} else if err != nil {
+		httpapi.WriteError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	defer sub.Close()
+
+	if websocket {
+		h.serveWebSocket(w, r, sub)
+	} else {
+		h.serveSSE(w, r, sub)
+	}
+}
+
+// parseRequest reads the filter and the number of the event to resume after
+func parseRequest(r *http.Request, lastEventID bool) (internal.EventFilter, uint64, error) {
+	query := r.URL.Query()
+	// The events carry the names as the operations stored them
+	filter := internal.EventFilter{Username: internal.NormalizeName(query.Get("user")), Folder: internal.NormalizeName(query.Get("folder"))}
+	if filter.Folder != "" && filter.Username == "" {
+		return filter, 0, errors.New("Invalid folder filter: a user is needed too")
+	}
+
+	since := query.Get("since")
+	if id := r.Header.Get("Last-Event-ID"); lastEventID && id != "" {
+		since = id
+	}
+	if since == "" {
+		return filter, 0, nil
+	}
+	after, err := strconv.ParseUint(since, 10, 64)
+	if err != nil {
+		return filter, 0, fmt.Errorf("Invalid since %s: must be an event number", since)
+	}
+	return filter, after, nil
+}
+
+// serveSSE writes the events as SSE messages with their number as ID and their type as event name.
+// A subscriber that falls behind is hung up on, and resumes by reconnecting.
+func (h *Handler) serveSSE(w http.ResponseWriter, r *http.Request, sub *internal.Subscription) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpapi.WriteError(w, http.StatusInternalServerError, "internal_error", "Streaming is not supported.")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(e)
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,239 @@
+// internal/eventstream/eventstream_test.go
+package eventstream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+// newTestServer serves a handler over HTTP with fresh data
+func newTestServer(t *testing.T) (*Handler, *httptest.Server) {
+	t.Helper()
+	internal.UseMockData(make(map[string]*internal.User))
+	handler := NewHandler()
+	server := httptest.NewServer(handler)
+	t.Cleanup(func() {
+		handler.Close()
+		server.Close()
+	})
+	return handler, server
+}
+
+// readSSE reads the next SSE message, skipping comments
+func readSSE(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+	message := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && len(message) > 0 {
+			return message
+		}
+		if field, value, ok := strings.Cut(line, ": "); ok && field != "" {
+			message[field] = value
+		}
+	}
+}
+
+func TestSSE(t *testing.T) {
+	_, server := newTestServer(t)
+
+	resp, err := http.Get(server.URL + "/events?user=Alice&folder=docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream but got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	internal.RegisterUser("alice")
+	internal.CreateFolder("alice", "photos", "")
+	internal.CreateFolder("alice", "docs", "documents")
+	internal.CreateFile("alice", "docs", "a", "")
+	reader := bufio.NewReader(resp.Body)
+
+	first := readSSE(t, reader)
+	var e internal.Event
+	if err := json.Unmarshal([]byte(first["data"]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if first["event"] != "folder.created" || first["id"] != strconv.FormatUint(e.Seq, 10) || e.Folder != "docs" || e.Description != "documents" {
+		t.Errorf("expected the creation of docs but got %v", first)
+	}
+	if second := readSSE(t, reader); second["event"] != "file.created" || !strings.Contains(second["data"], `"file":"a"`) {
+		t.Errorf("expected the creation of a but got %v", second)
+	}
+
+	// Reconnecting with Last-Event-ID resumes after it
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events?user=alice&since=1", nil)
+	req.Header.Set("Last-Event-ID", first["id"])
+	resumed, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Body.Close()
+	if message := readSSE(t, bufio.NewReader(resumed.Body)); message["event"] != "file.created" {
+		t.Errorf("expected to resume with the creation of a but got %v", message)
+	}
+}
+
+func TestSSECloseEndsStreams(t *testing.T) {
+	handler, server := newTestServer(t)
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	handler.Close()
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("expected the stream to end but got %v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, server := newTestServer(t)
+
+	tests := []struct {
+		method   string
+		query    string
+		header   http.Header
+		status   int
+		expected string
+	}{
+		{http.MethodPost, "", nil, http.StatusMethodNotAllowed, `{"error":{"code":"method_not_allowed","message":"Method not allowed, expected GET."}}`},
+		{http.MethodGet, "?folder=docs", nil, http.StatusBadRequest, `{"error":{"code":"invalid_query","message":"Invalid folder filter: a user is needed too"}}`},
+		{http.MethodGet, "?since=first", nil, http.StatusBadRequest, `{"error":{"code":"invalid_query","message":"Invalid since first: must be an event number"}}`},
+		{http.MethodGet, "?since=18446744073709551615", nil, http.StatusGone, `{"error":{"code":"events_expired","message":"The events after 18446744073709551615 are no longer kept, subscribe without since to start over."}}`},
+		{http.MethodGet, "", http.Header{"Upgrade": {"websocket"}, "Connection": {"Upgrade"}, "Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired, `{"error":{"code":"invalid_handshake","message":"Invalid WebSocket handshake: only version 13 is supported."}}`},
+		{http.MethodGet, "", http.Header{"Upgrade": {"websocket"}, "Connection": {"Upgrade"}, "Sec-Websocket-Version": {"13"}, "Sec-Websocket-Key": {"short"}}, http.StatusBadRequest, `{"error":{"code":"invalid_handshake","message":"Invalid WebSocket handshake: bad Sec-WebSocket-Key."}}`},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, server.URL+"/events"+tt.query, nil)
+		for name, values := range tt.header {
+			req.Header[name] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || strings.TrimSpace(string(body)) != tt.expected {
+			t.Errorf("%s %s\nexpected %d %s\nbut got  %d %s", tt.method, tt.query, tt.status, tt.expected, resp.StatusCode, body)
+		}
+	}
+}
+
+// wsClient is the client side of a WebSocket
+type wsClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialWebSocket opens a WebSocket on the events of the query
+func dialWebSocket(t *testing.T, server *httptest.Server, query string) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET /events%s HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", query, key)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The accept key of the example of RFC 6455
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("expected the handshake to succeed but got %d %v", resp.StatusCode, resp.Header)
+	}
+	return &wsClient{conn: conn, reader: reader}
+}
+
+// write sends a masked frame
+func (c *wsClient) write(opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+// read receives a frame of the server, which is small and unmasked
+func (c *wsClient) read(t *testing.T) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		t.Fatalf("reading a frame: %v", err)
+	}
+	size := int(header[1])
+	if size == 126 {
+		var extended [2]byte
+		io.ReadFull(c.reader, extended[:])
+		size = int(binary.BigEndian.Uint16(extended[:]))
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatalf("reading a frame: %v", err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+func TestWebSocket(t *testing.T) {
+	handler, server := newTestServer(t)
+	internal.RegisterUser("alice")
+	since := internal.LastEventSeq()
+	client := dialWebSocket(t, server, "?user=alice&since="+strconv.FormatUint(since, 10))
+
+	internal.RegisterUser("bob")
+	internal.CreateFolder("alice", "docs", "")
+	opcode, payload := client.read(t)
+	var e internal.Event
+	json.Unmarshal(payload, &e)
+	if opcode != opText || e.Type != internal.FolderCreated || e.Seq != since+2 {
+		t.Errorf("expected the creation of docs but got %d %s", opcode, payload)
+	}
+
+	client.write(opPing, []byte("hi"))
+	if opcode, payload := client.read(t); opcode != opPong || string(payload) != "hi" {
+		t.Errorf("expected a pong but got %d %q", opcode, payload)
+	}
+
+	handler.Close()
+	opcode, payload = client.read(t)
+	if opcode != opClose || binary.BigEndian.Uint16(payload) != closeGoingAway || string(payload[2:]) != "server shutting down" {
+		t.Errorf("expected a close frame but got %d %q", opcode, payload)
+	}
+}
+
+func TestWebSocketClientClose(t *testing.T) {
+	_, server := newTestServer(t)
+	client := dialWebSocket(t, server, "")
+
+	client.write(opClose, binary.BigEndian.AppendUint16(nil, closeNormal))
+	if opcode, payload := client.read(t); opcode != opClose || binary.BigEndian.Uint16(payload) != closeNormal {
+		t.Errorf("expected the close frame to be echoed but got %d %q", opcode, payload)
+	}
+	if _, err := client.reader.ReadByte(); err != io.EOF {
+		t.Errorf("expected the connection to be closed but got %v", err)
+	}
+}
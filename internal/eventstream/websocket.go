@@ -0,0 +1,259 @@
+// internal/eventstream/websocket.go
+package eventstream
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"virtual-file-system/internal"
+	"virtual-file-system/internal/httpapi"
+)
+
+// websocketGUID is appended to the key of the handshake to compute the accept key
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Opcodes of WebSocket frames
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Status codes of close frames
+const (
+	closeNormal        = 1000
+	closeGoingAway     = 1001
+	closeProtocolError = 1002
+	closeTooBig        = 1009
+	closeTryAgainLater = 1013
+)
+
+// maxFrameSize limits the frames a client may send. Its messages are ignored anyway.
+const maxFrameSize = 4096
+
+// closeTimeout is how long to wait for the client's close frame after sending ours
+const closeTimeout = time.Second
+
+var errProtocol = errors.New("websocket protocol error")
+var errFrameTooBig = errors.New("websocket frame too big")
+
+// validHandshake checks the opening handshake of a WebSocket, answering the invalid ones
+func validHandshake(w http.ResponseWriter, r *http.Request) bool {
+	upgrade := false
+	for _, token := range strings.Split(r.Header.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+			upgrade = true
+		}
+	}
+	if !upgrade {
+		httpapi.WriteError(w, http.StatusBadRequest, "invalid_handshake", "Invalid WebSocket handshake: missing Connection: Upgrade.")
+		return false
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		httpapi.WriteError(w, http.StatusUpgradeRequired, "invalid_handshake", "Invalid WebSocket handshake: only version 13 is supported.")
+		return false
+	}
+	if key, err := base64.StdEncoding.DecodeString(r.Header.Get("Sec-WebSocket-Key")); err != nil || len(key) != 16 {
+		httpapi.WriteError(w, http.StatusBadRequest, "invalid_handshake", "Invalid WebSocket handshake: bad Sec-WebSocket-Key.")
+		return false
+	}
+	if _, ok := w.(http.Hijacker); !ok {
+		httpapi.WriteError(w, http.StatusInternalServerError, "internal_error", "WebSockets are not supported.")
+		return false
+	}
+	return true
+}
+
+// acceptKey returns the Sec-WebSocket-Accept answering key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// wsConn writes the frames of a WebSocket, one at a time
+type wsConn struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	writer *bufio.Writer
+}
+
+// writeFrame writes an unfragmented frame. Servers don't mask their frames.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	}
+	c.writer.Write(header)
+	c.writer.Write(payload)
+	return c.writer.Flush()
+}
+
+// writeClose writes a close frame with a status code and a reason
+func (c *wsConn) writeClose(code uint16, reason string) error {
+	return c.writeFrame(opClose, append(binary.BigEndian.AppendUint16(nil, code), reason...))
+}
+
+// readFrame reads a frame sent by a client, which must be masked, and unmasks its payload
+func readFrame(r *bufio.Reader) (opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode = header[0] & 0x0F
+	if header[0]&0x70 != 0 || header[1]&0x80 == 0 {
+		return 0, nil, errProtocol
+	}
+
+	size := uint64(header[1] & 0x7F)
+	switch size {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(extended[:])
+	}
+	if size > maxFrameSize {
+		return 0, nil, errFrameTooBig
+	}
+	if opcode >= opClose && (size > 125 || header[0]&0x80 == 0) {
+		return 0, nil, errProtocol
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// readFrames answers the control frames of the client until it closes the WebSocket
+// or breaks the protocol, and ignores its messages
+func (c *wsConn) readFrames(r *bufio.Reader) {
+	for {
+		opcode, payload, err := readFrame(r)
+		switch {
+		case errors.Is(err, errFrameTooBig):
+			c.writeClose(closeTooBig, "frame too big")
+			return
+		case errors.Is(err, errProtocol):
+			c.writeClose(closeProtocolError, "protocol error")
+			return
+		case err != nil:
+			return
+		}
+
+		switch opcode {
+		case opPing:
+			c.writeFrame(opPong, payload)
+		case opClose:
+			code := uint16(closeNormal)
+			if len(payload) >= 2 {
+				code = binary.BigEndian.Uint16(payload)
+			}
+			c.writeClose(code, "")
+			return
+		case opText, opBinary, opContinuation, opPong:
+		default:
+			c.writeClose(closeProtocolError, "unknown opcode")
+			return
+		}
+	}
+}
+
+// serveWebSocket takes over the connection and sends each event as a text message with its
+// JSON representation. A subscriber that falls behind is closed with 1013 and resumes by
+// reconnecting with since.
+func (h *Handler) serveWebSocket(w http.ResponseWriter, r *http.Request, sub *internal.Subscription) {
+	netConn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer netConn.Close()
+	netConn.SetDeadline(time.Time{})
+
+	c := &wsConn{conn: netConn, writer: rw.Writer}
+	c.mu.Lock()
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+	err = rw.Flush()
+	c.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		c.readFrames(rw.Reader)
+	}()
+
+	// closeWith sends a close frame and waits a little for the client's
+	closeWith := func(code uint16, reason string) {
+		if c.writeClose(code, reason) == nil {
+			netConn.SetReadDeadline(time.Now().Add(closeTimeout))
+			<-readDone
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				closeWith(closeTryAgainLater, "subscriber too slow")
+				return
+			}
+			data, _ := json.Marshal(e)
+			if err := c.writeFrame(opText, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := c.writeFrame(opPing, nil); err != nil {
+				return
+			}
+		case <-readDone:
+			return
+		case <-h.done:
+			closeWith(closeGoingAway, "server shutting down")
+			return
+		}
+	}
+}
@@ -0,0 +1,709 @@
+// internal/ftp/server.go
+
+// Package ftp serves the virtual file system over FTP (RFC 959) in passive mode.
+// A session logs in as a registered user with one of their API tokens as the password, and
+// the user's folders are the directories of the root. Read tokens can't change anything, and
+// tokens restricted to a folder only see that folder.
+// Files have no content besides their description, so downloading a file returns its
+// description and uploading a file replaces it.
+package ftp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// maxUploadSize limits the size of uploads, and so of descriptions
+const maxUploadSize = 1 << 20
+
+// dataTimeout is how long a passive listener waits for the client to connect
+const dataTimeout = 10 * time.Second
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("FTP server closed")
+
+// Server serves FTP connections. Each connection is a separate session.
+type Server struct {
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+}
+
+// NewServer returns a server of the virtual file system
+func NewServer() *Server {
+	return &Server{listeners: map[net.Listener]struct{}{}, conns: map[net.Conn]struct{}{}}
+}
+
+// Serve accepts connections on l until Close, serving each one in its own goroutine
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+// ServeConn serves a single control connection until QUIT, a hang-up or Close
+func (s *Server) ServeConn(c net.Conn) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		c.Close()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	sess := &session{conn: c, writer: bufio.NewWriter(c), cwd: "/"}
+	defer sess.closePassive()
+	sess.reply(220, "Virtual file system FTP server ready.")
+	scanner := bufio.NewScanner(c)
+	for scanner.Scan() {
+		command, arg, _ := strings.Cut(strings.TrimRight(scanner.Text(), "\r"), " ")
+		if !sess.handle(strings.ToUpper(command), arg) {
+			return
+		}
+	}
+}
+
+// Close stops the listeners and hangs up every connection
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if closeErr := l.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return err
+}
+
+// session is the state of a control connection
+type session struct {
+	conn       net.Conn
+	writer     *bufio.Writer
+	user       string
+	token      *internal.Token
+	pending    string // USER given, waiting for PASS
+	cwd        string
+	passive    net.Listener
+	renameFrom string
+}
+
+// reply sends a reply, splitting a multi-line text as RFC 959 requires
+func (s *session) reply(code int, text string) {
+	lines := strings.Split(text, "\n")
+	for _, line := range lines[:len(lines)-1] {
+		fmt.Fprintf(s.writer, "%d-%s\r\n", code, line)
+	}
+	fmt.Fprintf(s.writer, "%d %s\r\n", code, lines[len(lines)-1])
+	s.writer.Flush()
+}
+
+// replyError sends the error of an internal operation as a 550
+func (s *session) replyError(err error) {
+	s.reply(550, err.Error())
+}
+
+// writeCommands are the commands a read token can't run
+var writeCommands = map[string]bool{
+	"STOR": true, "MKD": true, "XMKD": true, "RMD": true, "XRMD": true, "DELE": true, "RNFR": true, "RNTO": true,
+}
+
+// commandsBeforeLogin are the commands allowed before logging in
+var commandsBeforeLogin = map[string]bool{
+	"USER": true, "PASS": true, "QUIT": true, "NOOP": true, "SYST": true, "FEAT": true, "OPTS": true,
+}
+
+// handle runs a command and reports whether the session goes on
+func (s *session) handle(command, arg string) bool {
+	if s.user == "" && !commandsBeforeLogin[command] {
+		s.reply(530, "Please log in with USER and PASS.")
+		return true
+	}
+	if command != "RNTO" && command != "RNFR" {
+		s.renameFrom = ""
+	}
+	if s.user != "" && writeCommands[command] && s.token.Scope != internal.ScopeWrite {
+		s.reply(550, "The token is read-only.")
+		return true
+	}
+
+	switch command {
+	case "USER":
+		s.login(arg)
+	case "PASS":
+		s.password(arg)
+	case "QUIT":
+		s.reply(221, "Goodbye.")
+		return false
+	case "NOOP":
+		s.reply(200, "OK.")
+	case "SYST":
+		s.reply(215, "UNIX Type: L8")
+	case "FEAT":
+		s.reply(211, "Features:\n EPSV\n MDTM\n MLST type*;size*;modify*;\n PASV\n SIZE\n UTF8\nEnd")
+	case "OPTS":
+		if strings.EqualFold(arg, "UTF8 ON") {
+			s.reply(200, "UTF8 is always on.")
+		} else {
+			s.reply(501, "Unknown option.")
+		}
+	case "TYPE":
+		s.reply(200, "Type set to "+arg+".")
+	case "MODE", "STRU":
+		if strings.EqualFold(arg, "S") || strings.EqualFold(arg, "F") {
+			s.reply(200, "OK.")
+		} else {
+			s.reply(504, "Only stream mode and file structure are supported.")
+		}
+	case "PWD", "XPWD":
+		s.reply(257, quotePath(s.cwd)+" is the current directory.")
+	case "CWD", "XCWD":
+		s.changeDir(arg)
+	case "CDUP", "XCUP":
+		s.changeDir("..")
+	case "PASV":
+		s.enterPassive(false)
+	case "EPSV":
+		s.enterPassive(true)
+	case "PORT", "EPRT":
+		s.reply(502, "Active mode isn't supported, use PASV or EPSV.")
+	case "LIST", "NLST", "MLSD":
+		s.list(command, arg)
+	case "MLST":
+		s.mlst(arg)
+	case "RETR":
+		s.retrieve(arg)
+	case "STOR":
+		s.store(arg)
+	case "MKD", "XMKD":
+		s.makeDir(arg)
+	case "RMD", "XRMD":
+		s.removeDir(arg)
+	case "DELE":
+		s.deleteFile(arg)
+	case "RNFR":
+		s.renameFromPath(arg)
+	case "RNTO":
+		s.renameTo(arg)
+	case "SIZE":
+		s.size(arg)
+	case "MDTM":
+		s.modTime(arg)
+	default:
+		s.reply(502, "Command "+command+" isn't implemented.")
+	}
+	return true
+}
+
+// login remembers the username until PASS
+func (s *session) login(username string) {
+	if username == "" {
+		s.reply(501, "Usage: USER username")
+		return
+	}
+	username = internal.NormalizeName(username)
+	s.user, s.token, s.pending = "", nil, username
+	s.reply(331, "Token required for "+username+".")
+}
+
+// password logs in as the user given by USER when the password is one of their API tokens
+func (s *session) password(password string) {
+	if s.pending == "" {
+		s.reply(503, "Send USER first.")
+		return
+	}
+	username := s.pending
+	s.pending = ""
+	owner, token, err := internal.Authenticate(password)
+	if err != nil || owner != username {
+		s.reply(530, "Login incorrect.")
+		return
+	}
+	s.user, s.token, s.cwd = username, token, "/"
+	s.reply(230, "User "+username+" logged in.")
+}
+
+// quotePath quotes a path for a 257 reply, doubling its quotes
+func quotePath(p string) string {
+	return `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+}
+
+// entry is a folder or file a path points to
+type entry struct {
+	path   string
+	folder string
+	file   string
+}
+
+// isRoot, isFolder and isFile tell the kind of the entry
+func (e entry) isRoot() bool   { return e.folder == "" }
+func (e entry) isFolder() bool { return e.folder != "" && e.file == "" }
+func (e entry) isFile() bool   { return e.file != "" }
+
+var errNoSuchPath = errors.New("No such file or directory.")
+
+// resolve turns a path relative to the current directory into an entry
+func (s *session) resolve(arg string) (entry, error) {
+	p := path.Clean(path.Join(s.cwd, arg))
+	if path.IsAbs(arg) {
+		p = path.Clean(arg)
+	}
+	// Folders and files are matched like in the REPL
+	p = internal.NormalizeName(p)
+	names := strings.Split(strings.Trim(p, "/"), "/")
+	e := entry{path: p}
+	switch {
+	case p == "/":
+	case len(names) == 1:
+		e.folder = names[0]
+	case len(names) == 2:
+		e.folder, e.file = names[0], names[1]
+	default:
+		return entry{}, errNoSuchPath
+	}
+	if s.token.Folder != "" && !e.isRoot() && e.folder != s.token.Folder {
+		return entry{}, fmt.Errorf("The token is restricted to the folder %s.", internal.QuoteIfNeeded(s.token.Folder))
+	}
+	return e, nil
+}
+
+// info is what listings show of a folder or file
+type info struct {
+	name      string
+	dir       bool
+	size      int
+	createdAt time.Time
+}
+
+// stat returns the info of an existing entry
+func (s *session) stat(e entry) (info, error) {
+	switch {
+	case e.isRoot():
+		return info{name: "/", dir: true}, nil
+	case e.isFolder():
+		folder, err := internal.GetFolder(s.user, e.folder)
+		if err != nil {
+			return info{}, err
+		}
+		return info{name: folder.Name, dir: true, createdAt: folder.CreatedAt}, nil
+	}
+	file, err := internal.GetFile(s.user, e.folder, e.file)
+	if err != nil {
+		return info{}, err
+	}
+	return info{name: file.Name, size: len(file.Description), createdAt: file.CreatedAt}, nil
+}
+
+// readDir returns the infos of the entries of a directory
+func (s *session) readDir(e entry) ([]info, error) {
+	var result []info
+	if e.isRoot() {
+		folders, err := internal.ListFolders(s.user, "name", "asc")
+		if err != nil {
+			return nil, err
+		}
+		for _, folder := range folders {
+			if s.token.Folder != "" && folder.Name != s.token.Folder {
+				continue
+			}
+			result = append(result, info{name: folder.Name, dir: true, createdAt: folder.CreatedAt})
+		}
+		return result, nil
+	}
+	files, err := internal.ListFiles(s.user, e.folder, "name", "asc")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		result = append(result, info{name: file.Name, size: len(file.Description), createdAt: file.CreatedAt})
+	}
+	return result, nil
+}
+
+func (s *session) changeDir(arg string) {
+	e, err := s.resolve(arg)
+	if err == nil && e.isFile() {
+		err = errors.New("Not a directory.")
+	}
+	if err == nil {
+		_, err = s.stat(e)
+	}
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	s.cwd = e.path
+	s.reply(250, "Directory changed to "+e.path+".")
+}
+
+// enterPassive listens for the data connection of the next transfer, on the address the
+// client reached the server on
+func (s *session) enterPassive(extended bool) {
+	s.closePassive()
+	host, _, _ := net.SplitHostPort(s.conn.LocalAddr().String())
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		s.reply(425, "Can't open a data connection.")
+		return
+	}
+	s.passive = listener
+	port := listener.Addr().(*net.TCPAddr).Port
+	if extended {
+		s.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+		return
+	}
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		s.closePassive()
+		s.reply(425, "PASV needs IPv4, use EPSV.")
+		return
+	}
+	s.reply(227, fmt.Sprintf("Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff))
+}
+
+// closePassive stops listening for a data connection
+func (s *session) closePassive() {
+	if s.passive != nil {
+		s.passive.Close()
+		s.passive = nil
+	}
+}
+
+// openData accepts the data connection of a transfer. Only the client of the control
+// connection may connect.
+func (s *session) openData() (net.Conn, error) {
+	if s.passive == nil {
+		return nil, errors.New("Use PASV or EPSV first.")
+	}
+	listener := s.passive
+	s.passive = nil
+	defer listener.Close()
+
+	s.reply(150, "Opening data connection.")
+	if tcp, ok := listener.(*net.TCPListener); ok {
+		tcp.SetDeadline(time.Now().Add(dataTimeout))
+	}
+	controlHost, _, _ := net.SplitHostPort(s.conn.RemoteAddr().String())
+	for {
+		c, err := listener.Accept()
+		if err != nil {
+			return nil, errors.New("Can't open the data connection.")
+		}
+		if host, _, _ := net.SplitHostPort(c.RemoteAddr().String()); host == controlHost {
+			return c, nil
+		}
+		c.Close()
+	}
+}
+
+// transfer sends or receives data over the data connection, then replies with the outcome
+func (s *session) transfer(send func(io.Writer) error, receive func(io.Reader) error) {
+	data, err := s.openData()
+	if err != nil {
+		s.reply(425, err.Error())
+		return
+	}
+	if send != nil {
+		err = send(data)
+	} else {
+		err = receive(data)
+	}
+	if closeErr := data.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.reply(451, err.Error())
+		return
+	}
+	s.reply(226, "Transfer complete.")
+}
+
+// listLine formats an entry like ls -l
+func listLine(i info, owner string) string {
+	mode := "-rw-r--r--"
+	if i.dir {
+		mode = "drwxr-xr-x"
+	}
+	stamp := i.createdAt.UTC().Format("Jan _2 15:04")
+	if time.Since(i.createdAt) > 180*24*time.Hour {
+		stamp = i.createdAt.UTC().Format("Jan _2  2006")
+	}
+	return fmt.Sprintf("%s 1 %s %s %d %s %s", mode, owner, owner, i.size, stamp, i.name)
+}
+
+// factsLine formats an entry for MLSD and MLST
+func factsLine(i info, name string) string {
+	facts := "type=file;size=" + strconv.Itoa(i.size) + ";"
+	if i.dir {
+		facts = "type=dir;"
+	}
+	if !i.createdAt.IsZero() {
+		facts += "modify=" + i.createdAt.UTC().Format("20060102150405") + ";"
+	}
+	return facts + " " + name
+}
+
+// list sends the entries of a directory, or a single file, for LIST, NLST and MLSD
+func (s *session) list(command, arg string) {
+	// Options of ls like -la are ignored
+	if strings.HasPrefix(arg, "-") {
+		_, arg, _ = strings.Cut(arg, " ")
+	}
+	e, err := s.resolve(arg)
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	i, err := s.stat(e)
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	entries := []info{i}
+	if i.dir {
+		if entries, err = s.readDir(e); err != nil {
+			s.replyError(err)
+			return
+		}
+	} else if command == "MLSD" {
+		s.reply(501, "Not a directory.")
+		return
+	}
+
+	s.transfer(func(w io.Writer) error {
+		for _, i := range entries {
+			var line string
+			switch command {
+			case "LIST":
+				line = listLine(i, s.user)
+			case "NLST":
+				line = i.name
+			case "MLSD":
+				line = factsLine(i, i.name)
+			}
+			if _, err := io.WriteString(w, line+"\r\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// mlst describes a single entry over the control connection
+func (s *session) mlst(arg string) {
+	e, err := s.resolve(arg)
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	i, err := s.stat(e)
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	s.reply(250, "Listing "+e.path+"\n "+factsLine(i, e.path)+"\nEnd")
+}
+
+// file resolves the path of an existing file
+func (s *session) file(arg string) (entry, *internal.File, error) {
+	e, err := s.resolve(arg)
+	if err == nil && !e.isFile() {
+		err = errors.New("Not a file.")
+	}
+	if err != nil {
+		return entry{}, nil, err
+	}
+	file, err := internal.GetFile(s.user, e.folder, e.file)
+	return e, file, err
+}
+
+func (s *session) retrieve(arg string) {
+	_, file, err := s.file(arg)
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	s.transfer(func(w io.Writer) error {
+		_, err := io.WriteString(w, file.Description)
+		return err
+	}, nil)
+}
+
+// store creates a file with the uploaded description, or replaces the description
+func (s *session) store(arg string) {
+	e, err := s.resolve(arg)
+	if err == nil && !e.isFile() {
+		err = errors.New("Files can only be stored in folders.")
+	}
+	if err == nil {
+		_, err = internal.GetFolder(s.user, e.folder)
+	}
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	s.transfer(nil, func(r io.Reader) error {
+		data, err := io.ReadAll(io.LimitReader(r, maxUploadSize+1))
+		if err != nil {
+			return err
+		}
+		if len(data) > maxUploadSize {
+			return fmt.Errorf("Files are limited to %d bytes.", maxUploadSize)
+		}
+		err = internal.SetFileDescription(s.user, e.folder, e.file, string(data))
+		if errors.Is(err, internal.ErrNotFound) {
+			err = internal.CreateFile(s.user, e.folder, e.file, string(data))
+		}
+		return err
+	})
+}
+
+func (s *session) makeDir(arg string) {
+	e, err := s.resolve(arg)
+	if err == nil && !e.isFolder() {
+		err = errors.New("Directories can only be made in the root.")
+	}
+	if err == nil {
+		err = internal.CreateFolder(s.user, e.folder, "")
+	}
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	s.reply(257, quotePath(e.path)+" created.")
+}
+
+func (s *session) removeDir(arg string) {
+	e, err := s.resolve(arg)
+	if err == nil && !e.isFolder() {
+		err = errors.New("Not a folder.")
+	}
+	if err == nil {
+		err = internal.DeleteFolder(s.user, e.folder)
+	}
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	if s.cwd == e.path {
+		s.cwd = "/"
+	}
+	s.reply(250, "Removed "+e.path+".")
+}
+
+func (s *session) deleteFile(arg string) {
+	e, _, err := s.file(arg)
+	if err == nil {
+		err = internal.DeleteFile(s.user, e.folder, e.file)
+	}
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	s.reply(250, "Deleted "+e.path+".")
+}
+
+// renameFromPath remembers the path to rename by the following RNTO
+func (s *session) renameFromPath(arg string) {
+	e, err := s.resolve(arg)
+	if err == nil && e.isRoot() {
+		err = errors.New("The root can't be renamed.")
+	}
+	if err == nil {
+		_, err = s.stat(e)
+	}
+	if err != nil {
+		s.renameFrom = ""
+		s.replyError(err)
+		return
+	}
+	s.renameFrom = e.path
+	s.reply(350, "Ready for RNTO.")
+}
+
+// renameTo renames a folder, or moves a file to another name or folder
+func (s *session) renameTo(arg string) {
+	if s.renameFrom == "" {
+		s.reply(503, "Send RNFR first.")
+		return
+	}
+	from, _ := s.resolve(s.renameFrom)
+	s.renameFrom = ""
+	to, err := s.resolve(arg)
+	if err == nil && from.isFolder() != to.isFolder() {
+		err = errors.New("A folder can only become a folder, and a file a file.")
+	}
+	if err == nil {
+		if from.isFolder() {
+			err = internal.RenameFolder(s.user, from.folder, to.folder)
+		} else {
+			err = internal.MoveFile(s.user, from.folder, from.file, to.folder, to.file)
+		}
+	}
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	if s.cwd == from.path {
+		s.cwd = to.path
+	}
+	s.reply(250, "Renamed "+from.path+" to "+to.path+".")
+}
+
+func (s *session) size(arg string) {
+	_, file, err := s.file(arg)
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	s.reply(213, strconv.Itoa(len(file.Description)))
+}
+
+func (s *session) modTime(arg string) {
+	_, file, err := s.file(arg)
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	s.reply(213, file.CreatedAt.UTC().Format("20060102150405"))
+}
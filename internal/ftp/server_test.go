@@ -0,0 +1,291 @@
+// internal/ftp/server_test.go
+package ftp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+// client is a minimal FTP client speaking to the server on loopback
+type client struct {
+	t    *testing.T
+	conn *textproto.Conn
+}
+
+// newClient starts a server on loopback and connects to it
+func newClient(t *testing.T) *client {
+	t.Helper()
+	internal.UseMockData(make(map[string]*internal.User))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer()
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := textproto.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &client{t: t, conn: conn}
+	if code, _ := c.readReply(); code != 220 {
+		t.Fatalf("expected a 220 greeting but got %d", code)
+	}
+	return c
+}
+
+// readReply reads a reply, joining the lines of multi-line replies
+func (c *client) readReply() (int, string) {
+	c.t.Helper()
+	code, message, err := c.conn.ReadResponse(0)
+	var protoErr *textproto.Error
+	if err != nil && !errors.As(err, &protoErr) {
+		c.t.Fatal(err)
+	}
+	return code, message
+}
+
+// cmd sends a command and returns its reply
+func (c *client) cmd(format string, args ...any) (int, string) {
+	c.t.Helper()
+	if err := c.conn.PrintfLine(format, args...); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.readReply()
+}
+
+// expect sends a command and fails the test unless the reply has the code
+func (c *client) expect(code int, format string, args ...any) string {
+	c.t.Helper()
+	got, message := c.cmd(format, args...)
+	if got != code {
+		c.t.Fatalf("%s: expected %d but got %d %s", strings.SplitN(format, " ", 2)[0], code, got, message)
+	}
+	return message
+}
+
+// login logs in as username with a new write token
+func (c *client) login(username string) {
+	c.t.Helper()
+	token, _, err := internal.CreateToken(strings.ToLower(username), internal.ScopeWrite, "", 0)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.expect(331, "USER %s", username)
+	c.expect(230, "PASS %s", token)
+}
+
+var pasvReply = regexp.MustCompile(`\((\d+),(\d+),(\d+),(\d+),(\d+),(\d+)\)`)
+
+// dial enters passive mode and connects to the data port
+func (c *client) dial() net.Conn {
+	c.t.Helper()
+	m := pasvReply.FindStringSubmatch(c.expect(227, "PASV"))
+	if m == nil {
+		c.t.Fatal("no address in the PASV reply")
+	}
+	p1, _ := strconv.Atoi(m[5])
+	p2, _ := strconv.Atoi(m[6])
+	data, err := net.Dial("tcp", net.JoinHostPort(strings.Join(m[1:5], "."), strconv.Itoa(p1<<8|p2)))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return data
+}
+
+// download runs a command sending data, like LIST or RETR, and returns the data
+func (c *client) download(format string, args ...any) string {
+	c.t.Helper()
+	data := c.dial()
+	defer data.Close()
+	c.expect(150, format, args...)
+	b, err := io.ReadAll(data)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if code, message := c.readReply(); code != 226 {
+		c.t.Fatalf("expected 226 but got %d %s", code, message)
+	}
+	return string(b)
+}
+
+// upload runs STOR with the content
+func (c *client) upload(name, content string) (int, string) {
+	c.t.Helper()
+	data := c.dial()
+	c.expect(150, "STOR %s", name)
+	io.WriteString(data, content)
+	data.Close()
+	return c.readReply()
+}
+
+func TestServer(t *testing.T) {
+	c := newClient(t)
+	internal.RegisterUser("alice")
+
+	c.expect(530, "PWD")
+	c.login("Alice")
+	c.expect(257, "PWD")
+	c.expect(257, "MKD docs")
+	c.expect(257, "MKD /Photos")
+	c.expect(250, "CWD docs")
+	if message := c.expect(257, "PWD"); message != `"/docs" is the current directory.` {
+		t.Errorf("expected /docs to be the current directory but got %s", message)
+	}
+
+	if code, message := c.upload("notes", "hello world"); code != 226 {
+		t.Fatalf("expected the upload to succeed but got %d %s", code, message)
+	}
+	if file, err := internal.GetFile("alice", "docs", "notes"); err != nil || file.Description != "hello world" {
+		t.Errorf("expected notes to hold hello world but got %+v, %v", file, err)
+	}
+	if code, _ := c.upload("notes", "replaced"); code != 226 {
+		t.Errorf("expected the upload to replace notes")
+	}
+	if content := c.download("RETR notes"); content != "replaced" {
+		t.Errorf("expected replaced but got %q", content)
+	}
+	if size := c.expect(213, "SIZE /docs/notes"); size != "8" {
+		t.Errorf("expected size 8 but got %s", size)
+	}
+
+	if names := c.download("NLST"); names != "notes\r\n" {
+		t.Errorf("expected NLST to list notes but got %q", names)
+	}
+	if listing := c.download("LIST -la /"); !strings.HasPrefix(listing, "drwxr-xr-x 1 alice alice 0 ") || !strings.HasSuffix(listing, " photos\r\n") {
+		t.Errorf("unexpected LIST output %q", listing)
+	}
+	if facts := c.download("MLSD"); !strings.HasPrefix(facts, "type=file;size=8;modify=") || !strings.HasSuffix(facts, "; notes\r\n") {
+		t.Errorf("unexpected MLSD output %q", facts)
+	}
+	if message := c.expect(250, "MLST notes"); !strings.Contains(message, "type=file;size=8;") || !strings.Contains(message, "; /docs/notes") {
+		t.Errorf("unexpected MLST output %q", message)
+	}
+
+	// Renaming a file into another folder, then the folder
+	c.expect(350, "RNFR notes")
+	c.expect(250, "RNTO /photos/moved")
+	c.expect(350, "RNFR /photos")
+	c.expect(250, "RNTO /pictures")
+	if file, err := internal.GetFile("alice", "pictures", "moved"); err != nil || file.Description != "replaced" {
+		t.Errorf("expected pictures/moved to hold replaced but got %+v, %v", file, err)
+	}
+
+	c.expect(250, "CDUP")
+	c.expect(250, "DELE pictures/moved")
+	c.expect(250, "RMD pictures")
+	if names := c.download("NLST"); names != "docs\r\n" {
+		t.Errorf("expected only docs to be left but got %q", names)
+	}
+	c.expect(221, "QUIT")
+}
+
+func TestServerErrors(t *testing.T) {
+	c := newClient(t)
+	internal.RegisterUser("alice")
+	internal.CreateFolder("alice", "docs", "")
+
+	c.expect(331, "USER bob")
+	c.expect(530, "PASS secret")
+	c.expect(503, "PASS secret")
+	c.login("alice")
+
+	tests := []struct {
+		command  string
+		code     int
+		expected string
+	}{
+		{"CWD nothing", 550, "The nothing doesn't exist."},
+		{"MKD docs", 550, "The docs has already existed."},
+		{"MKD bad.name", 550, "The bad.name contains invalid chars."},
+		{"MKD docs/sub", 550, "Directories can only be made in the root."},
+		{"RMD /", 550, "Not a folder."},
+		{"DELE docs/missing", 550, "The missing doesn't exist."},
+		{"RETR docs", 550, "Not a file."},
+		{"SIZE a/b/c", 550, "No such file or directory."},
+		{"RNTO docs", 503, "Send RNFR first."},
+		{"RNFR missing", 550, "The missing doesn't exist."},
+		{"LIST", 425, "Use PASV or EPSV first."},
+		{"PORT 127,0,0,1,4,1", 502, "Active mode isn't supported, use PASV or EPSV."},
+		{"SITE CHMOD 777 docs", 502, "Command SITE isn't implemented."},
+	}
+
+	for _, tt := range tests {
+		code, message := c.cmd(tt.command)
+		if code == 150 {
+			code, message = c.readReply()
+		}
+		if code != tt.code || message != tt.expected {
+			t.Errorf("%s: expected %d %s but got %d %s", tt.command, tt.code, tt.expected, code, message)
+		}
+	}
+
+	// STOR needs an existing folder
+	c.expect(550, "STOR nothing/file")
+	if code, message := c.upload("docs/x", strings.Repeat("x", maxUploadSize+1)); code != 451 {
+		t.Errorf("expected an oversized upload to fail but got %d %s", code, message)
+	}
+}
+
+func TestServerTokens(t *testing.T) {
+	c := newClient(t)
+	internal.RegisterUser("alice")
+	internal.RegisterUser("bob")
+	internal.CreateFolder("alice", "docs", "")
+	internal.CreateFolder("alice", "photos", "")
+	bobs, _, _ := internal.CreateToken("bob", internal.ScopeWrite, "", 0)
+	read, _, _ := internal.CreateToken("alice", internal.ScopeRead, "docs", 0)
+
+	c.expect(331, "USER alice")
+	c.expect(530, "PASS %s", bobs)
+	c.expect(331, "USER alice")
+	c.expect(230, "PASS %s", read)
+
+	if names := c.download("NLST /"); names != "docs\r\n" {
+		t.Errorf("expected only docs to be listed but got %q", names)
+	}
+	c.expect(250, "CWD docs")
+	if code, message := c.cmd("CWD /photos"); code != 550 || message != "The token is restricted to the folder docs." {
+		t.Errorf("expected photos to be out of reach but got %d %s", code, message)
+	}
+	if code, message := c.cmd("MKD /music"); code != 550 || message != "The token is read-only." {
+		t.Errorf("expected MKD to be refused but got %d %s", code, message)
+	}
+	if code, message := c.cmd("STOR notes"); code != 550 || message != "The token is read-only." {
+		t.Errorf("expected STOR to be refused but got %d %s", code, message)
+	}
+}
+
+func TestServerEPSV(t *testing.T) {
+	c := newClient(t)
+	internal.RegisterUser("alice")
+	internal.CreateFolder("alice", "docs", "")
+	c.login("alice")
+
+	message := c.expect(229, "EPSV")
+	port := regexp.MustCompile(`\(\|\|\|(\d+)\|\)`).FindStringSubmatch(message)
+	if port == nil {
+		t.Fatalf("no port in the EPSV reply %q", message)
+	}
+	data, err := net.Dial("tcp", "127.0.0.1:"+port[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+	c.expect(150, "NLST")
+	if names, _ := io.ReadAll(data); string(names) != "docs\r\n" {
+		t.Errorf("expected docs but got %q", names)
+	}
+	if code, message := c.readReply(); code != 226 {
+		t.Errorf("expected 226 but got %d %s", code, message)
+	}
+}
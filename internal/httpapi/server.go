@@ -0,0 +1,416 @@
+// internal/httpapi/server.go
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// maxBodySize limits the size of request bodies
+const maxBodySize = 1 << 20
+
+// folderJSON is the representation of a folder in responses
+type folderJSON struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// fileJSON is the representation of a file in responses
+type fileJSON struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// userJSON is the representation of a user in responses
+type userJSON struct {
+	Username string `json:"username"`
+}
+
+// createRequest is the body of the POST requests. Users are created from Username,
+// folders and files from Name and Description.
+type createRequest struct {
+	Username    string `json:"username"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// renameRequest is the body of PATCH /users/{u}/folders/{f}
+type renameRequest struct {
+	Name string `json:"name"`
+}
+
+// NewHandler returns the handler of the REST API:
+//
+//	GET    /users
+//	POST   /users                                   {"username": "..."}
+//	GET    /users/{u}
+//	GET    /users/{u}/folders                       ?sort=&order=&reverse=&name=&name_regex=&description=&created_after=&created_before=&offset=&limit=
+//	POST   /users/{u}/folders                       {"name": "...", "description": "..."}
+//	GET    /users/{u}/folders/{f}
+//	PATCH  /users/{u}/folders/{f}                   {"name": "..."}
+//	DELETE /users/{u}/folders/{f}
+//	GET    /users/{u}/folders/{f}/files             same query as the folders
+//	POST   /users/{u}/folders/{f}/files             {"name": "...", "description": "..."}
+//	GET    /users/{u}/folders/{f}/files/{name}
+//	DELETE /users/{u}/folders/{f}/files/{name}
+func NewHandler() http.Handler {
+	return http.HandlerFunc(route)
+}
+
+// route dispatches a request on the segments of its path
+func route(w http.ResponseWriter, r *http.Request) {
+	segments, err := pathSegments(r.URL)
+	if err != nil || len(segments) == 0 || segments[0] != "users" {
+		WriteError(w, http.StatusNotFound, "not_found", "No such resource.")
+		return
+	}
+	names := segments[1:]
+	// Names in paths and bodies are stored the way the REPL stores them
+	for i := range names {
+		names[i] = internal.NormalizeName(names[i])
+	}
+
+	switch {
+	case len(names) == 0:
+		handleUsers(w, r)
+	case len(names) == 1:
+		handleUser(w, r, names[0])
+	case len(names) == 2 && names[1] == "folders":
+		handleFolders(w, r, names[0])
+	case len(names) == 3 && names[1] == "folders":
+		handleFolder(w, r, names[0], names[2])
+	case len(names) == 4 && names[1] == "folders" && names[3] == "files":
+		handleFiles(w, r, names[0], names[2])
+	case len(names) == 5 && names[1] == "folders" && names[3] == "files":
+		handleFile(w, r, names[0], names[2], names[4])
+	default:
+		WriteError(w, http.StatusNotFound, "not_found", "No such resource.")
+	}
+}
+
+// pathSegments splits the escaped path into its unescaped segments, so names can contain
+// escaped characters like %20
+func pathSegments(u *url.URL) ([]string, error) {
+	path := strings.Trim(u.EscapedPath(), "/")
+	if path == "" {
+		return nil, nil
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments[i] = unescaped
+	}
+	return segments, nil
+}
+
+func handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users := []userJSON{}
+		for _, username := range internal.ListUsers() {
+			users = append(users, userJSON{username})
+		}
+		writeJSON(w, http.StatusOK, users)
+	case http.MethodPost:
+		var body createRequest
+		if !readJSON(w, r, &body) {
+			return
+		}
+		username := internal.NormalizeName(body.Username)
+		if err := internal.RegisterUser(username); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/users/"+url.PathEscape(username))
+		writeJSON(w, http.StatusCreated, userJSON{username})
+	default:
+		methodNotAllowed(w, "GET, POST")
+	}
+}
+
+func handleUser(w http.ResponseWriter, r *http.Request, username string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	user, err := internal.GetUser(username)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, userJSON{user.Username})
+}
+
+func handleFolders(w http.ResponseWriter, r *http.Request, username string) {
+	switch r.Method {
+	case http.MethodGet:
+		query, err := parseQuery(r.URL.Query())
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid_query", err.Error())
+			return
+		}
+		folders, total, err := internal.QueryFolders(username, query)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		result := make([]folderJSON, len(folders))
+		for i, folder := range folders {
+			result[i] = folderJSON{folder.Name, folder.Description, folder.CreatedAt}
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		writeJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		var body createRequest
+		if !readJSON(w, r, &body) {
+			return
+		}
+		foldername := internal.NormalizeName(body.Name)
+		if err := internal.CreateFolder(username, foldername, body.Description); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		respondFolder(w, http.StatusCreated, username, foldername)
+	default:
+		methodNotAllowed(w, "GET, POST")
+	}
+}
+
+func handleFolder(w http.ResponseWriter, r *http.Request, username, foldername string) {
+	switch r.Method {
+	case http.MethodGet:
+		respondFolder(w, http.StatusOK, username, foldername)
+	case http.MethodPatch:
+		var body renameRequest
+		if !readJSON(w, r, &body) {
+			return
+		}
+		newName := internal.NormalizeName(body.Name)
+		if err := internal.RenameFolder(username, foldername, newName); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		respondFolder(w, http.StatusOK, username, newName)
+	case http.MethodDelete:
+		if err := internal.DeleteFolder(username, foldername); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, "GET, PATCH, DELETE")
+	}
+}
+
+func handleFiles(w http.ResponseWriter, r *http.Request, username, foldername string) {
+	switch r.Method {
+	case http.MethodGet:
+		query, err := parseQuery(r.URL.Query())
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid_query", err.Error())
+			return
+		}
+		files, total, err := internal.QueryFiles(username, foldername, query)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		result := make([]fileJSON, len(files))
+		for i, file := range files {
+			result[i] = fileJSON{file.Name, file.Description, file.CreatedAt}
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		writeJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		var body createRequest
+		if !readJSON(w, r, &body) {
+			return
+		}
+		filename := internal.NormalizeName(body.Name)
+		if err := internal.CreateFile(username, foldername, filename, body.Description); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		respondFile(w, http.StatusCreated, username, foldername, filename)
+	default:
+		methodNotAllowed(w, "GET, POST")
+	}
+}
+
+func handleFile(w http.ResponseWriter, r *http.Request, username, foldername, filename string) {
+	switch r.Method {
+	case http.MethodGet:
+		respondFile(w, http.StatusOK, username, foldername, filename)
+	case http.MethodDelete:
+		if err := internal.DeleteFile(username, foldername, filename); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, "GET, DELETE")
+	}
+}
+
+// respondFolder writes the current state of a folder
+func respondFolder(w http.ResponseWriter, status int, username, foldername string) {
+	folder, err := internal.GetFolder(username, foldername)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if status == http.StatusCreated {
+		w.Header().Set("Location", "/users/"+url.PathEscape(username)+"/folders/"+url.PathEscape(foldername))
+	}
+	writeJSON(w, status, folderJSON{folder.Name, folder.Description, folder.CreatedAt})
+}
+
+// respondFile writes the current state of a file
+func respondFile(w http.ResponseWriter, status int, username, foldername, filename string) {
+	file, err := internal.GetFile(username, foldername, filename)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if status == http.StatusCreated {
+		w.Header().Set("Location", "/users/"+url.PathEscape(username)+"/folders/"+url.PathEscape(foldername)+"/files/"+url.PathEscape(filename))
+	}
+	writeJSON(w, status, fileJSON{file.Name, file.Description, file.CreatedAt})
+}
+
+// parseQuery reads the sorting, filters and paging of a listing from the query string
+func parseQuery(values url.Values) (internal.Query, error) {
+	query := internal.Query{
+		Sort:        values.Get("sort"),
+		Order:       values.Get("order"),
+		Name:        values.Get("name"),
+		NameRegexp:  values.Get("name_regex"),
+		Description: values.Get("description"),
+	}
+	if internal.CaseInsensitive {
+		query.Name = strings.ToLower(query.Name)
+		if query.NameRegexp != "" {
+			query.NameRegexp = "(?i)" + query.NameRegexp
+		}
+	}
+
+	var err error
+	if value := values.Get("reverse"); value != "" {
+		if query.Reverse, err = strconv.ParseBool(value); err != nil {
+			return query, fmt.Errorf("Invalid reverse %q, expected true or false", value)
+		}
+	}
+	for _, param := range []struct {
+		name   string
+		target *time.Time
+	}{
+		{"created_after", &query.CreatedAfter},
+		{"created_before", &query.CreatedBefore},
+	} {
+		if value := values.Get(param.name); value != "" {
+			if *param.target, err = time.Parse(time.RFC3339, value); err != nil {
+				return query, fmt.Errorf("Invalid %s %q, expected an RFC 3339 time", param.name, value)
+			}
+		}
+	}
+	for _, param := range []struct {
+		name   string
+		target *int
+	}{
+		{"offset", &query.Offset},
+		{"limit", &query.Limit},
+	} {
+		if value := values.Get(param.name); value != "" {
+			if *param.target, err = strconv.Atoi(value); err != nil {
+				return query, fmt.Errorf("Invalid %s %q, expected a number", param.name, value)
+			}
+		}
+	}
+	return query, nil
+}
+
+// readJSON decodes the request body into v, writing a 400 response when it can't
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteError(w, http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("The body is larger than %d bytes.", tooLarge.Limit))
+			return false
+		}
+		WriteError(w, http.StatusBadRequest, "invalid_body", "Invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v as the JSON body of the response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// errorBody is the body of error responses, under an "error" key.
+// Name is set for the errors caused by a user, folder or file name.
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Name    string `json:"name,omitempty"`
+}
+
+// WriteError writes an error in the shape {"error": {"code": ..., "message": ...}}, which the
+// middlewares and the other handlers of vfs serve share with the REST API
+func WriteError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]errorBody{"error": {Code: code, Message: message}})
+}
+
+// writeInternalError maps an error of the internal operations to a status code
+func writeInternalError(w http.ResponseWriter, err error) {
+	status, code := statusOf(err)
+	body := errorBody{Code: code, Message: err.Error()}
+	var nameErr *internal.NameError
+	if errors.As(err, &nameErr) {
+		body.Name = nameErr.Name
+	}
+	writeJSON(w, status, map[string]errorBody{"error": body})
+}
+
+// statusOf returns the status code and error code of an error of the internal operations
+func statusOf(err error) (int, string) {
+	var storage *internal.StorageError
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		return http.StatusNotFound, "not_found"
+	case errors.Is(err, internal.ErrAlreadyExists):
+		return http.StatusConflict, "already_exists"
+	case errors.Is(err, internal.ErrInvalidName):
+		return http.StatusBadRequest, "invalid_name"
+	case errors.Is(err, internal.ErrInvalidSort):
+		return http.StatusBadRequest, "invalid_sort"
+	case errors.Is(err, internal.ErrInvalidQuery):
+		return http.StatusBadRequest, "invalid_query"
+	case errors.As(err, &storage):
+		return http.StatusInternalServerError, "io"
+	}
+	return http.StatusInternalServerError, "failure"
+}
+
+// methodNotAllowed writes a 405 response listing the allowed methods
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed, expected "+allowed+".")
+}
@@ -0,0 +1,127 @@
+// internal/httpapi/server_test.go
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+// normalizeTimes replaces the RFC 3339 times of a body so it can be compared
+func normalizeTimes(body string) string {
+	rfc3339 := regexp.MustCompile(`"\d{4}-\d{2}-\d{2}T[0-9:.]+(Z|[+-]\d{2}:\d{2})"`)
+	return rfc3339.ReplaceAllString(body, `"2000-01-01T20:34:19Z"`)
+}
+
+func TestServer(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	server := httptest.NewServer(NewHandler())
+	defer server.Close()
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		status   int
+		expected string
+	}{
+		{"GET", "/users", "", 200, `[]`},
+		{"POST", "/users", `{"username":"Alice"}`, 201, `{"username":"alice"}`},
+		{"POST", "/users", `{"username":"alice"}`, 409, `{"error":{"code":"already_exists","message":"The alice has already existed.","name":"alice"}}`},
+		{"POST", "/users", `{"username":"bad/name"}`, 400, `{"error":{"code":"invalid_name","message":"The bad/name contains invalid chars.","name":"bad/name"}}`},
+		{"POST", "/users", `{"user":"bob"}`, 400, `{"error":{"code":"invalid_body","message":"Invalid JSON body: json: unknown field \"user\""}}`},
+		{"GET", "/users/alice", "", 200, `{"username":"alice"}`},
+		{"GET", "/users/bob", "", 404, `{"error":{"code":"not_found","message":"The bob doesn't exist.","name":"bob"}}`},
+		{"POST", "/users/alice/folders", `{"name":"Folder A","description":"first"}`, 201, `{"name":"folder a","description":"first","created_at":"2000-01-01T20:34:19Z"}`},
+		{"POST", "/users/alice/folders", `{"name":"folder-b"}`, 201, `{"name":"folder-b","description":"","created_at":"2000-01-01T20:34:19Z"}`},
+		{"GET", "/users/alice/folders", "", 200, `[{"name":"folder a","description":"first","created_at":"2000-01-01T20:34:19Z"},{"name":"folder-b","description":"","created_at":"2000-01-01T20:34:19Z"}]`},
+		{"GET", "/users/alice/folders?sort=name&order=desc&limit=1", "", 200, `[{"name":"folder-b","description":"","created_at":"2000-01-01T20:34:19Z"}]`},
+		{"GET", "/users/alice/folders?description=FIRST", "", 200, `[{"name":"folder a","description":"first","created_at":"2000-01-01T20:34:19Z"}]`},
+		{"GET", "/users/alice/folders?sort=size", "", 400, `{"error":{"code":"invalid_sort","message":"Unknown sort field size, expected one of name,created,description"}}`},
+		{"GET", "/users/alice/folders?limit=many", "", 400, `{"error":{"code":"invalid_query","message":"Invalid limit \"many\", expected a number"}}`},
+		{"GET", "/users/alice/folders?created_after=today", "", 400, `{"error":{"code":"invalid_query","message":"Invalid created_after \"today\", expected an RFC 3339 time"}}`},
+		{"GET", "/users/alice/folders/Folder%20A", "", 200, `{"name":"folder a","description":"first","created_at":"2000-01-01T20:34:19Z"}`},
+		{"PATCH", "/users/alice/folders/folder%20a", `{"name":"folder-c"}`, 200, `{"name":"folder-c","description":"first","created_at":"2000-01-01T20:34:19Z"}`},
+		{"PATCH", "/users/alice/folders/folder-c", `{"name":"folder-b"}`, 409, `{"error":{"code":"already_exists","message":"The folder-b has already existed.","name":"folder-b"}}`},
+		{"POST", "/users/alice/folders/folder-c/files", `{"name":"file1","description":"a file"}`, 201, `{"name":"file1","description":"a file","created_at":"2000-01-01T20:34:19Z"}`},
+		{"POST", "/users/alice/folders/folder-c/files", `{"name":"file2"}`, 201, `{"name":"file2","description":"","created_at":"2000-01-01T20:34:19Z"}`},
+		{"POST", "/users/alice/folders/nothing/files", `{"name":"file2"}`, 404, `{"error":{"code":"not_found","message":"The nothing doesn't exist.","name":"nothing"}}`},
+		{"GET", "/users/alice/folders/folder-c/files?reverse=true", "", 200, `[{"name":"file2","description":"","created_at":"2000-01-01T20:34:19Z"},{"name":"file1","description":"a file","created_at":"2000-01-01T20:34:19Z"}]`},
+		{"GET", "/users/alice/folders/folder-c/files/file1", "", 200, `{"name":"file1","description":"a file","created_at":"2000-01-01T20:34:19Z"}`},
+		{"DELETE", "/users/alice/folders/folder-c/files/file1", "", 204, ``},
+		{"DELETE", "/users/alice/folders/folder-c/files/file1", "", 404, `{"error":{"code":"not_found","message":"The file1 doesn't exist.","name":"file1"}}`},
+		{"DELETE", "/users/alice/folders/folder-c", "", 204, ``},
+		{"GET", "/users/alice/folders/folder-c", "", 404, `{"error":{"code":"not_found","message":"The folder-c doesn't exist.","name":"folder-c"}}`},
+		{"PUT", "/users/alice", "", 405, `{"error":{"code":"method_not_allowed","message":"Method not allowed, expected GET."}}`},
+		{"GET", "/groups", "", 404, `{"error":{"code":"not_found","message":"No such resource."}}`},
+		{"GET", "/users/alice/folders/a/b", "", 404, `{"error":{"code":"not_found","message":"No such resource."}}`},
+		{"GET", "/users", "", 200, `[{"username":"alice"}]`},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		body := normalizeTimes(strings.TrimSpace(string(data)))
+		if resp.StatusCode != tt.status || body != tt.expected {
+			t.Errorf("%s %s\nexpected %d %s\nbut got %d %s", tt.method, tt.path, tt.status, tt.expected, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestServerHeaders(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	internal.RegisterUser("alice")
+	for _, name := range []string{"a", "b", "c"} {
+		internal.CreateFolder("alice", name, "")
+	}
+	handler := NewHandler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/alice/folders?offset=1&limit=1", nil))
+	if total := recorder.Header().Get("X-Total-Count"); total != "3" {
+		t.Errorf("expected X-Total-Count 3 but got %q", total)
+	}
+	var folders []folderJSON
+	if err := json.Unmarshal(recorder.Body.Bytes(), &folders); err != nil || len(folders) != 1 || folders[0].Name != "b" {
+		t.Errorf("expected folder b but got %s", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/users/alice/folders", strings.NewReader(`{"name":"new folder"}`)))
+	if location := recorder.Header().Get("Location"); location != "/users/alice/folders/new%20folder" {
+		t.Errorf("expected the location of the new folder but got %q", location)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected a JSON response but got %q", contentType)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/users", nil))
+	if allow := recorder.Header().Get("Allow"); recorder.Code != 405 || allow != "GET, POST" {
+		t.Errorf("expected 405 allowing GET, POST but got %d %q", recorder.Code, allow)
+	}
+}
+
+func TestServerBodyTooLarge(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	recorder := httptest.NewRecorder()
+	body := `{"username":"` + strings.Repeat("a", maxBodySize) + `"}`
+	NewHandler().ServeHTTP(recorder, httptest.NewRequest("POST", "/users", strings.NewReader(body)))
+	if expected := `{"error":{"code":"body_too_large","message":"The body is larger than 1048576 bytes."}}`; recorder.Code != 413 || strings.TrimSpace(recorder.Body.String()) != expected {
+		t.Errorf("expected 413 %s but got %d %s", expected, recorder.Code, recorder.Body.String())
+	}
+}
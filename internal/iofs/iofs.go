@@ -0,0 +1,244 @@
+// internal/iofs/iofs.go
+
+// Package iofs exposes the folders and files of a user as an io/fs.FS, for fs.WalkDir,
+// http.FS, template.ParseFS and the like. The folders are the directories of the root and
+// the files their entries. Files have no content besides their description, so reading a
+// file returns its description. The file system is read-only.
+package iofs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// errIsDir is reported when reading a directory as a file
+var errIsDir = errors.New("is a directory")
+
+// errNotDir is reported when reading the entries of a file
+var errNotDir = errors.New("not a directory")
+
+// FS is the file system of a user. It implements fs.FS, fs.ReadDirFS, fs.StatFS and fs.ReadFileFS.
+type FS struct {
+	user string
+}
+
+// New returns the file system of username. Its methods fail with fs.ErrNotExist while the
+// user doesn't exist.
+func New(username string) *FS {
+	return &FS{user: username}
+}
+
+// Open opens a folder, a file or the root, named ".". An opened file reads the description
+// it had when it was opened, and an opened folder lists the files it had.
+func (f *FS) Open(name string) (fs.File, error) {
+	info, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return &file{info: info, Reader: strings.NewReader(info.description)}, nil
+	}
+	entries, err := f.readDir("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &dir{info: info, entries: entries}, nil
+}
+
+// Stat returns the info of a folder, a file or the root
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	info, err := f.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ReadDir returns the folders of the root or the files of a folder, sorted by name
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return f.readDir("readdir", name)
+}
+
+// ReadFile returns the description of a file
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	info, err := f.stat("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+	return []byte(info.description), nil
+}
+
+// split returns the folder and file names of a valid path, both empty for the root
+func split(op, name string) (string, string, error) {
+	if !fs.ValidPath(name) {
+		return "", "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return "", "", nil
+	}
+	foldername, filename, _ := strings.Cut(name, "/")
+	if strings.Contains(filename, "/") {
+		return "", "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return foldername, filename, nil
+}
+
+// stat returns the info of name, failing with an *fs.PathError of op
+func (f *FS) stat(op, name string) (*fileInfo, error) {
+	foldername, filename, err := split(op, name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case foldername == "":
+		if _, err := internal.GetUser(f.user); err != nil {
+			return nil, pathError(op, name, err)
+		}
+		return &fileInfo{name: ".", dir: true}, nil
+	case filename == "":
+		folder, err := internal.GetFolder(f.user, foldername)
+		if err != nil {
+			return nil, pathError(op, name, err)
+		}
+		return infoOfFolder(folder), nil
+	}
+	file, err := internal.GetFile(f.user, foldername, filename)
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+	return infoOfFile(file), nil
+}
+
+// readDir returns the entries of the directory name, failing with an *fs.PathError of op
+func (f *FS) readDir(op, name string) ([]fs.DirEntry, error) {
+	foldername, filename, err := split(op, name)
+	if err != nil {
+		return nil, err
+	}
+	// The name sort of the listings compares bytes, the order fs.ReadDirFS expects
+	var infos []*fileInfo
+	switch {
+	case foldername == "":
+		folders, err := internal.ListFolders(f.user, "name", "asc")
+		if err != nil {
+			return nil, pathError(op, name, err)
+		}
+		for _, folder := range folders {
+			infos = append(infos, infoOfFolder(folder))
+		}
+	case filename == "":
+		files, err := internal.ListFiles(f.user, foldername, "name", "asc")
+		if err != nil {
+			return nil, pathError(op, name, err)
+		}
+		for _, file := range files {
+			infos = append(infos, infoOfFile(file))
+		}
+	default:
+		if _, err := internal.GetFile(f.user, foldername, filename); err != nil {
+			return nil, pathError(op, name, err)
+		}
+		return nil, &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	return entries, nil
+}
+
+// pathError reports a failed operation on name, as fs.ErrNotExist when something doesn't exist
+func pathError(op, name string, err error) error {
+	if errors.Is(err, internal.ErrNotFound) {
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// fileInfo is the fs.FileInfo of a folder, a file or the root
+type fileInfo struct {
+	name        string
+	description string
+	createdAt   time.Time
+	dir         bool
+	sys         any
+}
+
+func infoOfFolder(folder *internal.Folder) *fileInfo {
+	return &fileInfo{name: folder.Name, createdAt: folder.CreatedAt, dir: true,
+		sys: &internal.Folder{Name: folder.Name, Description: folder.Description, CreatedAt: folder.CreatedAt}}
+}
+
+func infoOfFile(file *internal.File) *fileInfo {
+	copied := *file
+	return &fileInfo{name: file.Name, description: file.Description, createdAt: file.CreatedAt, sys: &copied}
+}
+
+func (i *fileInfo) Name() string { return i.name }
+
+// Size is the length of the description of a file, and 0 for a directory
+func (i *fileInfo) Size() int64 { return int64(len(i.description)) }
+
+// Mode is read-only, like the file system
+func (i *fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// ModTime is the creation time, as folders and files don't keep when they changed
+func (i *fileInfo) ModTime() time.Time { return i.createdAt }
+
+func (i *fileInfo) IsDir() bool { return i.dir }
+
+// Sys returns a copy of the *internal.Folder, without its files, or of the *internal.File
+func (i *fileInfo) Sys() any { return i.sys }
+
+// file is an opened file. The embedded reader adds io.Seeker and io.ReaderAt.
+type file struct {
+	info *fileInfo
+	*strings.Reader
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *file) Close() error { return nil }
+
+// dir is an opened folder or root, listing the entries it had when it was opened
+type dir struct {
+	info    *fileInfo
+	entries []fs.DirEntry
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errIsDir}
+}
+
+func (d *dir) Close() error { return nil }
+
+// ReadDir returns the next n entries, or all the entries left when n <= 0, as fs.ReadDirFile does
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,114 @@
+// internal/iofs/iofs_test.go
+package iofs
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"text/template"
+	"virtual-file-system/internal"
+)
+
+// useTestData gives alice the folders docs, holding notes and todo, and empty
+func useTestData() {
+	internal.UseMockData(make(map[string]*internal.User))
+	internal.RegisterUser("alice")
+	internal.CreateFolder("alice", "docs", "documents")
+	internal.CreateFolder("alice", "empty", "")
+	internal.CreateFile("alice", "docs", "notes", "Hello {{.}}")
+	internal.CreateFile("alice", "docs", "todo", "")
+}
+
+func TestFS(t *testing.T) {
+	useTestData()
+	if err := fstest.TestFS(New("alice"), "docs", "docs/notes", "docs/todo", "empty"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSInfo(t *testing.T) {
+	useTestData()
+	fsys := New("alice")
+
+	info, err := fs.Stat(fsys, "docs/notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, ok := info.Sys().(*internal.File)
+	if info.Name() != "notes" || info.Size() != 11 || info.IsDir() || info.Mode() != 0444 || !ok || file.Description != "Hello {{.}}" || !info.ModTime().Equal(file.CreatedAt) {
+		t.Errorf("unexpected info of docs/notes: %s %d %v %v", info.Name(), info.Size(), info.Mode(), info.Sys())
+	}
+
+	info, err = fs.Stat(fsys, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	folder, ok := info.Sys().(*internal.Folder)
+	if !info.IsDir() || info.Mode() != fs.ModeDir|0555 || !ok || folder.Description != "documents" {
+		t.Errorf("unexpected info of docs: %v %v", info.Mode(), info.Sys())
+	}
+}
+
+func TestFSErrors(t *testing.T) {
+	useTestData()
+
+	tests := []struct {
+		fsys     *FS
+		name     string
+		expected error
+	}{
+		{New("alice"), "music", fs.ErrNotExist},
+		{New("alice"), "docs/novel", fs.ErrNotExist},
+		{New("alice"), "docs/notes/x", fs.ErrNotExist},
+		{New("bob"), ".", fs.ErrNotExist},
+		{New("alice"), "/docs", fs.ErrInvalid},
+		{New("alice"), "docs/../docs", fs.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		_, err := tt.fsys.Open(tt.name)
+		var pathErr *fs.PathError
+		if !errors.Is(err, tt.expected) || !errors.As(err, &pathErr) || pathErr.Path != tt.name {
+			t.Errorf("Open(%q) of %s: expected %v but got %v", tt.name, tt.fsys.user, tt.expected, err)
+		}
+	}
+
+	if _, err := New("alice").ReadDir("docs/notes"); !errors.Is(err, errNotDir) {
+		t.Errorf("expected ReadDir of a file to fail but got %v", err)
+	}
+	if _, err := New("alice").ReadFile("docs"); !errors.Is(err, errIsDir) {
+		t.Errorf("expected ReadFile of a folder to fail but got %v", err)
+	}
+}
+
+func TestFSStandardLibrary(t *testing.T) {
+	useTestData()
+	fsys := New("alice")
+
+	var walked []string
+	fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		walked = append(walked, path)
+		return err
+	})
+	if len(walked) != 5 || walked[0] != "." || walked[1] != "docs" || walked[2] != "docs/notes" || walked[3] != "docs/todo" || walked[4] != "empty" {
+		t.Errorf("unexpected walk %v", walked)
+	}
+
+	tmpl, err := template.ParseFS(fsys, "docs/notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	if err := tmpl.Execute(recorder, "alice"); err != nil || recorder.Body.String() != "Hello alice" {
+		t.Errorf("unexpected template output %q, %v", recorder.Body.String(), err)
+	}
+
+	recorder = httptest.NewRecorder()
+	http.FileServer(http.FS(fsys)).ServeHTTP(recorder, httptest.NewRequest("GET", "/docs/notes", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "Hello {{.}}" {
+		t.Errorf("expected the file server to serve docs/notes but got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
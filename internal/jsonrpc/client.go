@@ -0,0 +1,204 @@
+// internal/jsonrpc/client.go
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// Client calls the methods of a server. Calls are sent one at a time.
+type Client struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	decoder *json.Decoder
+	nextID  int
+}
+
+// Dial connects to the server listening on the Unix socket at path
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient returns a client talking over conn
+func NewClient(conn net.Conn) *Client {
+	return &Client{conn: conn, decoder: json.NewDecoder(conn)}
+}
+
+// Close hangs up
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// send writes a request
+func (c *Client) send(req request) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(append(data, '\n'))
+	return err
+}
+
+// Call calls a method and decodes its result into result, unless result is nil.
+// Failures of the operation are returned as *internal.NameError when a name is at fault,
+// and as *Error otherwise.
+func (c *Client) Call(method string, params, result any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	if err := c.send(request{JSONRPC: "2.0", Method: method, Params: raw, ID: id}); err != nil {
+		return err
+	}
+
+	var resp response
+	if err := c.decoder.Decode(&resp); err != nil {
+		return err
+	}
+	if string(resp.ID) != string(id) {
+		if resp.Error != nil {
+			return resp.Error
+		}
+		return fmt.Errorf("response to request %s instead of %s", resp.ID, id)
+	}
+	if resp.Error != nil {
+		if category, ok := codeErrors[resp.Error.Code]; ok && resp.Error.Data != nil && resp.Error.Data.Name != "" {
+			return &internal.NameError{Name: resp.Error.Data.Name, Err: category}
+		}
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// Notify calls a method without waiting for, or getting, its outcome
+func (c *Client) Notify(method string, params any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.send(request{JSONRPC: "2.0", Method: method, Params: raw})
+}
+
+// The methods below mirror the operations of the internal package
+
+// RegisterUser registers a new user with a unique username
+func (c *Client) RegisterUser(username string) error {
+	return c.Call("RegisterUser", map[string]string{"username": username}, nil)
+}
+
+// ListUsers lists the names of all users in ascending order
+func (c *Client) ListUsers() ([]string, error) {
+	var users []string
+	err := c.Call("ListUsers", nil, &users)
+	return users, err
+}
+
+// CreateFolder creates a new folder for a user
+func (c *Client) CreateFolder(username, foldername, description string) error {
+	return c.Call("CreateFolder", map[string]string{"username": username, "foldername": foldername, "description": description}, nil)
+}
+
+// ListFolders lists all folders for a user sorted by sortBy in the given order
+func (c *Client) ListFolders(username, sortBy, order string) ([]*internal.Folder, error) {
+	var folders []*internal.Folder
+	err := c.Call("ListFolders", map[string]string{"username": username, "sortBy": sortBy, "order": order}, &folders)
+	return folders, err
+}
+
+// QueryFolders lists the folders of a user that match q, and the number of matching folders
+func (c *Client) QueryFolders(username string, q internal.Query) ([]*internal.Folder, int, error) {
+	var page pageResult[*internal.Folder]
+	err := c.Call("QueryFolders", map[string]any{"username": username, "query": q}, &page)
+	return page.Items, page.Total, err
+}
+
+// RenameFolder renames a folder for a user
+func (c *Client) RenameFolder(username, foldername, newFolderName string) error {
+	return c.Call("RenameFolder", map[string]string{"username": username, "foldername": foldername, "newFolderName": newFolderName}, nil)
+}
+
+// DeleteFolder deletes a folder for a user
+func (c *Client) DeleteFolder(username, foldername string) error {
+	return c.Call("DeleteFolder", map[string]string{"username": username, "foldername": foldername}, nil)
+}
+
+// CreateFile creates a new file in a user's folder
+func (c *Client) CreateFile(username, foldername, filename, description string) error {
+	return c.Call("CreateFile", map[string]string{"username": username, "foldername": foldername, "filename": filename, "description": description}, nil)
+}
+
+// ListFiles lists all files in a user's folder sorted by sortBy in the given order
+func (c *Client) ListFiles(username, foldername, sortBy, order string) ([]*internal.File, error) {
+	var files []*internal.File
+	err := c.Call("ListFiles", map[string]string{"username": username, "foldername": foldername, "sortBy": sortBy, "order": order}, &files)
+	return files, err
+}
+
+// QueryFiles lists the files in a user's folder that match q, and the number of matching files
+func (c *Client) QueryFiles(username, foldername string, q internal.Query) ([]*internal.File, int, error) {
+	var page pageResult[*internal.File]
+	err := c.Call("QueryFiles", map[string]any{"username": username, "foldername": foldername, "query": q}, &page)
+	return page.Items, page.Total, err
+}
+
+// DeleteFile deletes a file in a user's folder
+func (c *Client) DeleteFile(username, foldername, filename string) error {
+	return c.Call("DeleteFile", map[string]string{"username": username, "foldername": foldername, "filename": filename}, nil)
+}
+
+// CreateToken creates a token of a user with the given scope, restricted to foldername unless
+// it's empty, that expires after ttl unless it's 0. It returns the secret token and its details.
+func (c *Client) CreateToken(username string, scope internal.Scope, foldername string, ttl time.Duration) (string, *internal.Token, error) {
+	params := map[string]string{"username": username, "scope": string(scope), "foldername": foldername}
+	if ttl > 0 {
+		params["ttl"] = ttl.String()
+	}
+	var created createdTokenResult
+	if err := c.Call("CreateToken", params, &created); err != nil {
+		return "", nil, err
+	}
+	return created.Secret, tokenOf(created.tokenResult), nil
+}
+
+// ListTokens lists the tokens of a user, without their hashes, oldest first
+func (c *Client) ListTokens(username string) ([]*internal.Token, error) {
+	var results []tokenResult
+	if err := c.Call("ListTokens", map[string]string{"username": username}, &results); err != nil {
+		return nil, err
+	}
+	tokens := make([]*internal.Token, len(results))
+	for i, result := range results {
+		tokens[i] = tokenOf(result)
+	}
+	return tokens, nil
+}
+
+// RevokeToken deletes the token id of a user
+func (c *Client) RevokeToken(username, id string) error {
+	return c.Call("RevokeToken", map[string]string{"username": username, "id": id}, nil)
+}
+
+// tokenOf returns the token of a result
+func tokenOf(r tokenResult) *internal.Token {
+	return &internal.Token{ID: r.ID, Scope: r.Scope, Folder: r.Folder, CreatedAt: r.CreatedAt, ExpiresAt: r.ExpiresAt}
+}
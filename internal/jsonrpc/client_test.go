@@ -0,0 +1,144 @@
+// internal/jsonrpc/client_test.go
+package jsonrpc
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// newTestClient serves on a Unix socket and dials it
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	internal.UseMockData(make(map[string]*internal.User))
+	socket := filepath.Join(t.TempDir(), "vfs.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix sockets are unavailable:", err)
+	}
+	server := NewServer()
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	c, err := Dial(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t)
+
+	if err := c.RegisterUser("alice"); err != nil {
+		t.Fatalf("RegisterUser returned error: %v", err)
+	}
+	if err := c.CreateFolder("alice", "docs", "documents"); err != nil {
+		t.Fatalf("CreateFolder returned error: %v", err)
+	}
+	for _, name := range []string{"b", "a", "c"} {
+		if err := c.CreateFile("alice", "docs", name, "file "+name); err != nil {
+			t.Fatalf("CreateFile returned error: %v", err)
+		}
+	}
+	// A notification has no answer, the next call sees its effect
+	if err := c.Notify("CreateFolder", []string{"alice", "photos"}); err != nil {
+		t.Fatalf("Notify returned error: %v", err)
+	}
+
+	if users, err := c.ListUsers(); err != nil || len(users) != 1 || users[0] != "alice" {
+		t.Errorf("ListUsers() = %v, %v; expected [alice]", users, err)
+	}
+	folders, err := c.ListFolders("alice", "name", "desc")
+	if err != nil || len(folders) != 2 || folders[0].Name != "photos" || folders[1].Description != "documents" || folders[1].CreatedAt.IsZero() {
+		t.Errorf("ListFolders = %+v, %v; expected [photos docs]", folders, err)
+	}
+	files, total, err := c.QueryFiles("alice", "docs", internal.Query{Reverse: true, Offset: 1, Limit: 1})
+	if err != nil || total != 3 || len(files) != 1 || files[0].Name != "b" || files[0].Description != "file b" {
+		t.Errorf("QueryFiles = %+v, %d, %v; expected [b] of 3", files, total, err)
+	}
+
+	if err := c.RenameFolder("alice", "photos", "pictures"); err != nil {
+		t.Errorf("RenameFolder returned error: %v", err)
+	}
+	if err := c.DeleteFile("alice", "docs", "a"); err != nil {
+		t.Errorf("DeleteFile returned error: %v", err)
+	}
+	if err := c.DeleteFolder("alice", "pictures"); err != nil {
+		t.Errorf("DeleteFolder returned error: %v", err)
+	}
+	if folders, total, err := c.QueryFolders("alice", internal.Query{}); err != nil || total != 1 || folders[0].Name != "docs" {
+		t.Errorf("QueryFolders = %+v, %d, %v; expected [docs]", folders, total, err)
+	}
+	if files, err := c.ListFiles("alice", "docs", "", ""); err != nil || len(files) != 2 {
+		t.Errorf("ListFiles = %+v, %v; expected [b c]", files, err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c := newTestClient(t)
+	c.RegisterUser("alice")
+
+	tests := []struct {
+		err      error
+		category error
+		message  string
+	}{
+		{c.RegisterUser("alice"), internal.ErrAlreadyExists, "The alice has already existed."},
+		{c.RegisterUser("bad/name"), internal.ErrInvalidName, "The bad/name contains invalid chars."},
+		{c.CreateFolder("bob", "docs", ""), internal.ErrNotFound, "The bob doesn't exist."},
+		{func() error { _, err := c.ListFolders("alice", "size", ""); return err }(), internal.ErrInvalidSort, "Unknown sort field size, expected one of name,created,description"},
+		{func() error { _, _, err := c.QueryFolders("alice", internal.Query{Limit: -1}); return err }(), internal.ErrInvalidQuery, "Invalid limit -1: must not be negative"},
+	}
+
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.category) || tt.err.Error() != tt.message {
+			t.Errorf("expected %q in category %v but got %v", tt.message, tt.category, tt.err)
+		}
+	}
+
+	// Name errors are the same type as in-process
+	var nameErr *internal.NameError
+	if err := c.RegisterUser("alice"); !errors.As(err, &nameErr) || nameErr.Name != "alice" {
+		t.Errorf("expected a *NameError for alice but got %#v", err)
+	}
+	var rpcErr *Error
+	if err := c.Call("Nothing", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Code != CodeMethodNotFound {
+		t.Errorf("expected an *Error with code %d but got %#v", CodeMethodNotFound, err)
+	}
+}
+
+func TestClientTokens(t *testing.T) {
+	c := newTestClient(t)
+	c.RegisterUser("alice")
+	c.CreateFolder("alice", "docs", "")
+
+	secret, token, err := c.CreateToken("alice", internal.ScopeWrite, "docs", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateToken returned error: %v", err)
+	}
+	if username, stored, err := internal.Authenticate(secret); err != nil || username != "alice" || stored.ID != token.ID || stored.Scope != internal.ScopeWrite || stored.Folder != "docs" || !stored.ExpiresAt.Equal(token.ExpiresAt) {
+		t.Errorf("expected the server to keep the token %+v but got %s %+v %v", token, username, stored, err)
+	}
+	tokens, err := c.ListTokens("alice")
+	if err != nil || len(tokens) != 1 || tokens[0].ID != token.ID || tokens[0].Hash != "" {
+		t.Errorf("ListTokens = %+v, %v; expected %s without its hash", tokens, err, token.ID)
+	}
+	if err := c.RevokeToken("alice", token.ID); err != nil {
+		t.Errorf("RevokeToken returned error: %v", err)
+	}
+	if _, _, err := internal.Authenticate(secret); err == nil {
+		t.Error("expected the revoked token to fail")
+	}
+
+	if _, token, err := c.CreateToken("alice", "", "", 0); err != nil || token.Scope != internal.ScopeRead || !token.ExpiresAt.IsZero() {
+		t.Errorf("expected a read token that doesn't expire but got %+v, %v", token, err)
+	}
+	if _, _, err := c.CreateToken("bob", internal.ScopeRead, "", 0); !errors.Is(err, internal.ErrNotFound) {
+		t.Errorf("expected CreateToken of bob to fail but got %v", err)
+	}
+}
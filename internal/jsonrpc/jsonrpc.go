@@ -0,0 +1,137 @@
+// internal/jsonrpc/jsonrpc.go
+
+// Package jsonrpc exposes the operations of the virtual file system as JSON-RPC 2.0 methods
+// over a stream, usually a Unix domain socket. Requests and responses are JSON values
+// written one after the other, each response followed by a newline.
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// Error codes of JSON-RPC 2.0
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Error codes of the failures of the operations, in the range reserved for servers
+const (
+	CodeFailure       = -32000
+	CodeNotFound      = -32001
+	CodeAlreadyExists = -32002
+	CodeInvalidName   = -32003
+	CodeInvalidSort   = -32004
+	CodeInvalidQuery  = -32005
+	CodeIO            = -32006
+)
+
+// codeErrors maps the error codes to the error categories of the operations
+var codeErrors = map[int]error{
+	CodeNotFound:      internal.ErrNotFound,
+	CodeAlreadyExists: internal.ErrAlreadyExists,
+	CodeInvalidName:   internal.ErrInvalidName,
+	CodeInvalidSort:   internal.ErrInvalidSort,
+	CodeInvalidQuery:  internal.ErrInvalidQuery,
+}
+
+// Error is the error object of a response
+type Error struct {
+	Code    int        `json:"code"`
+	Message string     `json:"message"`
+	Data    *ErrorData `json:"data,omitempty"`
+}
+
+// ErrorData names the user, folder or file at fault
+type ErrorData struct {
+	Name string `json:"name"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error category matching Code, if any
+func (e *Error) Unwrap() error {
+	return codeErrors[e.Code]
+}
+
+// errorOf builds the error object of a failed operation
+func errorOf(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+
+	e := &Error{Code: CodeFailure, Message: err.Error()}
+	var storage *internal.StorageError
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		e.Code = CodeNotFound
+	case errors.Is(err, internal.ErrAlreadyExists):
+		e.Code = CodeAlreadyExists
+	case errors.Is(err, internal.ErrInvalidName):
+		e.Code = CodeInvalidName
+	case errors.Is(err, internal.ErrInvalidSort):
+		e.Code = CodeInvalidSort
+	case errors.Is(err, internal.ErrInvalidQuery):
+		e.Code = CodeInvalidQuery
+	case errors.As(err, &storage):
+		e.Code = CodeIO
+	}
+	var nameErr *internal.NameError
+	if errors.As(err, &nameErr) {
+		e.Data = &ErrorData{Name: nameErr.Name}
+	}
+	return e
+}
+
+// request is a request or a notification, which has no ID
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// response is the answer to a request
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// folderResult is a folder in results, without its files
+type folderResult struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// tokenResult is a token in results, without its hash
+type tokenResult struct {
+	ID        string         `json:"id"`
+	Scope     internal.Scope `json:"scope"`
+	Folder    string         `json:"folder,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	ExpiresAt time.Time      `json:"expires_at"`
+}
+
+// createdTokenResult is the result of CreateToken, the only one holding the secret
+type createdTokenResult struct {
+	Secret string `json:"secret"`
+	tokenResult
+}
+
+// pageResult is the result of QueryFolders and QueryFiles
+type pageResult[T any] struct {
+	Items []T `json:"items"`
+	Total int `json:"total"`
+}
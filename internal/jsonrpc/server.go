@@ -0,0 +1,535 @@
+// internal/jsonrpc/server.go
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("JSON-RPC server closed")
+
+// params are the parameters of a call by name. Positional parameters are named after the
+// parameters of the method.
+type params map[string]json.RawMessage
+
+// get decodes a parameter into v. Optional parameters may be missing.
+func (p params) get(name string, v any, optional bool) error {
+	raw, ok := p[name]
+	if !ok {
+		if optional {
+			return nil
+		}
+		return &Error{Code: CodeInvalidParams, Message: "Missing parameter " + name + "."}
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("Invalid parameter %s: %v", name, err)}
+	}
+	return nil
+}
+
+// str returns a string parameter
+func (p params) str(name string) (string, error) {
+	var s string
+	err := p.get(name, &s, false)
+	return s, err
+}
+
+// strings returns string parameters in order
+func (p params) strings(names ...string) ([]string, error) {
+	values := make([]string, len(names))
+	for i, name := range names {
+		var err error
+		if values[i], err = p.str(name); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// optional returns an optional string parameter, empty when it's missing
+func (p params) optional(name string) (string, error) {
+	var s string
+	err := p.get(name, &s, true)
+	return s, err
+}
+
+// method is an operation exposed over JSON-RPC
+type method struct {
+	// params names the parameters in the order they're given by position
+	params []string
+	call   func(p params) (any, error)
+}
+
+// folderResults copies folders without their files
+func folderResults(folders []*internal.Folder) []folderResult {
+	result := make([]folderResult, len(folders))
+	for i, folder := range folders {
+		result[i] = folderResult{Name: folder.Name, Description: folder.Description, CreatedAt: folder.CreatedAt}
+	}
+	return result
+}
+
+// fileResults copies files
+func fileResults(files []*internal.File) []internal.File {
+	result := make([]internal.File, len(files))
+	for i, file := range files {
+		result[i] = *file
+	}
+	return result
+}
+
+// tokenResults copies tokens without their hashes
+func tokenResults(tokens []*internal.Token) []tokenResult {
+	result := make([]tokenResult, len(tokens))
+	for i, token := range tokens {
+		result[i] = tokenResult{ID: token.ID, Scope: token.Scope, Folder: token.Folder, CreatedAt: token.CreatedAt, ExpiresAt: token.ExpiresAt}
+	}
+	return result
+}
+
+// methods are named after the operations of the internal package, with the same parameters
+var methods = map[string]method{
+	"RegisterUser": {[]string{"username"}, func(p params) (any, error) {
+		username, err := p.str("username")
+		if err != nil {
+			return nil, err
+		}
+		return nil, internal.RegisterUser(username)
+	}},
+	"ListUsers": {nil, func(p params) (any, error) {
+		return internal.ListUsers(), nil
+	}},
+	"GetUser": {[]string{"username"}, func(p params) (any, error) {
+		username, err := p.str("username")
+		if err != nil {
+			return nil, err
+		}
+		user, err := internal.GetUser(username)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"username": user.Username}, nil
+	}},
+	"CreateFolder": {[]string{"username", "foldername", "description"}, func(p params) (any, error) {
+		names, err := p.strings("username", "foldername")
+		if err != nil {
+			return nil, err
+		}
+		description, err := p.optional("description")
+		if err != nil {
+			return nil, err
+		}
+		return nil, internal.CreateFolder(names[0], names[1], description)
+	}},
+	"GetFolder": {[]string{"username", "foldername"}, func(p params) (any, error) {
+		names, err := p.strings("username", "foldername")
+		if err != nil {
+			return nil, err
+		}
+		folder, err := internal.GetFolder(names[0], names[1])
+		if err != nil {
+			return nil, err
+		}
+		return folderResults([]*internal.Folder{folder})[0], nil
+	}},
+	"ListFolders": {[]string{"username", "sortBy", "order"}, func(p params) (any, error) {
+		username, err := p.str("username")
+		if err != nil {
+			return nil, err
+		}
+		sortBy, err := p.optional("sortBy")
+		if err != nil {
+			return nil, err
+		}
+		order, err := p.optional("order")
+		if err != nil {
+			return nil, err
+		}
+		folders, err := internal.ListFolders(username, sortBy, order)
+		if err != nil {
+			return nil, err
+		}
+		return folderResults(folders), nil
+	}},
+	"QueryFolders": {[]string{"username", "query"}, func(p params) (any, error) {
+		username, err := p.str("username")
+		if err != nil {
+			return nil, err
+		}
+		var q internal.Query
+		if err := p.get("query", &q, true); err != nil {
+			return nil, err
+		}
+		folders, total, err := internal.QueryFolders(username, q)
+		if err != nil {
+			return nil, err
+		}
+		return pageResult[folderResult]{Items: folderResults(folders), Total: total}, nil
+	}},
+	"RenameFolder": {[]string{"username", "foldername", "newFolderName"}, func(p params) (any, error) {
+		names, err := p.strings("username", "foldername", "newFolderName")
+		if err != nil {
+			return nil, err
+		}
+		return nil, internal.RenameFolder(names[0], names[1], names[2])
+	}},
+	"DeleteFolder": {[]string{"username", "foldername"}, func(p params) (any, error) {
+		names, err := p.strings("username", "foldername")
+		if err != nil {
+			return nil, err
+		}
+		return nil, internal.DeleteFolder(names[0], names[1])
+	}},
+	"CreateFile": {[]string{"username", "foldername", "filename", "description"}, func(p params) (any, error) {
+		names, err := p.strings("username", "foldername", "filename")
+		if err != nil {
+			return nil, err
+		}
+		description, err := p.optional("description")
+		if err != nil {
+			return nil, err
+		}
+		return nil, internal.CreateFile(names[0], names[1], names[2], description)
+	}},
+	"GetFile": {[]string{"username", "foldername", "filename"}, func(p params) (any, error) {
+		names, err := p.strings("username", "foldername", "filename")
+		if err != nil {
+			return nil, err
+		}
+		return internal.GetFile(names[0], names[1], names[2])
+	}},
+	"ListFiles": {[]string{"username", "foldername", "sortBy", "order"}, func(p params) (any, error) {
+		names, err := p.strings("username", "foldername")
+		if err != nil {
+			return nil, err
+		}
+		sortBy, err := p.optional("sortBy")
+		if err != nil {
+			return nil, err
+		}
+		order, err := p.optional("order")
+		if err != nil {
+			return nil, err
+		}
+		files, err := internal.ListFiles(names[0], names[1], sortBy, order)
+		if err != nil {
+			return nil, err
+		}
+		return fileResults(files), nil
+	}},
+	"QueryFiles": {[]string{"username", "foldername", "query"}, func(p params) (any, error) {
+		names, err := p.strings("username", "foldername")
+		if err != nil {
+			return nil, err
+		}
+		var q internal.Query
+		if err := p.get("query", &q, true); err != nil {
+			return nil, err
+		}
+		files, total, err := internal.QueryFiles(names[0], names[1], q)
+		if err != nil {
+			return nil, err
+		}
+		return pageResult[internal.File]{Items: fileResults(files), Total: total}, nil
+	}},
+	"SetFileDescription": {[]string{"username", "foldername", "filename", "description"}, func(p params) (any, error) {
+		names, err := p.strings("username", "foldername", "filename", "description")
+		if err != nil {
+			return nil, err
+		}
+		return nil, internal.SetFileDescription(names[0], names[1], names[2], names[3])
+	}},
+	"MoveFile": {[]string{"username", "foldername", "filename", "newFolderName", "newFileName"}, func(p params) (any, error) {
+		names, err := p.strings("username", "foldername", "filename", "newFolderName", "newFileName")
+		if err != nil {
+			return nil, err
+		}
+		return nil, internal.MoveFile(names[0], names[1], names[2], names[3], names[4])
+	}},
+	"DeleteFile": {[]string{"username", "foldername", "filename"}, func(p params) (any, error) {
+		names, err := p.strings("username", "foldername", "filename")
+		if err != nil {
+			return nil, err
+		}
+		return nil, internal.DeleteFile(names[0], names[1], names[2])
+	}},
+	"CreateToken": {[]string{"username", "scope", "foldername", "ttl"}, func(p params) (any, error) {
+		username, err := p.str("username")
+		if err != nil {
+			return nil, err
+		}
+		optional := make([]string, 3)
+		for i, name := range []string{"scope", "foldername", "ttl"} {
+			if optional[i], err = p.optional(name); err != nil {
+				return nil, err
+			}
+		}
+		scope := internal.ScopeRead
+		if optional[0] != "" {
+			scope = internal.Scope(optional[0])
+		}
+		var ttl time.Duration
+		if optional[2] != "" {
+			if ttl, err = time.ParseDuration(optional[2]); err != nil || ttl <= 0 {
+				return nil, &Error{Code: CodeInvalidParams, Message: "Invalid parameter ttl, expected a positive duration like 720h."}
+			}
+		}
+		secret, token, err := internal.CreateToken(username, scope, optional[1], ttl)
+		if err != nil {
+			return nil, err
+		}
+		return createdTokenResult{Secret: secret, tokenResult: tokenResults([]*internal.Token{token})[0]}, nil
+	}},
+	"ListTokens": {[]string{"username"}, func(p params) (any, error) {
+		username, err := p.str("username")
+		if err != nil {
+			return nil, err
+		}
+		tokens, err := internal.ListTokens(username)
+		if err != nil {
+			return nil, err
+		}
+		return tokenResults(tokens), nil
+	}},
+	"RevokeToken": {[]string{"username", "id"}, func(p params) (any, error) {
+		names, err := p.strings("username", "id")
+		if err != nil {
+			return nil, err
+		}
+		return nil, internal.RevokeToken(names[0], names[1])
+	}},
+}
+
+// decodeParams turns by-name or by-position parameters into params
+func decodeParams(m method, raw json.RawMessage) (params, error) {
+	p := params{}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return p, nil
+	}
+	invalid := func(format string, args ...any) (params, error) {
+		return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf(format, args...)}
+	}
+	switch raw[0] {
+	case '{':
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return invalid("Invalid params: %v", err)
+		}
+		for name := range p {
+			known := false
+			for _, param := range m.params {
+				known = known || param == name
+			}
+			if !known {
+				return invalid("Unknown parameter %s, expected %s.", name, strings.Join(m.params, ", "))
+			}
+		}
+	case '[':
+		var values []json.RawMessage
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return invalid("Invalid params: %v", err)
+		}
+		if len(values) > len(m.params) {
+			return invalid("Too many parameters, expected %s.", strings.Join(m.params, ", "))
+		}
+		for i, value := range values {
+			p[m.params[i]] = value
+		}
+	default:
+		return invalid("Params must be an object or an array.")
+	}
+	return p, nil
+}
+
+// isValidID reports whether an ID is a string, a number or null
+func isValidID(id json.RawMessage) bool {
+	var v any
+	if json.Unmarshal(id, &v) != nil {
+		return false
+	}
+	switch v.(type) {
+	case string, float64, nil:
+		return true
+	}
+	return false
+}
+
+// handle runs a single request. It returns nil for notifications.
+func handle(raw json.RawMessage) *response {
+	invalid := &Error{Code: CodeInvalidRequest, Message: `Invalid request, expected "jsonrpc": "2.0", a method and an optional string or number id.`}
+	var fields map[string]json.RawMessage
+	var req request
+	if json.Unmarshal(raw, &fields) != nil || json.Unmarshal(raw, &req) != nil {
+		return &response{JSONRPC: "2.0", Error: invalid, ID: json.RawMessage("null")}
+	}
+	id, hasID := fields["id"]
+	if hasID && !isValidID(id) {
+		return &response{JSONRPC: "2.0", Error: invalid, ID: json.RawMessage("null")}
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		if !hasID {
+			id = json.RawMessage("null")
+		}
+		return &response{JSONRPC: "2.0", Error: invalid, ID: id}
+	}
+
+	var result any
+	m, ok := methods[req.Method]
+	p, err := decodeParams(m, req.Params)
+	if !ok {
+		err = &Error{Code: CodeMethodNotFound, Message: "Unknown method " + req.Method + "."}
+	}
+	if err == nil {
+		result, err = m.call(p)
+	}
+	if !hasID {
+		return nil
+	}
+	if err != nil {
+		return &response{JSONRPC: "2.0", Error: errorOf(err), ID: id}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return &response{JSONRPC: "2.0", Error: &Error{Code: CodeInternalError, Message: err.Error()}, ID: id}
+	}
+	return &response{JSONRPC: "2.0", Result: data, ID: id}
+}
+
+// handleMessage runs a request or a batch, and returns the JSON of the answer, or nil
+// when there is nothing to answer
+func (s *Server) handleMessage(raw json.RawMessage) []byte {
+	var answer any
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(trimmed, &batch); err != nil || len(batch) == 0 {
+			answer = &response{JSONRPC: "2.0", Error: &Error{Code: CodeInvalidRequest, Message: "The batch must be a non-empty array."}, ID: json.RawMessage("null")}
+		} else if s.MaxBatch > 0 && len(batch) > s.MaxBatch {
+			// Nothing is run, each request of a batch may save the data file
+			message := fmt.Sprintf("The batch has %d requests, at most %d are allowed.", len(batch), s.MaxBatch)
+			answer = &response{JSONRPC: "2.0", Error: &Error{Code: CodeInvalidRequest, Message: message}, ID: json.RawMessage("null")}
+		} else {
+			var responses []*response
+			for _, item := range batch {
+				if resp := handle(item); resp != nil {
+					responses = append(responses, resp)
+				}
+			}
+			if len(responses) == 0 {
+				return nil
+			}
+			answer = responses
+		}
+	} else if resp := handle(raw); resp != nil {
+		answer = resp
+	} else {
+		return nil
+	}
+	data, _ := json.Marshal(answer)
+	return append(data, '\n')
+}
+
+// Server serves JSON-RPC connections
+type Server struct {
+	// MaxBatch is how many requests a batch may have, 0 for no limit
+	MaxBatch int
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[io.Closer]struct{}
+}
+
+// NewServer returns a server of the operations of the virtual file system
+func NewServer() *Server {
+	return &Server{listeners: map[net.Listener]struct{}{}, conns: map[io.Closer]struct{}{}}
+}
+
+// Serve accepts connections on l until Close, serving each one in its own goroutine
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+// ServeConn answers the requests of a connection in order until the client hangs up.
+// Invalid JSON can't be skipped in a stream, so it's answered with a parse error and
+// the connection is closed.
+func (s *Server) ServeConn(rw io.ReadWriteCloser) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		rw.Close()
+		return
+	}
+	s.conns[rw] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, rw)
+		s.mu.Unlock()
+		rw.Close()
+	}()
+
+	decoder := json.NewDecoder(rw)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				resp := &response{JSONRPC: "2.0", Error: &Error{Code: CodeParseError, Message: "Parse error: " + err.Error()}, ID: json.RawMessage("null")}
+				data, _ := json.Marshal(resp)
+				rw.Write(append(data, '\n'))
+			}
+			return
+		}
+		if answer := s.handleMessage(raw); answer != nil {
+			if _, err := rw.Write(answer); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Close stops the listeners and hangs up every connection
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if closeErr := l.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return err
+}
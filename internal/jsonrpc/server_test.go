@@ -0,0 +1,116 @@
+// internal/jsonrpc/server_test.go
+package jsonrpc
+
+import (
+	"bufio"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+// normalizeTimes replaces the RFC 3339 times of a body so it can be compared
+func normalizeTimes(body string) string {
+	rfc3339 := regexp.MustCompile(`"\d{4}-\d{2}-\d{2}T[0-9:.]+(Z|[+-]\d{2}:\d{2})"`)
+	return rfc3339.ReplaceAllString(body, `"2000-01-01T20:34:19Z"`)
+}
+
+// dialPipe serves a connection over a pipe and returns the client side
+func dialPipe(t *testing.T) net.Conn {
+	t.Helper()
+	internal.UseMockData(make(map[string]*internal.User))
+	server := NewServer()
+	clientConn, serverConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	t.Cleanup(func() {
+		clientConn.Close()
+		server.Close()
+	})
+	return clientConn
+}
+
+func TestServer(t *testing.T) {
+	conn := dialPipe(t)
+	reader := bufio.NewReader(conn)
+
+	tests := []struct {
+		request  string
+		expected string
+	}{
+		{`{"jsonrpc":"2.0","method":"RegisterUser","params":{"username":"alice"},"id":1}`, `{"jsonrpc":"2.0","result":null,"id":1}`},
+		{`{"jsonrpc":"2.0","method":"RegisterUser","params":["alice"],"id":"a"}`, `{"jsonrpc":"2.0","error":{"code":-32002,"message":"The alice has already existed.","data":{"name":"alice"}},"id":"a"}`},
+		{`{"jsonrpc":"2.0","method":"CreateFolder","params":["alice","docs","documents"],"id":2}`, `{"jsonrpc":"2.0","result":null,"id":2}`},
+		{`{"jsonrpc":"2.0","method":"GetFolder","params":{"username":"alice","foldername":"docs"},"id":3}`, `{"jsonrpc":"2.0","result":{"name":"docs","description":"documents","created_at":"2000-01-01T20:34:19Z"},"id":3}`},
+		{`{"jsonrpc":"2.0","method":"CreateFile","params":["alice","docs","b"]}`, ``},
+		{`[{"jsonrpc":"2.0","method":"CreateFile","params":["alice","docs","a","first"],"id":4},{"jsonrpc":"2.0","method":"CreateFile","params":["alice","docs","c"]},{"jsonrpc":"2.0","method":"QueryFiles","params":{"username":"alice","foldername":"docs","query":{"sort":"name","order":"desc","limit":2}},"id":5}]`,
+			`[{"jsonrpc":"2.0","result":null,"id":4},{"jsonrpc":"2.0","result":{"items":[{"name":"c","description":"","created_at":"2000-01-01T20:34:19Z"},{"name":"b","description":"","created_at":"2000-01-01T20:34:19Z"}],"total":3},"id":5}]`},
+		{`[{"jsonrpc":"2.0","method":"DeleteFile","params":["alice","docs","c"]}]`, ``},
+		{`{"jsonrpc":"2.0","method":"ListFolders","params":{"username":"alice","sortBy":"size"},"id":6}`, `{"jsonrpc":"2.0","error":{"code":-32004,"message":"Unknown sort field size, expected one of name,created,description"},"id":6}`},
+		{`{"jsonrpc":"2.0","method":"QueryFolders","params":{"username":"alice","query":{"limit":-1}},"id":7}`, `{"jsonrpc":"2.0","error":{"code":-32005,"message":"Invalid limit -1: must not be negative"},"id":7}`},
+		{`{"jsonrpc":"2.0","method":"ListUsers","id":8}`, `{"jsonrpc":"2.0","result":["alice"],"id":8}`},
+		{`{"jsonrpc":"2.0","method":"Format","id":9}`, `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Unknown method Format."},"id":9}`},
+		{`{"jsonrpc":"2.0","method":"DeleteFolder","params":["alice"],"id":10}`, `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Missing parameter foldername."},"id":10}`},
+		{`{"jsonrpc":"2.0","method":"DeleteFolder","params":{"user":"alice"},"id":11}`, `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Unknown parameter user, expected username, foldername."},"id":11}`},
+		{`{"jsonrpc":"2.0","method":"RegisterUser","params":[1],"id":12}`, `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid parameter username: json: cannot unmarshal number into Go value of type string"},"id":12}`},
+		{`{"method":"ListUsers","id":13}`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid request, expected \"jsonrpc\": \"2.0\", a method and an optional string or number id."},"id":13}`},
+		{`{"jsonrpc":"2.0","method":"ListUsers","id":{}}`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid request, expected \"jsonrpc\": \"2.0\", a method and an optional string or number id."},"id":null}`},
+		{`[]`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"The batch must be a non-empty array."},"id":null}`},
+		{`[1]`, `[{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid request, expected \"jsonrpc\": \"2.0\", a method and an optional string or number id."},"id":null}]`},
+		{`{"jsonrpc":"2.0","method":"ListFiles","params":["alice","docs"],"id":14}`, `{"jsonrpc":"2.0","result":[{"name":"a","description":"first","created_at":"2000-01-01T20:34:19Z"},{"name":"b","description":"","created_at":"2000-01-01T20:34:19Z"}],"id":14}`},
+		{`{"jsonrpc": }`, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error: invalid character '}' looking for beginning of value"},"id":null}`},
+	}
+
+	for _, tt := range tests {
+		if _, err := conn.Write([]byte(tt.request + "\n")); err != nil {
+			t.Fatalf("request %s: %v", tt.request, err)
+		}
+		if tt.expected == "" {
+			continue
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("request %s: %v", tt.request, err)
+		}
+		if got := normalizeTimes(strings.TrimSpace(line)); got != tt.expected {
+			t.Errorf("request %s\nexpected %s\nbut got  %s", tt.request, tt.expected, got)
+		}
+	}
+}
+
+func TestServerParseErrorCloses(t *testing.T) {
+	conn := dialPipe(t)
+	conn.Write([]byte("not json\n"))
+	reader := bufio.NewReader(conn)
+	if line, _ := reader.ReadString('\n'); !strings.Contains(line, `"code":-32700`) {
+		t.Errorf("expected a parse error but got %s", line)
+	}
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Errorf("expected the connection to be closed after a parse error")
+	}
+}
+
+func TestServerMaxBatch(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	server := NewServer()
+	server.MaxBatch = 2
+	clientConn, serverConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	defer server.Close()
+	defer clientConn.Close()
+	reader := bufio.NewReader(clientConn)
+
+	clientConn.Write([]byte(`[{"jsonrpc":"2.0","method":"RegisterUser","params":["a"],"id":1},{"jsonrpc":"2.0","method":"RegisterUser","params":["b"],"id":2},{"jsonrpc":"2.0","method":"RegisterUser","params":["c"],"id":3}]` + "\n"))
+	line, _ := reader.ReadString('\n')
+	if expected := `{"jsonrpc":"2.0","error":{"code":-32600,"message":"The batch has 3 requests, at most 2 are allowed."},"id":null}`; strings.TrimSpace(line) != expected {
+		t.Errorf("expected %s\nbut got  %s", expected, line)
+	}
+	if users := internal.ListUsers(); len(users) != 0 {
+		t.Errorf("expected nothing to run but got the users %v", users)
+	}
+
+	clientConn.Write([]byte(`[{"jsonrpc":"2.0","method":"RegisterUser","params":["a"],"id":1},{"jsonrpc":"2.0","method":"RegisterUser","params":["b"],"id":2}]` + "\n"))
+	if line, _ := reader.ReadString('\n'); strings.Count(line, `"result":null`) != 2 {
+		t.Errorf("expected the batch to run but got %s", line)
+	}
+}
@@ -0,0 +1,151 @@
+// internal/limit/limit.go
+
+// Package limit protects the HTTP servers of the virtual file system from clients sending too
+// many or too large requests. Requests are rate limited with token buckets per client IP and
+// per user, and answered 429 with Retry-After when a bucket is empty.
+package limit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"virtual-file-system/internal/httpapi"
+)
+
+// sweepInterval is how often idle buckets are forgotten
+const sweepInterval = time.Minute
+
+// bucket holds the tokens of a key at the time it was last used
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket per key: each key may spend burst requests at once, and gets
+// rate tokens back per second
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter returns a limiter refilling rate tokens per second up to burst, which must be at least 1
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{rate: rate, burst: float64(burst), now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token of key. When there is none, it returns false and how long until there is one.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refilled(b, now)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// refilled returns the tokens of b at now. The caller must hold mu.
+func (l *Limiter) refilled(b *bucket, now time.Time) float64 {
+	return math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+}
+
+// sweep forgets the buckets that are full again, as new buckets start full.
+// The caller must hold mu.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refilled(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Config sets the limits of Middleware. Zero values disable a limit.
+type Config struct {
+	// IPRate requests per second, up to IPBurst at once, are allowed per client IP
+	IPRate  float64
+	IPBurst int
+	// UserRate requests per second, up to UserBurst at once, are allowed per user
+	UserRate  float64
+	UserBurst int
+	// UserOf returns the user a request acts for, or "" when there is none
+	UserOf func(r *http.Request) string
+	// MaxBodySize is the size in bytes a request body may have
+	MaxBodySize int64
+}
+
+// Middleware returns a wrapper enforcing the limits of c on the requests to the handlers it
+// wraps. The handlers share the buckets.
+func Middleware(c Config) func(next http.Handler) http.Handler {
+	var ips, users *Limiter
+	if c.IPRate > 0 {
+		ips = NewLimiter(c.IPRate, max(c.IPBurst, 1))
+	}
+	if c.UserRate > 0 && c.UserOf != nil {
+		users = NewLimiter(c.UserRate, max(c.UserBurst, 1))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ips != nil {
+				if ok, wait := ips.Allow(ClientIP(r)); !ok {
+					tooManyRequests(w, wait)
+					return
+				}
+			}
+			if users != nil {
+				if user := c.UserOf(r); user != "" {
+					if ok, wait := users.Allow(user); !ok {
+						tooManyRequests(w, wait)
+						return
+					}
+				}
+			}
+			if c.MaxBodySize > 0 {
+				if r.ContentLength > c.MaxBodySize {
+					httpapi.WriteError(w, http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("The body is larger than %d bytes.", c.MaxBodySize))
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, c.MaxBodySize)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the IP of the client, without its port. Forwarding headers aren't trusted.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// tooManyRequests answers 429 with the whole seconds to wait in Retry-After
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := max(int(math.Ceil(wait.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	httpapi.WriteError(w, http.StatusTooManyRequests, "rate_limited", fmt.Sprintf("Too many requests, retry in %ds.", seconds))
+}
@@ -0,0 +1,116 @@
+// internal/limit/limit_test.go
+package limit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock is a time that only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestLimiter(t *testing.T) {
+	clock := &fakeClock{time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	l := NewLimiter(2, 3)
+	l.now = clock.Now
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d: expected the burst to be allowed", i)
+		}
+	}
+	if ok, wait := l.Allow("a"); ok || wait != 500*time.Millisecond {
+		t.Errorf("expected to wait 500ms but got %v, %v", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Errorf("expected another key to have its own bucket")
+	}
+
+	clock.now = clock.now.Add(250 * time.Millisecond)
+	if ok, wait := l.Allow("a"); ok || wait != 250*time.Millisecond {
+		t.Errorf("expected to wait 250ms more but got %v, %v", ok, wait)
+	}
+	clock.now = clock.now.Add(250 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Errorf("expected a token after 500ms")
+	}
+
+	// Full buckets are forgotten, and the others kept
+	clock.now = clock.now.Add(time.Minute)
+	l.Allow("c")
+	if len(l.buckets) != 1 {
+		t.Errorf("expected only the bucket of c to be left but got %d buckets", len(l.buckets))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware(Config{
+		IPRate:      1,
+		IPBurst:     3,
+		UserRate:    0.5,
+		UserBurst:   1,
+		UserOf:      func(r *http.Request) string { return r.URL.Query().Get("user") },
+		MaxBodySize: 10,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}))
+
+	tests := []struct {
+		remote     string
+		path       string
+		body       string
+		status     int
+		retryAfter string
+		expected   string
+	}{
+		{"10.0.0.1:1000", "/?user=alice", "", 200, "", ""},
+		{"10.0.0.1:1001", "/?user=alice", "", 429, "2", `{"error":{"code":"rate_limited","message":"Too many requests, retry in 2s."}}`},
+		{"10.0.0.1:1002", "/?user=bob", "", 200, "", ""},
+		{"10.0.0.1:1003", "/", "", 429, "1", `{"error":{"code":"rate_limited","message":"Too many requests, retry in 1s."}}`},
+		{"10.0.0.2:1000", "/", "0123456789", 200, "", ""},
+		{"10.0.0.2:1000", "/", "0123456789a", 413, "", `{"error":{"code":"body_too_large","message":"The body is larger than 10 bytes."}}`},
+	}
+
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+		req.RemoteAddr = tt.remote
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != tt.status || recorder.Header().Get("Retry-After") != tt.retryAfter || strings.TrimSpace(recorder.Body.String()) != tt.expected {
+			t.Errorf("request %d: expected %d %q %s but got %d %q %s", i, tt.status, tt.retryAfter, tt.expected, recorder.Code, recorder.Header().Get("Retry-After"), recorder.Body.String())
+		}
+	}
+
+	// Bodies without a length are cut when they're read
+	req := httptest.NewRequest("POST", "/", io.MultiReader(strings.NewReader("0123456789"), strings.NewReader("ab")))
+	req.ContentLength = -1
+	req.RemoteAddr = "10.0.0.3:1000"
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != 413 || !strings.Contains(recorder.Body.String(), "http: request body too large") {
+		t.Errorf("expected the body to be cut but got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestMiddlewareDisabled(t *testing.T) {
+	handler := Middleware(Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 100; i++ {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("a", 1<<16))))
+		if recorder.Code != 200 {
+			t.Fatalf("request %d: expected no limits but got %d", i, recorder.Code)
+		}
+	}
+}
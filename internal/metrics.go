@@ -0,0 +1,75 @@
+// internal/metrics.go
+package internal
+
+import (
+	"errors"
+	"os"
+	"time"
+	"virtual-file-system/internal/metrics"
+)
+
+// Metrics of the operations, registered in metrics.Default
+var (
+	operationsTotal = metrics.Default.Counter("vfs_operations_total",
+		"Operations run, by operation and outcome.", "operation", "outcome")
+	operationDuration = metrics.Default.Histogram("vfs_operation_duration_seconds",
+		"Time taken by the operations, including waiting for other operations and saving the data file.",
+		metrics.DurationBuckets, "operation", "outcome")
+	saveDuration = metrics.Default.Histogram("vfs_save_duration_seconds",
+		"Time taken to write the data file, by outcome.", metrics.DurationBuckets, "outcome")
+)
+
+func init() {
+	metrics.Default.GaugeFunc("vfs_users", "Registered users.", func() float64 {
+		users, _, _ := CountEntries()
+		return float64(users)
+	})
+	metrics.Default.GaugeFunc("vfs_folders", "Folders of all users.", func() float64 {
+		_, folders, _ := CountEntries()
+		return float64(folders)
+	})
+	metrics.Default.GaugeFunc("vfs_files", "Files of all users.", func() float64 {
+		_, _, files := CountEntries()
+		return float64(files)
+	})
+	metrics.Default.GaugeFunc("vfs_data_file_size_bytes", "Size of the data file, 0 before it's written.", func() float64 {
+		info, err := os.Stat(DataFile())
+		if err != nil {
+			return 0
+		}
+		return float64(info.Size())
+	})
+}
+
+// Outcome names the category of the error of an operation in the metrics: ok, not_found,
+// already_exists, invalid_name, invalid_sort, invalid_query, unauthorized, io_error or error
+func Outcome(err error) string {
+	var storageErr *StorageError
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrAlreadyExists):
+		return "already_exists"
+	case errors.Is(err, ErrInvalidName):
+		return "invalid_name"
+	case errors.Is(err, ErrInvalidSort):
+		return "invalid_sort"
+	case errors.Is(err, ErrInvalidQuery):
+		return "invalid_query"
+	case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrTokenExpired):
+		return "unauthorized"
+	case errors.As(err, &storageErr):
+		return "io_error"
+	}
+	return "error"
+}
+
+// observe counts an operation and records its duration. It's deferred at the start of the
+// operation with a pointer to its error result.
+func observe(operation string, start time.Time, err *error) {
+	outcome := Outcome(*err)
+	operationsTotal.Inc(operation, outcome)
+	operationDuration.Observe(time.Since(start).Seconds(), operation, outcome)
+}
@@ -0,0 +1,326 @@
+// internal/metrics/metrics.go
+
+// Package metrics keeps counters, histograms and gauges and serves them in the Prometheus
+// text exposition format (version 0.0.4), without the Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default is the registry of the metrics of the virtual file system
+var Default = NewRegistry()
+
+// DurationBuckets are the upper bounds, in seconds, of the latency histograms. Operations in
+// memory take microseconds, writing the data file milliseconds.
+var DurationBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// family is a metric and its series, written by Registry.WriteTo
+type family interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry keeps metrics to be written together. Metrics are registered once, usually in
+// package variables; registering a name twice panics.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.families[f.name()]; exists {
+		panic("metrics: " + f.name() + " is already registered")
+	}
+	r.families[f.name()] = f
+}
+
+// Counter registers a counter with the given label names
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{}
+	c.init(name, help, labels)
+	r.register(c)
+	return c
+}
+
+// Histogram registers a histogram with the given bucket upper bounds, in increasing order,
+// and label names
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{buckets: buckets}
+	h.init(name, help, labels)
+	r.register(h)
+	return h
+}
+
+// GaugeFunc registers a gauge whose value is read from value each time it's written.
+// value may be called concurrently.
+func (r *Registry) GaugeFunc(name, help string, value func() float64) {
+	r.register(&gaugeFunc{metric: name, help: help, value: value})
+}
+
+// WriteTo writes the metrics in the text exposition format, sorted by name
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+
+	counted := &countingWriter{w: w}
+	buffered := bufio.NewWriter(counted)
+	for _, f := range families {
+		f.write(buffered)
+	}
+	err := buffered.Flush()
+	return counted.n, err
+}
+
+// ServeHTTP answers GET and HEAD requests with the metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if req.Method == http.MethodHead {
+		return
+	}
+	r.WriteTo(w)
+}
+
+// countingWriter counts the bytes written for WriteTo
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// vec holds the series of a metric, keyed by their label values
+type vec struct {
+	metric string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string][]string
+}
+
+func (v *vec) init(name, help string, labels []string) {
+	v.metric, v.help, v.labels = name, help, labels
+	v.series = make(map[string][]string)
+}
+
+func (v *vec) name() string {
+	return v.metric
+}
+
+// key returns the key of the series with the given label values and records them.
+// The caller must hold mu.
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values but got %d", v.metric, len(v.labels), len(values)))
+	}
+	k := strings.Join(values, "\xff")
+	if _, exists := v.series[k]; !exists {
+		v.series[k] = append([]string(nil), values...)
+	}
+	return k
+}
+
+// sortedKeys returns the keys of the series in the order of their label values.
+// The caller must hold mu.
+func (v *vec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelPairs formats label names and values as name="value",... with the values escaped
+func labelPairs(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+// writeSample writes a line of a series, with braces only when there are labels
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a counter with labels
+type Counter struct {
+	vec
+	values map[string]float64
+}
+
+// Inc adds 1 to the series with the given label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta, which must not be negative, to the series with the given label values
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic("metrics: " + c.metric + " can't decrease")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]float64)
+	}
+	c.values[c.key(values)] += delta
+}
+
+// Value returns the value of the series with the given label values
+func (c *Counter) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(values, "\xff")]
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.metric, c.help, "counter")
+	for _, k := range c.sortedKeys() {
+		writeSample(w, c.metric, labelPairs(c.labels, c.series[k]), c.values[k])
+	}
+}
+
+// histogramSeries is the state of a series of a histogram
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Histogram counts observations in buckets, with labels
+type Histogram struct {
+	vec
+	buckets []float64
+	values  map[string]*histogramSeries
+}
+
+// Observe records a value in the series with the given label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.values == nil {
+		h.values = make(map[string]*histogramSeries)
+	}
+	k := h.key(values)
+	s, exists := h.values[k]
+	if !exists {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count returns how many values the series with the given label values recorded
+func (h *Histogram) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, exists := h.values[strings.Join(values, "\xff")]; exists {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.metric, h.help, "histogram")
+	names := append(append([]string(nil), h.labels...), "le")
+	for _, k := range h.sortedKeys() {
+		values := append(append([]string(nil), h.series[k]...), "")
+		s := h.values[k]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			values[len(values)-1] = formatFloat(bound)
+			writeSample(w, h.metric+"_bucket", labelPairs(names, values), float64(cumulative))
+		}
+		values[len(values)-1] = "+Inf"
+		writeSample(w, h.metric+"_bucket", labelPairs(names, values), float64(s.count))
+		labels := labelPairs(h.labels, h.series[k])
+		writeSample(w, h.metric+"_sum", labels, s.sum)
+		writeSample(w, h.metric+"_count", labels, float64(s.count))
+	}
+}
+
+// gaugeFunc is a gauge read when it's written
+type gaugeFunc struct {
+	metric string
+	help   string
+	value  func() float64
+}
+
+func (g *gaugeFunc) name() string {
+	return g.metric
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.metric, g.help, "gauge")
+	writeSample(w, g.metric, "", g.value())
+}
@@ -0,0 +1,87 @@
+// internal/metrics/metrics_test.go
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests by path.\nSecond line \\.", "path", "code")
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "path")
+	r.GaugeFunc("temperature", "Temperature.", func() float64 { return 21.5 })
+	empty := r.Counter("empty_total", "Nothing yet.")
+
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a \"quoted\"\n", "404")
+	requests.Inc("/b", "200")
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.1, "/a")
+	latency.Observe(3, "/a")
+
+	expected := `# HELP empty_total Nothing yet.
+# TYPE empty_total counter
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{path="/a",le="0.1"} 2
+latency_seconds_bucket{path="/a",le="1"} 2
+latency_seconds_bucket{path="/a",le="+Inf"} 3
+latency_seconds_sum{path="/a"} 3.15
+latency_seconds_count{path="/a"} 3
+# HELP requests_total Requests by path.\nSecond line \\.
+# TYPE requests_total counter
+requests_total{path="/a \"quoted\"\n",code="404"} 2
+requests_total{path="/b",code="200"} 2
+# HELP temperature Temperature.
+# TYPE temperature gauge
+temperature 21.5
+`
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) || buf.String() != expected {
+		t.Errorf("expected\n%s\nbut got %d, %v\n%s", expected, n, err, buf.String())
+	}
+	if requests.Value("/b", "200") != 2 || latency.Count("/a") != 3 || latency.Count("/b") != 0 || empty.Value() != 0 {
+		t.Errorf("unexpected values")
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("twice_total", "Twice.", "label")
+	tests := map[string]func(){
+		"registered twice":     func() { r.Counter("twice_total", "Twice.") },
+		"missing label values": func() { c.Inc() },
+		"negative delta":       func() { c.Add(-1, "value") },
+	}
+	for name, f := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.GaugeFunc("up", "Up.", func() float64 { return 1 })
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/plain; version=0.0.4; charset=utf-8" || rec.Body.String() != "# HELP up Up.\n# TYPE up gauge\nup 1\n" {
+		t.Errorf("expected the metrics but got %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("expected 405 but got %d %v", rec.Code, rec.Header())
+	}
+}
@@ -0,0 +1,98 @@
+// internal/metrics_test.go
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"virtual-file-system/internal/metrics"
+)
+
+func TestOutcome(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{nil, "ok"},
+		{errorDoesntExisted("a"), "not_found"},
+		{errorAlreayExisted("a"), "already_exists"},
+		{errorInvalidChars("a/b"), "invalid_name"},
+		{&SortError{Field: "size"}, "invalid_sort"},
+		{&QueryError{Option: "limit", Value: "-1", Err: errNegative}, "invalid_query"},
+		{ErrTokenExpired, "unauthorized"},
+		{&StorageError{Op: "saving data", Err: os.ErrPermission}, "io_error"},
+		{errors.New("other"), "error"},
+	}
+
+	for _, test := range tests {
+		if result := Outcome(test.err); result != test.expected {
+			t.Errorf("Outcome(%v) = %s; expected %s", test.err, result, test.expected)
+		}
+	}
+}
+
+func TestOperationMetrics(t *testing.T) {
+	setupMockData()
+	registered := operationsTotal.Value("register_user", "ok")
+	existing := operationsTotal.Value("register_user", "already_exists")
+	missing := operationsTotal.Value("create_folder", "not_found")
+	queried := operationDuration.Count("query_folders", "ok")
+
+	RegisterUser("user1")
+	RegisterUser("user1")
+	CreateFolder("user2", "folder1", "")
+	CreateFolder("user1", "folder1", "")
+	CreateFolder("user1", "folder2", "")
+	CreateFile("user1", "folder1", "file1", "")
+	ListFolders("user1", "", "")
+
+	if operationsTotal.Value("register_user", "ok") != registered+1 || operationsTotal.Value("register_user", "already_exists") != existing+1 || operationsTotal.Value("create_folder", "not_found") != missing+1 {
+		t.Errorf("expected the operations to be counted by outcome")
+	}
+	if operationDuration.Count("query_folders", "ok") != queried+1 {
+		t.Errorf("expected the listing to be timed")
+	}
+
+	var buf bytes.Buffer
+	metrics.Default.WriteTo(&buf)
+	for _, line := range []string{"vfs_users 1", "vfs_folders 2", "vfs_files 1", `vfs_operations_total{operation="create_file",outcome="ok"}`} {
+		if !strings.Contains(buf.String(), line+"\n") && !strings.Contains(buf.String(), line+" ") {
+			t.Errorf("expected the line %s in\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestSaveMetrics(t *testing.T) {
+	originalFile, originalMock := dataFile, useMockData
+	defer func() {
+		dataFile = originalFile
+		UseMockData(make(map[string]*User))
+		useMockData = originalMock
+	}()
+	UseMockData(map[string]*User{"user1": {Username: "user1", Folders: map[string]*Folder{}}})
+	useMockData = false
+	dataFile = filepath.Join(t.TempDir(), "data.json")
+	saved := saveDuration.Count("ok")
+	failed := saveDuration.Count("io_error")
+
+	if err := SaveData(); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(dataFile)
+	var buf bytes.Buffer
+	metrics.Default.WriteTo(&buf)
+	if size := fmt.Sprintf("vfs_data_file_size_bytes %d\n", info.Size()); !strings.Contains(buf.String(), size) {
+		t.Errorf("expected %q in\n%s", size, buf.String())
+	}
+	dataFile = filepath.Join(t.TempDir(), "missing", "data.json")
+	if err := SaveData(); err == nil {
+		t.Fatal("expected saving to a missing directory to fail")
+	}
+	if saveDuration.Count("ok") != saved+1 || saveDuration.Count("io_error") != failed+1 {
+		t.Errorf("expected the saves to be timed by outcome")
+	}
+}
@@ -0,0 +1,410 @@
+// internal/ninep/message.go
+package ninep
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Message types of 9P2000
+const (
+	Tversion = 100 + iota
+	Rversion
+	Tauth
+	Rauth
+	Tattach
+	Rattach
+	Terror // not a valid message
+	Rerror
+	Tflush
+	Rflush
+	Twalk
+	Rwalk
+	Topen
+	Ropen
+	Tcreate
+	Rcreate
+	Tread
+	Rread
+	Twrite
+	Rwrite
+	Tclunk
+	Rclunk
+	Tremove
+	Rremove
+	Tstat
+	Rstat
+	Twstat
+	Rwstat
+)
+
+// Open modes
+const (
+	OREAD   = 0
+	OWRITE  = 1
+	ORDWR   = 2
+	OEXEC   = 3
+	OTRUNC  = 0x10
+	ORCLOSE = 0x40
+)
+
+// QTDIR is the qid type of directories, and DMDIR the matching bit of the permissions
+const (
+	QTDIR = 0x80
+	DMDIR = 0x80000000
+)
+
+// NOTAG and NOFID mark the absence of a tag or a fid
+const (
+	NOTAG = 0xffff
+	NOFID = 0xffffffff
+)
+
+// Version is the only protocol version spoken
+const Version = "9P2000"
+
+// headerSize is the size of size[4] type[1] tag[2], and ioHeaderSize the overhead of Rread and Twrite
+const (
+	headerSize   = 7
+	ioHeaderSize = 24
+)
+
+// maxWalkNames is the most names a single Twalk may hold
+const maxWalkNames = 16
+
+var errShortMessage = errors.New("9P message too short")
+
+// Qid identifies a file on the server
+type Qid struct {
+	Type    uint8
+	Version uint32
+	Path    uint64
+}
+
+// Dir is the stat of a file
+type Dir struct {
+	Type   uint16
+	Dev    uint32
+	Qid    Qid
+	Mode   uint32
+	Atime  uint32
+	Mtime  uint32
+	Length uint64
+	Name   string
+	Uid    string
+	Gid    string
+	Muid   string
+}
+
+// Fcall is any 9P message. Only the fields of its Type are meaningful.
+type Fcall struct {
+	Type    uint8
+	Tag     uint16
+	Fid     uint32
+	Afid    uint32
+	Newfid  uint32
+	Msize   uint32
+	Version string
+	Oldtag  uint16
+	Ename   string
+	Uname   string
+	Aname   string
+	Qid     Qid
+	Iounit  uint32
+	Wnames  []string
+	Wqids   []Qid
+	Mode    uint8
+	Perm    uint32
+	Name    string
+	Offset  uint64
+	Count   uint32
+	Data    []byte
+	Stat    []byte
+}
+
+// encoder appends little-endian values to a buffer
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) u8(v uint8)   { e.buf = append(e.buf, v) }
+func (e *encoder) u16(v uint16) { e.buf = binary.LittleEndian.AppendUint16(e.buf, v) }
+func (e *encoder) u32(v uint32) { e.buf = binary.LittleEndian.AppendUint32(e.buf, v) }
+func (e *encoder) u64(v uint64) { e.buf = binary.LittleEndian.AppendUint64(e.buf, v) }
+
+func (e *encoder) str(s string) {
+	e.u16(uint16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) qid(q Qid) {
+	e.u8(q.Type)
+	e.u32(q.Version)
+	e.u64(q.Path)
+}
+
+// decoder reads little-endian values from a buffer, remembering the first overrun
+type decoder struct {
+	buf  []byte
+	err  error
+	zero [8]byte
+}
+
+// take returns the next n bytes, or nil once the buffer is overrun. Counts come from the
+// wire, so nothing is allocated for them.
+func (d *decoder) take(n int) []byte {
+	if d.err != nil || n < 0 || len(d.buf) < n {
+		d.err = errShortMessage
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+// fixed returns the next n bytes of a value of at most 8 bytes, zeros once the buffer is overrun
+func (d *decoder) fixed(n int) []byte {
+	if b := d.take(n); b != nil {
+		return b
+	}
+	return d.zero[:n]
+}
+
+func (d *decoder) u8() uint8   { return d.fixed(1)[0] }
+func (d *decoder) u16() uint16 { return binary.LittleEndian.Uint16(d.fixed(2)) }
+func (d *decoder) u32() uint32 { return binary.LittleEndian.Uint32(d.fixed(4)) }
+func (d *decoder) u64() uint64 { return binary.LittleEndian.Uint64(d.fixed(8)) }
+func (d *decoder) str() string { return string(d.take(int(d.u16()))) }
+
+func (d *decoder) qid() Qid {
+	return Qid{Type: d.u8(), Version: d.u32(), Path: d.u64()}
+}
+
+// MarshalDir encodes a stat, including its leading size
+func MarshalDir(dir Dir) []byte {
+	var e encoder
+	e.u16(0)
+	e.u16(dir.Type)
+	e.u32(dir.Dev)
+	e.qid(dir.Qid)
+	e.u32(dir.Mode)
+	e.u32(dir.Atime)
+	e.u32(dir.Mtime)
+	e.u64(dir.Length)
+	e.str(dir.Name)
+	e.str(dir.Uid)
+	e.str(dir.Gid)
+	e.str(dir.Muid)
+	binary.LittleEndian.PutUint16(e.buf, uint16(len(e.buf)-2))
+	return e.buf
+}
+
+// UnmarshalDir decodes a stat and returns the bytes following it
+func UnmarshalDir(b []byte) (Dir, []byte, error) {
+	d := decoder{buf: b}
+	size := int(d.u16())
+	if d.err != nil || len(d.buf) < size {
+		return Dir{}, nil, errShortMessage
+	}
+	rest := d.buf[size:]
+	d.buf = d.buf[:size]
+	dir := Dir{
+		Type:   d.u16(),
+		Dev:    d.u32(),
+		Qid:    d.qid(),
+		Mode:   d.u32(),
+		Atime:  d.u32(),
+		Mtime:  d.u32(),
+		Length: d.u64(),
+		Name:   d.str(),
+		Uid:    d.str(),
+		Gid:    d.str(),
+		Muid:   d.str(),
+	}
+	return dir, rest, d.err
+}
+
+// Marshal encodes a message, including its leading size
+func Marshal(f *Fcall) ([]byte, error) {
+	e := encoder{buf: make([]byte, 4, headerSize+len(f.Data)+len(f.Stat)+64)}
+	e.u8(f.Type)
+	e.u16(f.Tag)
+	switch f.Type {
+	case Tversion, Rversion:
+		e.u32(f.Msize)
+		e.str(f.Version)
+	case Tauth:
+		e.u32(f.Afid)
+		e.str(f.Uname)
+		e.str(f.Aname)
+	case Rauth, Rattach:
+		e.qid(f.Qid)
+	case Tattach:
+		e.u32(f.Fid)
+		e.u32(f.Afid)
+		e.str(f.Uname)
+		e.str(f.Aname)
+	case Rerror:
+		e.str(f.Ename)
+	case Tflush:
+		e.u16(f.Oldtag)
+	case Twalk:
+		e.u32(f.Fid)
+		e.u32(f.Newfid)
+		e.u16(uint16(len(f.Wnames)))
+		for _, name := range f.Wnames {
+			e.str(name)
+		}
+	case Rwalk:
+		e.u16(uint16(len(f.Wqids)))
+		for _, q := range f.Wqids {
+			e.qid(q)
+		}
+	case Topen:
+		e.u32(f.Fid)
+		e.u8(f.Mode)
+	case Ropen, Rcreate:
+		e.qid(f.Qid)
+		e.u32(f.Iounit)
+	case Tcreate:
+		e.u32(f.Fid)
+		e.str(f.Name)
+		e.u32(f.Perm)
+		e.u8(f.Mode)
+	case Tread:
+		e.u32(f.Fid)
+		e.u64(f.Offset)
+		e.u32(f.Count)
+	case Rread:
+		e.u32(uint32(len(f.Data)))
+		e.buf = append(e.buf, f.Data...)
+	case Twrite:
+		e.u32(f.Fid)
+		e.u64(f.Offset)
+		e.u32(uint32(len(f.Data)))
+		e.buf = append(e.buf, f.Data...)
+	case Rwrite:
+		e.u32(f.Count)
+	case Tclunk, Tremove, Tstat:
+		e.u32(f.Fid)
+	case Rstat:
+		e.u16(uint16(len(f.Stat)))
+		e.buf = append(e.buf, f.Stat...)
+	case Twstat:
+		e.u32(f.Fid)
+		e.u16(uint16(len(f.Stat)))
+		e.buf = append(e.buf, f.Stat...)
+	case Rflush, Rclunk, Rremove, Rwstat:
+	default:
+		return nil, fmt.Errorf("unknown 9P message type %d", f.Type)
+	}
+	binary.LittleEndian.PutUint32(e.buf, uint32(len(e.buf)))
+	return e.buf, nil
+}
+
+// Unmarshal decodes a message without its leading size
+func Unmarshal(b []byte) (*Fcall, error) {
+	d := decoder{buf: b}
+	f := &Fcall{Type: d.u8(), Tag: d.u16()}
+	switch f.Type {
+	case Tversion, Rversion:
+		f.Msize = d.u32()
+		f.Version = d.str()
+	case Tauth:
+		f.Afid = d.u32()
+		f.Uname = d.str()
+		f.Aname = d.str()
+	case Rauth, Rattach:
+		f.Qid = d.qid()
+	case Tattach:
+		f.Fid = d.u32()
+		f.Afid = d.u32()
+		f.Uname = d.str()
+		f.Aname = d.str()
+	case Rerror:
+		f.Ename = d.str()
+	case Tflush:
+		f.Oldtag = d.u16()
+	case Twalk:
+		f.Fid = d.u32()
+		f.Newfid = d.u32()
+		n := int(d.u16())
+		if n > maxWalkNames {
+			return nil, fmt.Errorf("walk of %d names, more than %d", n, maxWalkNames)
+		}
+		for i := 0; i < n && d.err == nil; i++ {
+			f.Wnames = append(f.Wnames, d.str())
+		}
+	case Rwalk:
+		n := int(d.u16())
+		for i := 0; i < n && d.err == nil; i++ {
+			f.Wqids = append(f.Wqids, d.qid())
+		}
+	case Topen:
+		f.Fid = d.u32()
+		f.Mode = d.u8()
+	case Ropen, Rcreate:
+		f.Qid = d.qid()
+		f.Iounit = d.u32()
+	case Tcreate:
+		f.Fid = d.u32()
+		f.Name = d.str()
+		f.Perm = d.u32()
+		f.Mode = d.u8()
+	case Tread:
+		f.Fid = d.u32()
+		f.Offset = d.u64()
+		f.Count = d.u32()
+	case Rread:
+		f.Data = d.take(int(d.u32()))
+	case Twrite:
+		f.Fid = d.u32()
+		f.Offset = d.u64()
+		f.Data = d.take(int(d.u32()))
+	case Rwrite:
+		f.Count = d.u32()
+	case Tclunk, Tremove, Tstat:
+		f.Fid = d.u32()
+	case Rstat:
+		f.Stat = d.take(int(d.u16()))
+	case Twstat:
+		f.Fid = d.u32()
+		f.Stat = d.take(int(d.u16()))
+	case Rflush, Rclunk, Rremove, Rwstat:
+	default:
+		return nil, fmt.Errorf("unknown 9P message type %d", f.Type)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return f, nil
+}
+
+// ReadMessage reads a message of at most msize bytes
+func ReadMessage(r io.Reader, msize uint32) (*Fcall, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n < headerSize || n > msize {
+		return nil, fmt.Errorf("9P message of %d bytes, expected %d to %d", n, headerSize, msize)
+	}
+	b := make([]byte, n-4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return Unmarshal(b)
+}
+
+// WriteMessage writes a message
+func WriteMessage(w io.Writer, f *Fcall) error {
+	b, err := Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
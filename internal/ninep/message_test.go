@@ -0,0 +1,105 @@
+// internal/ninep/message_test.go
+package ninep
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	stat := MarshalDir(Dir{Qid: Qid{Type: QTDIR, Path: 7}, Mode: DMDIR | 0755, Name: "docs", Uid: "alice"})
+	tests := []*Fcall{
+		{Type: Tversion, Tag: NOTAG, Msize: 8192, Version: Version},
+		{Type: Tattach, Tag: 1, Fid: 1, Afid: NOFID, Uname: "alice", Aname: ""},
+		{Type: Rattach, Tag: 1, Qid: Qid{Type: QTDIR, Version: 2, Path: 3}},
+		{Type: Rerror, Tag: 1, Ename: "The bob doesn't exist."},
+		{Type: Twalk, Tag: 2, Fid: 1, Newfid: 2, Wnames: []string{"alice", "docs"}},
+		{Type: Rwalk, Tag: 2, Wqids: []Qid{{Type: QTDIR, Path: 1}, {Path: 2}}},
+		{Type: Tcreate, Tag: 3, Fid: 2, Name: "notes", Perm: 0644, Mode: ORDWR},
+		{Type: Tread, Tag: 4, Fid: 2, Offset: 10, Count: 100},
+		{Type: Rread, Tag: 4, Data: []byte("hello")},
+		{Type: Twrite, Tag: 5, Fid: 2, Offset: 5, Data: []byte(" world")},
+		{Type: Rwrite, Tag: 5, Count: 6},
+		{Type: Rstat, Tag: 6, Stat: stat},
+		{Type: Twstat, Tag: 7, Fid: 2, Stat: stat},
+		{Type: Rclunk, Tag: 8},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := WriteMessage(&buf, tt); err != nil {
+			t.Fatalf("WriteMessage(%+v) returned error: %v", tt, err)
+		}
+		got, err := ReadMessage(&buf, maxMsize)
+		if err != nil {
+			t.Fatalf("ReadMessage of %+v returned error: %v", tt, err)
+		}
+		if !reflect.DeepEqual(got, tt) {
+			t.Errorf("expected %+v but got %+v", tt, got)
+		}
+	}
+
+	dir, rest, err := UnmarshalDir(stat)
+	if err != nil || len(rest) != 0 || dir.Name != "docs" || dir.Uid != "alice" || dir.Mode != DMDIR|0755 || dir.Qid.Path != 7 {
+		t.Errorf("UnmarshalDir = %+v, %v, %v; expected docs", dir, rest, err)
+	}
+}
+
+func TestMessageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", []byte{9, 0, 0, 0, Tclunk, 1, 0}},
+		{"too small", []byte{3, 0, 0, 0}},
+		{"unknown type", []byte{7, 0, 0, 0, 99, 1, 0}},
+		{"short body", []byte{9, 0, 0, 0, Tclunk, 1, 0, 1, 0}},
+	}
+
+	for _, tt := range tests {
+		if f, err := ReadMessage(bytes.NewReader(tt.data), maxMsize); err == nil {
+			t.Errorf("%s: expected an error but got %+v", tt.name, f)
+		}
+	}
+	if _, err := ReadMessage(bytes.NewReader([]byte{0, 0, 1, 0}), 256); err == nil {
+		t.Errorf("expected an error for a message larger than msize")
+	}
+}
+
+func TestUnmarshalOversizedCount(t *testing.T) {
+	// A Twrite of fid 1 at offset 0 declaring 0xFFFFFFFF bytes of data, but holding none
+	data := []byte{Twrite, 1, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	f, err := Unmarshal(data)
+	runtime.ReadMemStats(&after)
+	if err == nil {
+		t.Errorf("expected an error but got %+v", f)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("expected the count to be checked before allocating but %d bytes were allocated", allocated)
+	}
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	for _, m := range []*Fcall{
+		{Type: Tversion, Tag: 0xffff, Msize: 8192, Version: Version},
+		{Type: Twalk, Tag: 1, Fid: 1, Newfid: 2, Wnames: []string{"alice", "docs"}},
+		{Type: Twrite, Tag: 1, Fid: 2, Data: []byte("hello")},
+		{Type: Twstat, Tag: 1, Fid: 2, Stat: MarshalDir(Dir{Name: "docs"})},
+	} {
+		b, _ := Marshal(m)
+		f.Add(b[4:])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := Unmarshal(data)
+		if err != nil {
+			return
+		}
+		if len(m.Data) > len(data) || len(m.Stat) > len(data) {
+			t.Errorf("decoded %d bytes of data from a %d byte message", len(m.Data)+len(m.Stat), len(data))
+		}
+	})
+}
@@ -0,0 +1,648 @@
+// internal/ninep/server.go
+
+// Package ninep serves the virtual file system over the 9P2000 protocol.
+// The root directory holds a directory per user, which holds a directory per folder, which
+// holds the files. Files have no content besides their description, so reading a file
+// returns its description and writing a file changes it.
+package ninep
+
+import (
+	"errors"
+	"hash/fnv"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"virtual-file-system/internal"
+)
+
+// maxMsize is the largest message size accepted in Tversion
+const maxMsize = 64*1024 + ioHeaderSize
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("9P server closed")
+
+// Errors of the protocol, sent to the client as Rerror
+var (
+	errUnknownFid    = errors.New("unknown fid")
+	errFidInUse      = errors.New("fid already in use")
+	errFidOpen       = errors.New("fid already open")
+	errNotOpen       = errors.New("fid not open for this operation")
+	errNotDir        = errors.New("not a directory")
+	errIsDir         = errors.New("is a directory")
+	errPermission    = errors.New("permission denied")
+	errBadOffset     = errors.New("bad directory read offset")
+	errNoAuth        = errors.New("authentication not required")
+	errNoVersion     = errors.New("Tversion required first")
+	errBadWstat      = errors.New("only the name, length and times can be changed")
+	errPastTheEnd    = errors.New("write past the end of the file")
+	errUnknownMsg    = errors.New("unknown message type")
+	errMsizeTooSmall = errors.New("msize too small")
+)
+
+// Levels of the tree a node is at
+const (
+	levelRoot = iota
+	levelUser
+	levelFolder
+	levelFile
+)
+
+// node is a file of the tree, named by the path leading to it
+type node struct {
+	level  int
+	user   string
+	folder string
+	file   string
+}
+
+// name returns the last element of the path of n
+func (n node) name() string {
+	return []string{"/", n.user, n.folder, n.file}[n.level]
+}
+
+// parent returns the directory holding n. The root is its own parent.
+func (n node) parent() node {
+	switch n.level {
+	case levelFile:
+		return node{level: levelFolder, user: n.user, folder: n.folder}
+	case levelFolder:
+		return node{level: levelUser, user: n.user}
+	}
+	return node{level: levelRoot}
+}
+
+// child returns the node named name inside the directory n
+func (n node) child(name string) node {
+	c := n
+	c.level++
+	switch c.level {
+	case levelUser:
+		c.user = name
+	case levelFolder:
+		c.folder = name
+	case levelFile:
+		c.file = name
+	}
+	return c
+}
+
+// qid returns the qid of n. Its path is a hash of the names, so it stays the same across
+// connections and restarts.
+func (n node) qid() Qid {
+	h := fnv.New64a()
+	io.WriteString(h, strings.Join([]string{n.user, n.folder, n.file}[:n.level], "/"))
+	q := Qid{Path: h.Sum64()}
+	if n.level < levelFile {
+		q.Type = QTDIR
+	}
+	return q
+}
+
+// stat returns the stat of n, failing when n doesn't exist
+func stat(n node) (Dir, error) {
+	dir := Dir{Qid: n.qid(), Name: n.name(), Uid: n.user, Gid: n.user, Muid: n.user, Mode: DMDIR | 0755}
+	if n.level == levelRoot {
+		dir.Uid, dir.Gid, dir.Muid = "vfs", "vfs", "vfs"
+	}
+	switch n.level {
+	case levelUser:
+		if _, err := internal.GetUser(n.user); err != nil {
+			return Dir{}, err
+		}
+	case levelFolder:
+		folder, err := internal.GetFolder(n.user, n.folder)
+		if err != nil {
+			return Dir{}, err
+		}
+		dir.Mtime = uint32(folder.CreatedAt.Unix())
+	case levelFile:
+		file, err := internal.GetFile(n.user, n.folder, n.file)
+		if err != nil {
+			return Dir{}, err
+		}
+		dir.Mode = 0644
+		dir.Mtime = uint32(file.CreatedAt.Unix())
+		dir.Length = uint64(len(file.Description))
+	}
+	dir.Atime = dir.Mtime
+	return dir, nil
+}
+
+// children returns the nodes inside the directory n, sorted by name
+func children(n node) ([]node, error) {
+	var names []string
+	switch n.level {
+	case levelRoot:
+		names = internal.ListUsers()
+	case levelUser:
+		folders, err := internal.ListFolders(n.user, "name", "asc")
+		if err != nil {
+			return nil, err
+		}
+		for _, folder := range folders {
+			names = append(names, folder.Name)
+		}
+	case levelFolder:
+		files, err := internal.ListFiles(n.user, n.folder, "name", "asc")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			names = append(names, file.Name)
+		}
+	default:
+		return nil, errNotDir
+	}
+	result := make([]node, len(names))
+	for i, name := range names {
+		result[i] = n.child(name)
+	}
+	return result, nil
+}
+
+// description returns the content of the file n
+func description(n node) (string, error) {
+	file, err := internal.GetFile(n.user, n.folder, n.file)
+	if err != nil {
+		return "", err
+	}
+	return file.Description, nil
+}
+
+// fid is a handle of a client on a node
+type fid struct {
+	node node
+	open bool
+	mode uint8
+
+	// The entries of an open directory, and where the next read starts
+	entries   [][]byte
+	nextEntry int
+	nextRead  uint64
+}
+
+// Server serves 9P2000 connections. Each connection is a separate session.
+type Server struct {
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[io.Closer]struct{}
+}
+
+// NewServer returns a server of the virtual file system
+func NewServer() *Server {
+	return &Server{listeners: map[net.Listener]struct{}{}, conns: map[io.Closer]struct{}{}}
+}
+
+// Serve accepts connections on l until Close, serving each one in its own goroutine
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+// ServeConn serves a single connection until the client hangs up or the server is closed
+func (s *Server) ServeConn(rw io.ReadWriteCloser) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		rw.Close()
+		return
+	}
+	s.conns[rw] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, rw)
+		s.mu.Unlock()
+		rw.Close()
+	}()
+
+	c := &conn{msize: maxMsize, fids: map[uint32]*fid{}}
+	for {
+		req, err := ReadMessage(rw, c.msize)
+		if err != nil {
+			return
+		}
+		resp, err := c.handle(req)
+		if err != nil {
+			resp = &Fcall{Type: Rerror, Ename: err.Error()}
+		}
+		resp.Tag = req.Tag
+		if err := WriteMessage(rw, resp); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops the listeners and hangs up every connection
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if closeErr := l.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return err
+}
+
+// conn is the state of a session. Its requests are handled one at a time.
+type conn struct {
+	msize      uint32
+	negotiated bool
+	fids       map[uint32]*fid
+}
+
+// handle answers a request
+func (c *conn) handle(req *Fcall) (*Fcall, error) {
+	if req.Type == Tversion {
+		return c.version(req)
+	}
+	if !c.negotiated {
+		return nil, errNoVersion
+	}
+	switch req.Type {
+	case Tauth:
+		return nil, errNoAuth
+	case Tattach:
+		return c.attach(req)
+	case Tflush:
+		// Requests are answered in order, so the flushed one has already been
+		return &Fcall{Type: Rflush}, nil
+	case Twalk:
+		return c.walk(req)
+	case Topen:
+		return c.open(req)
+	case Tcreate:
+		return c.create(req)
+	case Tread:
+		return c.read(req)
+	case Twrite:
+		return c.write(req)
+	case Tclunk:
+		return c.clunk(req)
+	case Tremove:
+		return c.remove(req)
+	case Tstat:
+		return c.stat(req)
+	case Twstat:
+		return c.wstat(req)
+	}
+	return nil, errUnknownMsg
+}
+
+// lookup returns the fid of a request
+func (c *conn) lookup(id uint32) (*fid, error) {
+	f, ok := c.fids[id]
+	if !ok {
+		return nil, errUnknownFid
+	}
+	return f, nil
+}
+
+// version negotiates the message size and the protocol, and ends the previous session
+func (c *conn) version(req *Fcall) (*Fcall, error) {
+	if req.Msize < 256 {
+		return nil, errMsizeTooSmall
+	}
+	c.msize = min(req.Msize, maxMsize)
+	c.fids = map[uint32]*fid{}
+	version, _, _ := strings.Cut(req.Version, ".")
+	if version != Version {
+		c.negotiated = false
+		return &Fcall{Type: Rversion, Msize: c.msize, Version: "unknown"}, nil
+	}
+	c.negotiated = true
+	return &Fcall{Type: Rversion, Msize: c.msize, Version: Version}, nil
+}
+
+// attach starts at the root, or at the user named by aname
+func (c *conn) attach(req *Fcall) (*Fcall, error) {
+	if _, ok := c.fids[req.Fid]; ok {
+		return nil, errFidInUse
+	}
+	if req.Afid != NOFID {
+		return nil, errNoAuth
+	}
+	n := node{level: levelRoot}
+	if aname := strings.Trim(req.Aname, "/"); aname != "" {
+		n = n.child(internal.NormalizeName(aname))
+		if _, err := stat(n); err != nil {
+			return nil, err
+		}
+	}
+	c.fids[req.Fid] = &fid{node: n}
+	return &Fcall{Type: Rattach, Qid: n.qid()}, nil
+}
+
+// walk follows names from a fid. A walk failing after the first name returns the qids
+// of the names it could follow, and leaves newfid unset.
+func (c *conn) walk(req *Fcall) (*Fcall, error) {
+	f, err := c.lookup(req.Fid)
+	if err != nil {
+		return nil, err
+	}
+	if f.open {
+		return nil, errFidOpen
+	}
+	if _, ok := c.fids[req.Newfid]; ok && req.Newfid != req.Fid {
+		return nil, errFidInUse
+	}
+
+	n := f.node
+	var qids []Qid
+	for i, name := range req.Wnames {
+		var next node
+		switch {
+		case n.level == levelFile:
+			err = errNotDir
+		case name == "..":
+			next = n.parent()
+		case name == "." || name == "" || strings.Contains(name, "/"):
+			err = internal.ErrNotFound
+		default:
+			// Walks, creates and renames all use the names as they are stored
+			next = n.child(internal.NormalizeName(name))
+			_, err = stat(next)
+		}
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			return &Fcall{Type: Rwalk, Wqids: qids}, nil
+		}
+		n = next
+		qids = append(qids, n.qid())
+	}
+	c.fids[req.Newfid] = &fid{node: n}
+	return &Fcall{Type: Rwalk, Wqids: qids}, nil
+}
+
+// readable and writable report whether an open mode allows reading and writing
+func readable(mode uint8) bool { return mode&3 != OWRITE }
+func writable(mode uint8) bool { return mode&3 == OWRITE || mode&3 == ORDWR }
+
+// open opens a fid. Directories can only be read, and OTRUNC empties a file.
+func (c *conn) open(req *Fcall) (*Fcall, error) {
+	f, err := c.lookup(req.Fid)
+	if err != nil {
+		return nil, err
+	}
+	if f.open {
+		return nil, errFidOpen
+	}
+	if _, err := stat(f.node); err != nil {
+		return nil, err
+	}
+	if f.node.level < levelFile && (writable(req.Mode) || req.Mode&OTRUNC != 0) {
+		return nil, errIsDir
+	}
+	if req.Mode&OTRUNC != 0 && writable(req.Mode) {
+		n := f.node
+		if err := internal.SetFileDescription(n.user, n.folder, n.file, ""); err != nil {
+			return nil, err
+		}
+	}
+	f.open, f.mode, f.entries = true, req.Mode, nil
+	return &Fcall{Type: Ropen, Qid: f.node.qid(), Iounit: c.msize - ioHeaderSize}, nil
+}
+
+// create makes a user in the root, a folder in a user or a file in a folder, then opens it
+func (c *conn) create(req *Fcall) (*Fcall, error) {
+	f, err := c.lookup(req.Fid)
+	if err != nil {
+		return nil, err
+	}
+	if f.open {
+		return nil, errFidOpen
+	}
+	parent := f.node
+	if parent.level == levelFile {
+		return nil, errNotDir
+	}
+	isDir := req.Perm&DMDIR != 0
+	if isDir != (parent.level < levelFolder) || (isDir && writable(req.Mode)) {
+		return nil, errPermission
+	}
+
+	n := parent.child(internal.NormalizeName(req.Name))
+	switch n.level {
+	case levelUser:
+		err = internal.RegisterUser(n.user)
+	case levelFolder:
+		err = internal.CreateFolder(n.user, n.folder, "")
+	case levelFile:
+		err = internal.CreateFile(n.user, n.folder, n.file, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.node, f.open, f.mode, f.entries = n, true, req.Mode, nil
+	return &Fcall{Type: Rcreate, Qid: n.qid(), Iounit: c.msize - ioHeaderSize}, nil
+}
+
+// read returns the description of a file, or whole stats of the entries of a directory
+func (c *conn) read(req *Fcall) (*Fcall, error) {
+	f, err := c.lookup(req.Fid)
+	if err != nil {
+		return nil, err
+	}
+	if !f.open || !readable(f.mode) {
+		return nil, errNotOpen
+	}
+	count := min(req.Count, c.msize-ioHeaderSize)
+
+	if f.node.level == levelFile {
+		text, err := description(f.node)
+		if err != nil {
+			return nil, err
+		}
+		if req.Offset >= uint64(len(text)) {
+			return &Fcall{Type: Rread}, nil
+		}
+		end := min(req.Offset+uint64(count), uint64(len(text)))
+		return &Fcall{Type: Rread, Data: []byte(text[req.Offset:end])}, nil
+	}
+
+	if req.Offset == 0 {
+		list, err := children(f.node)
+		if err != nil {
+			return nil, err
+		}
+		f.entries, f.nextEntry, f.nextRead = nil, 0, 0
+		for _, child := range list {
+			// An entry removed since the listing is skipped
+			if dir, err := stat(child); err == nil {
+				f.entries = append(f.entries, MarshalDir(dir))
+			}
+		}
+	} else if req.Offset != f.nextRead {
+		return nil, errBadOffset
+	}
+	var data []byte
+	for f.nextEntry < len(f.entries) && len(data)+len(f.entries[f.nextEntry]) <= int(count) {
+		data = append(data, f.entries[f.nextEntry]...)
+		f.nextEntry++
+	}
+	f.nextRead += uint64(len(data))
+	return &Fcall{Type: Rread, Data: data}, nil
+}
+
+// write replaces the bytes of the description of a file from the offset on
+func (c *conn) write(req *Fcall) (*Fcall, error) {
+	f, err := c.lookup(req.Fid)
+	if err != nil {
+		return nil, err
+	}
+	if !f.open || !writable(f.mode) {
+		return nil, errNotOpen
+	}
+	n := f.node
+	text, err := description(n)
+	if err != nil {
+		return nil, err
+	}
+	if req.Offset > uint64(len(text)) {
+		return nil, errPastTheEnd
+	}
+	updated := text[:req.Offset] + string(req.Data)
+	if end := req.Offset + uint64(len(req.Data)); end < uint64(len(text)) {
+		updated += text[end:]
+	}
+	if err := internal.SetFileDescription(n.user, n.folder, n.file, updated); err != nil {
+		return nil, err
+	}
+	return &Fcall{Type: Rwrite, Count: uint32(len(req.Data))}, nil
+}
+
+// clunk forgets a fid, removing its node when it was opened with ORCLOSE
+func (c *conn) clunk(req *Fcall) (*Fcall, error) {
+	f, err := c.lookup(req.Fid)
+	if err != nil {
+		return nil, err
+	}
+	delete(c.fids, req.Fid)
+	if f.open && f.mode&ORCLOSE != 0 {
+		if err := removeNode(f.node); err != nil {
+			return nil, err
+		}
+	}
+	return &Fcall{Type: Rclunk}, nil
+}
+
+// remove deletes the node of a fid and forgets the fid, even when the deletion fails
+func (c *conn) remove(req *Fcall) (*Fcall, error) {
+	f, err := c.lookup(req.Fid)
+	if err != nil {
+		return nil, err
+	}
+	delete(c.fids, req.Fid)
+	if err := removeNode(f.node); err != nil {
+		return nil, err
+	}
+	return &Fcall{Type: Rremove}, nil
+}
+
+// removeNode deletes a folder or a file. Users and the root can't be removed.
+func removeNode(n node) error {
+	switch n.level {
+	case levelFolder:
+		return internal.DeleteFolder(n.user, n.folder)
+	case levelFile:
+		return internal.DeleteFile(n.user, n.folder, n.file)
+	}
+	return errPermission
+}
+
+func (c *conn) stat(req *Fcall) (*Fcall, error) {
+	f, err := c.lookup(req.Fid)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := stat(f.node)
+	if err != nil {
+		return nil, err
+	}
+	return &Fcall{Type: Rstat, Stat: MarshalDir(dir)}, nil
+}
+
+// wstat renames a folder or a file, or truncates a file. Changes of the times are
+// accepted and ignored, since the creation time is kept.
+func (c *conn) wstat(req *Fcall) (*Fcall, error) {
+	f, err := c.lookup(req.Fid)
+	if err != nil {
+		return nil, err
+	}
+	dir, _, err := UnmarshalDir(req.Stat)
+	if err != nil {
+		return nil, err
+	}
+	current, err := stat(f.node)
+	if err != nil {
+		return nil, err
+	}
+	n := f.node
+
+	const keep32, keep64 = ^uint32(0), ^uint64(0)
+	if (dir.Mode != keep32 && dir.Mode != current.Mode) || (dir.Gid != "" && dir.Gid != current.Gid) ||
+		(dir.Uid != "" && dir.Uid != current.Uid) || (dir.Muid != "" && dir.Muid != current.Muid) {
+		return nil, errBadWstat
+	}
+	truncate := dir.Length != keep64 && dir.Length != current.Length
+	if truncate && (n.level != levelFile || dir.Length > current.Length) {
+		return nil, errBadWstat
+	}
+	name := internal.NormalizeName(dir.Name)
+	rename := name != "" && name != n.name()
+	if rename && n.level < levelFolder {
+		return nil, errPermission
+	}
+
+	if truncate {
+		text, err := description(n)
+		if err != nil {
+			return nil, err
+		}
+		if err := internal.SetFileDescription(n.user, n.folder, n.file, text[:dir.Length]); err != nil {
+			return nil, err
+		}
+	}
+	if rename {
+		if n.level == levelFolder {
+			err = internal.RenameFolder(n.user, n.folder, name)
+		} else {
+			err = internal.MoveFile(n.user, n.folder, n.file, n.folder, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.node = n.parent().child(name)
+	}
+	return &Fcall{Type: Rwstat}, nil
+}
@@ -0,0 +1,287 @@
+// internal/ninep/server_test.go
+package ninep
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"virtual-file-system/internal"
+)
+
+// client is a minimal 9P client speaking to a server in the same process
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	tag  uint16
+}
+
+// newClient connects to a server over a pipe and negotiates the version
+func newClient(t *testing.T) *client {
+	t.Helper()
+	internal.UseMockData(make(map[string]*internal.User))
+	server := NewServer()
+	clientConn, serverConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	t.Cleanup(func() { server.Close() })
+
+	c := &client{t: t, conn: clientConn}
+	resp, err := c.rpc(&Fcall{Type: Tversion, Tag: NOTAG, Msize: 8192, Version: "9P2000"})
+	if err != nil || resp.Version != Version || resp.Msize != 8192 {
+		t.Fatalf("Tversion = %+v, %v; expected 9P2000 with msize 8192", resp, err)
+	}
+	return c
+}
+
+// rpc sends a request and returns its response, or the Rerror as an error
+func (c *client) rpc(req *Fcall) (*Fcall, error) {
+	c.t.Helper()
+	if req.Type != Tversion {
+		c.tag++
+		req.Tag = c.tag
+	}
+	if err := WriteMessage(c.conn, req); err != nil {
+		c.t.Fatal(err)
+	}
+	resp, err := ReadMessage(c.conn, maxMsize)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if resp.Tag != req.Tag {
+		c.t.Fatalf("expected tag %d but got %d", req.Tag, resp.Tag)
+	}
+	if resp.Type == Rerror {
+		return nil, errors.New(resp.Ename)
+	}
+	if resp.Type != req.Type+1 {
+		c.t.Fatalf("expected the response to %d but got %d", req.Type, resp.Type)
+	}
+	return resp, nil
+}
+
+// must fails the test when a request fails
+func (c *client) must(req *Fcall) *Fcall {
+	c.t.Helper()
+	resp, err := c.rpc(req)
+	if err != nil {
+		c.t.Fatalf("request %+v failed: %v", req, err)
+	}
+	return resp
+}
+
+// walk clones the root fid 0 into fid and walks it along a slash-separated path
+func (c *client) walk(fid uint32, path string) error {
+	var names []string
+	if path != "" {
+		names = strings.Split(path, "/")
+	}
+	resp, err := c.rpc(&Fcall{Type: Twalk, Fid: 0, Newfid: fid, Wnames: names})
+	if err == nil && len(resp.Wqids) != len(names) {
+		err = errors.New("partial walk")
+	}
+	return err
+}
+
+// readAll reads an open fid until the end
+func (c *client) readAll(fid uint32) []byte {
+	c.t.Helper()
+	var data []byte
+	for {
+		resp := c.must(&Fcall{Type: Tread, Fid: fid, Offset: uint64(len(data)), Count: 100})
+		if len(resp.Data) == 0 {
+			return data
+		}
+		data = append(data, resp.Data...)
+	}
+}
+
+// list returns the names of the entries of a directory
+func (c *client) list(path string) []string {
+	c.t.Helper()
+	if err := c.walk(99, path); err != nil {
+		c.t.Fatalf("walk %s: %v", path, err)
+	}
+	defer c.must(&Fcall{Type: Tclunk, Fid: 99})
+	c.must(&Fcall{Type: Topen, Fid: 99, Mode: OREAD})
+	data := c.readAll(99)
+	var names []string
+	for len(data) > 0 {
+		dir, rest, err := UnmarshalDir(data)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		names = append(names, dir.Name)
+		data = rest
+	}
+	return names
+}
+
+func TestServer(t *testing.T) {
+	c := newClient(t)
+	c.must(&Fcall{Type: Tattach, Fid: 0, Afid: NOFID, Uname: "alice"})
+
+	// Create a user, a folder and a file with a description
+	c.must(&Fcall{Type: Twalk, Fid: 0, Newfid: 1})
+	c.must(&Fcall{Type: Tcreate, Fid: 1, Name: "Alice", Perm: DMDIR | 0755, Mode: OREAD})
+	c.must(&Fcall{Type: Tclunk, Fid: 1})
+	c.must(&Fcall{Type: Twalk, Fid: 0, Newfid: 1, Wnames: []string{"alice"}})
+	c.must(&Fcall{Type: Tcreate, Fid: 1, Name: "docs", Perm: DMDIR | 0755, Mode: OREAD})
+	c.must(&Fcall{Type: Twalk, Fid: 0, Newfid: 2, Wnames: []string{"alice", "docs"}})
+	create := c.must(&Fcall{Type: Tcreate, Fid: 2, Name: "notes", Perm: 0644, Mode: ORDWR})
+	if create.Qid.Type != 0 || create.Iounit != 8192-ioHeaderSize {
+		t.Errorf("expected a file qid and an iounit of %d but got %+v", 8192-ioHeaderSize, create)
+	}
+	c.must(&Fcall{Type: Twrite, Fid: 2, Data: []byte("hello world")})
+	c.must(&Fcall{Type: Twrite, Fid: 2, Offset: 6, Data: []byte("there")})
+	if data := c.readAll(2); string(data) != "hello there" {
+		t.Errorf("expected hello there but got %q", data)
+	}
+	if file, _ := internal.GetFile("alice", "docs", "notes"); file.Description != "hello there" {
+		t.Errorf("expected the description hello there but got %q", file.Description)
+	}
+
+	if names := c.list(""); strings.Join(names, ",") != "alice" {
+		t.Errorf("expected the root to list alice but got %v", names)
+	}
+	for _, name := range []string{"b", "a"} {
+		internal.CreateFolder("alice", name, "")
+	}
+	if names := c.list("alice"); strings.Join(names, ",") != "a,b,docs" {
+		t.Errorf("expected the folders a,b,docs but got %v", names)
+	}
+
+	// Stat and rename
+	c.must(&Fcall{Type: Twalk, Fid: 0, Newfid: 3, Wnames: []string{"alice", "docs", "notes"}})
+	resp := c.must(&Fcall{Type: Tstat, Fid: 3})
+	dir, _, err := UnmarshalDir(resp.Stat)
+	if err != nil || dir.Name != "notes" || dir.Length != 11 || dir.Mode != 0644 || dir.Uid != "alice" || dir.Mtime == 0 {
+		t.Errorf("unexpected stat %+v, %v", dir, err)
+	}
+	rename := Dir{Type: ^uint16(0), Dev: ^uint32(0), Qid: Qid{^uint8(0), ^uint32(0), ^uint64(0)}, Mode: ^uint32(0), Atime: ^uint32(0), Mtime: ^uint32(0), Length: ^uint64(0), Name: "Renamed"}
+	c.must(&Fcall{Type: Twstat, Fid: 3, Stat: MarshalDir(rename)})
+	if names := c.list("alice/docs"); strings.Join(names, ",") != "renamed" {
+		t.Errorf("expected the file to be renamed but got %v", names)
+	}
+	truncate := rename
+	truncate.Name, truncate.Length = "", 5
+	c.must(&Fcall{Type: Twstat, Fid: 3, Stat: MarshalDir(truncate)})
+	if file, _ := internal.GetFile("alice", "docs", "renamed"); file.Description != "hello" {
+		t.Errorf("expected the description to be truncated to hello but got %q", file.Description)
+	}
+
+	// Walk up and remove
+	c.must(&Fcall{Type: Twalk, Fid: 0, Newfid: 4, Wnames: []string{"alice", "docs", "..", "..", "alice", "a"}})
+	c.must(&Fcall{Type: Tremove, Fid: 4})
+	c.must(&Fcall{Type: Tremove, Fid: 3})
+	if names := c.list("alice"); strings.Join(names, ",") != "b,docs" {
+		t.Errorf("expected a to be removed but got %v", names)
+	}
+	if names := c.list("alice/docs"); len(names) != 0 {
+		t.Errorf("expected the file to be removed but got %v", names)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	c := newClient(t)
+	internal.RegisterUser("alice")
+	internal.CreateFolder("alice", "docs", "")
+	internal.CreateFile("alice", "docs", "notes", "text")
+
+	if _, err := c.rpc(&Fcall{Type: Tattach, Fid: 0, Afid: NOFID, Aname: "bob"}); err == nil || err.Error() != "The bob doesn't exist." {
+		t.Errorf("expected attaching to a missing user to fail but got %v", err)
+	}
+	c.must(&Fcall{Type: Tattach, Fid: 0, Afid: NOFID, Aname: "Alice"})
+	c.must(&Fcall{Type: Tattach, Fid: 10, Afid: NOFID})
+
+	tests := []struct {
+		req      *Fcall
+		expected string
+	}{
+		{&Fcall{Type: Tauth, Afid: 5}, "authentication not required"},
+		{&Fcall{Type: Tattach, Fid: 0, Afid: NOFID}, "fid already in use"},
+		{&Fcall{Type: Tstat, Fid: 42}, "unknown fid"},
+		{&Fcall{Type: Twalk, Fid: 0, Newfid: 1, Wnames: []string{"nothing"}}, "The nothing doesn't exist."},
+		{&Fcall{Type: Twalk, Fid: 0, Newfid: 1, Wnames: []string{"docs", "notes", "deeper"}}, ""},
+		{&Fcall{Type: Tcreate, Fid: 0, Name: "docs", Perm: DMDIR | 0755}, "The docs has already existed."},
+		{&Fcall{Type: Tcreate, Fid: 0, Name: "file", Perm: 0644}, "permission denied"},
+		{&Fcall{Type: Tcreate, Fid: 0, Name: "bad.name", Perm: DMDIR | 0755}, "The bad.name contains invalid chars."},
+		{&Fcall{Type: Topen, Fid: 0, Mode: OWRITE}, "is a directory"},
+		{&Fcall{Type: Tread, Fid: 0, Count: 10}, "fid not open for this operation"},
+		{&Fcall{Type: Tremove, Fid: 10}, "permission denied"},
+	}
+
+	for _, tt := range tests {
+		resp, err := c.rpc(tt.req)
+		switch {
+		case tt.expected == "" && (err != nil || len(resp.Wqids) != 2):
+			t.Errorf("request %+v: expected a partial walk but got %+v, %v", tt.req, resp, err)
+		case tt.expected != "" && (err == nil || err.Error() != tt.expected):
+			t.Errorf("request %+v: expected %q but got %v", tt.req, tt.expected, err)
+		}
+	}
+
+	// A partial walk leaves newfid unset
+	if _, err := c.rpc(&Fcall{Type: Tstat, Fid: 1}); err == nil {
+		t.Errorf("expected newfid to be unset after a partial walk")
+	}
+
+	// Writing past the end and reading a directory from a wrong offset
+	c.must(&Fcall{Type: Twalk, Fid: 0, Newfid: 2, Wnames: []string{"docs", "notes"}})
+	c.must(&Fcall{Type: Topen, Fid: 2, Mode: OWRITE | OTRUNC})
+	if _, err := c.rpc(&Fcall{Type: Twrite, Fid: 2, Offset: 3, Data: []byte("x")}); err == nil || err.Error() != "write past the end of the file" {
+		t.Errorf("expected a write past the end to fail but got %v", err)
+	}
+	c.must(&Fcall{Type: Twalk, Fid: 0, Newfid: 3})
+	c.must(&Fcall{Type: Topen, Fid: 3, Mode: OREAD})
+	if _, err := c.rpc(&Fcall{Type: Tread, Fid: 3, Offset: 7, Count: 100}); err == nil || err.Error() != "bad directory read offset" {
+		t.Errorf("expected a read from a wrong offset to fail but got %v", err)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	c := newClient(t)
+	resp := c.must(&Fcall{Type: Tversion, Tag: NOTAG, Msize: 1 << 20, Version: "9P2000.L"})
+	if resp.Version != Version || resp.Msize != maxMsize {
+		t.Errorf("expected 9P2000 with msize %d but got %+v", maxMsize, resp)
+	}
+	resp = c.must(&Fcall{Type: Tversion, Tag: NOTAG, Msize: 8192, Version: "9P1"})
+	if resp.Version != "unknown" {
+		t.Errorf("expected an unknown version but got %+v", resp)
+	}
+	if _, err := c.rpc(&Fcall{Type: Tattach, Fid: 0, Afid: NOFID}); err == nil || err.Error() != "Tversion required first" {
+		t.Errorf("expected Tattach to need a version but got %v", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	internal.UseMockData(make(map[string]*internal.User))
+	internal.RegisterUser("alice")
+	socket := filepath.Join(t.TempDir(), "vfs.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix sockets are unavailable:", err)
+	}
+	server := NewServer()
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &client{t: t, conn: conn}
+	c.must(&Fcall{Type: Tversion, Tag: NOTAG, Msize: 8192, Version: Version})
+	c.must(&Fcall{Type: Tattach, Fid: 0, Afid: NOFID})
+	if names := c.list(""); len(names) != 1 || names[0] != "alice" {
+		t.Errorf("expected alice but got %v", names)
+	}
+
+	server.Close()
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("expected ErrServerClosed but got %v", err)
+	}
+	if _, err := ReadMessage(conn, maxMsize); err == nil {
+		t.Errorf("expected the connection to be closed")
+	}
+}
@@ -0,0 +1,178 @@
+// internal/query.go
+package internal
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query selects, sorts and pages the entries of a listing.
+// The zero value lists every entry sorted by name.
+type Query struct {
+	// Sort and Order are passed to ParseSortKeys
+	Sort  string `json:"sort,omitempty"`
+	Order string `json:"order,omitempty"`
+	// Reverse reverses the sorted entries before paging
+	Reverse bool `json:"reverse,omitempty"`
+
+	// Name is a glob pattern, as accepted by path.Match, the name must match
+	Name string `json:"name,omitempty"`
+	// NameRegexp is a regular expression the name must match
+	NameRegexp string `json:"name_regex,omitempty"`
+	// Description must be contained in the description, ignoring case
+	Description string `json:"description,omitempty"`
+	// CreatedAfter and CreatedBefore keep the entries created at or after, and before, the given times
+	CreatedAfter  time.Time `json:"created_after,omitempty"`
+	CreatedBefore time.Time `json:"created_before,omitempty"`
+
+	// Offset entries are skipped, and at most Limit entries are returned unless Limit is 0
+	Offset int `json:"offset,omitempty"`
+	Limit  int `json:"limit,omitempty"`
+}
+
+// errNegative is reported for a negative offset or limit
+var errNegative = errors.New("must not be negative")
+
+// compiledQuery is a validated query, ready to be run on a listing
+type compiledQuery struct {
+	Query
+	keys       []SortKey
+	nameRegexp *regexp.Regexp
+}
+
+// compileQuery validates the sorting, filters and paging of q
+func compileQuery(q Query) (*compiledQuery, error) {
+	keys, err := ParseSortKeys(q.Sort, q.Order)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiledQuery{Query: q, keys: keys}
+	if q.Name != "" {
+		if _, err := path.Match(q.Name, ""); err != nil {
+			return nil, &QueryError{Option: "name pattern", Value: q.Name, Err: err}
+		}
+	}
+	if q.NameRegexp != "" {
+		re, err := regexp.Compile(q.NameRegexp)
+		if err != nil {
+			return nil, &QueryError{Option: "name regexp", Value: q.NameRegexp, Err: err}
+		}
+		c.nameRegexp = re
+	}
+	if q.Offset < 0 {
+		return nil, &QueryError{Option: "offset", Value: strconv.Itoa(q.Offset), Err: errNegative}
+	}
+	if q.Limit < 0 {
+		return nil, &QueryError{Option: "limit", Value: strconv.Itoa(q.Limit), Err: errNegative}
+	}
+	return c, nil
+}
+
+// matches reports whether an entry passes every filter
+func (c *compiledQuery) matches(v sortValues) bool {
+	if c.Name != "" {
+		if ok, _ := path.Match(c.Name, v.name); !ok {
+			return false
+		}
+	}
+	if c.nameRegexp != nil && !c.nameRegexp.MatchString(v.name) {
+		return false
+	}
+	if c.Description != "" && !strings.Contains(strings.ToLower(v.description), strings.ToLower(c.Description)) {
+		return false
+	}
+	if !c.CreatedAfter.IsZero() && v.createdAt.Before(c.CreatedAfter) {
+		return false
+	}
+	if !c.CreatedBefore.IsZero() && !v.createdAt.Before(c.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// runQuery filters, sorts and pages items. It returns the page and the number of
+// entries that matched before paging.
+func runQuery[T any](items []T, c *compiledQuery, values func(T) sortValues) ([]T, int) {
+	matched := make([]T, 0, len(items))
+	for _, item := range items {
+		if c.matches(values(item)) {
+			matched = append(matched, item)
+		}
+	}
+	sortByKeys(matched, c.keys, values)
+	if c.Reverse {
+		for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+			matched[i], matched[j] = matched[j], matched[i]
+		}
+	}
+
+	total := len(matched)
+	start := min(c.Offset, total)
+	end := total
+	if c.Limit > 0 {
+		end = min(start+c.Limit, total)
+	}
+	return matched[start:end], total
+}
+
+// QueryFolders lists copies of the folders of a user, without their files, that match q.
+// It returns the requested page and the number of matching folders.
+func QueryFolders(username string, q Query) (_ []*Folder, _ int, err error) {
+	defer observe("query_folders", time.Now(), &err)
+
+	c, err := compileQuery(q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	user, exists := users[username]
+	if !exists {
+		return nil, 0, errorDoesntExisted(username)
+	}
+
+	folders := make([]*Folder, 0, len(user.Folders))
+	for _, folder := range user.Folders {
+		folders = append(folders, &Folder{Name: folder.Name, Description: folder.Description, CreatedAt: folder.CreatedAt})
+	}
+	page, total := runQuery(folders, c, folderSortValues)
+	return page, total, nil
+}
+
+// QueryFiles lists copies of the files in a user's folder that match q. It returns the
+// requested page and the number of matching files.
+func QueryFiles(username, foldername string, q Query) (_ []*File, _ int, err error) {
+	defer observe("query_files", time.Now(), &err)
+
+	c, err := compileQuery(q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	user, exists := users[username]
+	if !exists {
+		return nil, 0, errorDoesntExisted(username)
+	}
+
+	folder, exists := user.Folders[foldername]
+	if !exists {
+		return nil, 0, errorDoesntExisted(foldername)
+	}
+
+	files := make([]*File, 0, len(folder.Files))
+	for _, file := range folder.Files {
+		copied := *file
+		files = append(files, &copied)
+	}
+	page, total := runQuery(files, c, fileSortValues)
+	return page, total, nil
+}
@@ -0,0 +1,132 @@
+// internal/query_test.go
+package internal
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryFiles(t *testing.T) {
+	setupMockData()
+	RegisterUser("user1")
+	CreateFolder("user1", "folder1", "")
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, file := range []struct {
+		name        string
+		description string
+	}{
+		{"report-2022", "Yearly Report"},
+		{"report-2023", "yearly report"},
+		{"notes", "meeting notes"},
+		{"todo", ""},
+		{"report-draft", "draft"},
+	} {
+		CreateFile("user1", "folder1", file.name, file.description)
+		users["user1"].Folders["folder1"].Files[file.name].CreatedAt = day.AddDate(0, 0, i)
+	}
+
+	tests := []struct {
+		query    Query
+		expected []string
+		total    int
+	}{
+		{Query{}, []string{"notes", "report-2022", "report-2023", "report-draft", "todo"}, 5},
+		{Query{Name: "report-*"}, []string{"report-2022", "report-2023", "report-draft"}, 3},
+		{Query{NameRegexp: `^report-\d+$`}, []string{"report-2022", "report-2023"}, 2},
+		{Query{Description: "REPORT"}, []string{"report-2022", "report-2023"}, 2},
+		{Query{CreatedAfter: day.AddDate(0, 0, 2)}, []string{"notes", "report-draft", "todo"}, 3},
+		{Query{CreatedBefore: day.AddDate(0, 0, 2)}, []string{"report-2022", "report-2023"}, 2},
+		{Query{CreatedAfter: day.AddDate(0, 0, 1), CreatedBefore: day.AddDate(0, 0, 3), Sort: "created"}, []string{"report-2023", "notes"}, 2},
+		{Query{Limit: 2}, []string{"notes", "report-2022"}, 5},
+		{Query{Offset: 2, Limit: 2}, []string{"report-2023", "report-draft"}, 5},
+		{Query{Offset: 4, Limit: 2}, []string{"todo"}, 5},
+		{Query{Offset: 9}, []string{}, 5},
+		{Query{Sort: "created", Reverse: true, Limit: 2}, []string{"report-draft", "todo"}, 5},
+		{Query{Name: "report-*", Sort: "created", Order: "desc", Offset: 1}, []string{"report-2023", "report-2022"}, 3},
+		{Query{Name: "nothing*"}, []string{}, 0},
+	}
+
+	for _, test := range tests {
+		files, total, err := QueryFiles("user1", "folder1", test.query)
+		if err != nil {
+			t.Errorf("QueryFiles(%+v) returned error: %v", test.query, err)
+			continue
+		}
+		names := make([]string, len(files))
+		for i, file := range files {
+			names[i] = file.Name
+		}
+		if strings.Join(names, ",") != strings.Join(test.expected, ",") || total != test.total {
+			t.Errorf("QueryFiles(%+v) = %v, %d; expected %v, %d", test.query, names, total, test.expected, test.total)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	setupMockData()
+	RegisterUser("user1")
+
+	tests := []struct {
+		query    Query
+		expected string
+		category error
+	}{
+		{Query{Name: "[a"}, "Invalid name pattern [a: syntax error in pattern", path.ErrBadPattern},
+		{Query{NameRegexp: "(a"}, "Invalid name regexp (a: error parsing regexp: missing closing ): `(a`", ErrInvalidQuery},
+		{Query{Offset: -1}, "Invalid offset -1: must not be negative", ErrInvalidQuery},
+		{Query{Limit: -5}, "Invalid limit -5: must not be negative", ErrInvalidQuery},
+		{Query{Sort: "size"}, "Unknown sort field size, expected one of name,created,description", ErrInvalidSort},
+	}
+
+	for _, test := range tests {
+		_, _, err := QueryFolders("user1", test.query)
+		if err == nil || err.Error() != test.expected || !errors.Is(err, test.category) {
+			t.Errorf("QueryFolders(%+v) returned error %v; expected %s", test.query, err, test.expected)
+		}
+	}
+
+	if _, _, err := QueryFolders("user1", Query{Name: "[a"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("expected an invalid pattern to be reported as ErrInvalidQuery but got %v", err)
+	}
+	if _, _, err := QueryFiles("user1", "nothing", Query{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound but got %v", err)
+	}
+}
+
+// TestQueryCopies reads the listed entries while they're changed, for go test -race
+func TestQueryCopies(t *testing.T) {
+	setupMockData()
+	RegisterUser("user1")
+	CreateFolder("user1", "a", "")
+	CreateFile("user1", "a", "file", "")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			RenameFolder("user1", "a", "b")
+			SetFileDescription("user1", "b", "file", strings.Repeat("x", i))
+			RenameFolder("user1", "b", "a")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		folders, _, _ := QueryFolders("user1", Query{})
+		for _, folder := range folders {
+			_ = folder.Name + folder.Description
+			files, _, _ := QueryFiles("user1", folder.Name, Query{})
+			for _, file := range files {
+				_ = file.Name + file.Description
+			}
+		}
+	}
+	<-done
+
+	folders, _, _ := QueryFolders("user1", Query{})
+	folders[0].Name = "changed"
+	if _, err := GetFolder("user1", "a"); err != nil {
+		t.Errorf("expected changing a listed folder to leave the folder as it is but got %v", err)
+	}
+}
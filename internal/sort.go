@@ -0,0 +1,103 @@
+// internal/sort.go
+package internal
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortFields lists the fields folders and files can be sorted by
+var SortFields = []string{"name", "created", "description"}
+
+// SortKey is a field listings are sorted by and its direction
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSortKeys parses a comma-separated list of sort fields, each optionally followed by
+// `:asc` or `:desc`. Fields without a direction use order, which defaults to asc.
+// An empty list sorts by name.
+func ParseSortKeys(sortBy, order string) ([]SortKey, error) {
+	if order == "" {
+		order = "asc"
+	}
+	if order != "asc" && order != "desc" {
+		return nil, &SortError{Order: order}
+	}
+	if sortBy == "" {
+		sortBy = "name"
+	}
+
+	var keys []SortKey
+	for _, item := range strings.Split(sortBy, ",") {
+		field, direction, hasDirection := strings.Cut(strings.TrimSpace(item), ":")
+		if !hasDirection {
+			direction = order
+		}
+		if direction != "asc" && direction != "desc" {
+			return nil, &SortError{Order: direction}
+		}
+		if !isSortField(field) {
+			return nil, &SortError{Field: field}
+		}
+		keys = append(keys, SortKey{Field: field, Desc: direction == "desc"})
+	}
+	return keys, nil
+}
+
+// isSortField reports whether field is one of SortFields
+func isSortField(field string) bool {
+	for _, f := range SortFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// sortValues holds the fields of a folder or a file that can be compared
+type sortValues struct {
+	name        string
+	description string
+	createdAt   time.Time
+}
+
+// compareField compares a and b by a single field, returning -1, 0 or 1
+func compareField(a, b sortValues, field string) int {
+	switch field {
+	case "created":
+		return a.createdAt.Compare(b.createdAt)
+	case "description":
+		return strings.Compare(a.description, b.description)
+	}
+	return strings.Compare(a.name, b.name)
+}
+
+// sortByKeys sorts items by each key in turn, so later keys break the ties of earlier ones.
+// Items still tied are ordered by name, which is unique within a listing.
+func sortByKeys[T any](items []T, keys []SortKey, values func(T) sortValues) {
+	keys = append(keys, SortKey{Field: "name"})
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := values(items[i]), values(items[j])
+		for _, key := range keys {
+			c := compareField(a, b, key.Field)
+			if key.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+func folderSortValues(folder *Folder) sortValues {
+	return sortValues{folder.Name, folder.Description, folder.CreatedAt}
+}
+
+func fileSortValues(file *File) sortValues {
+	return sortValues{file.Name, file.Description, file.CreatedAt}
+}
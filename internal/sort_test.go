@@ -0,0 +1,92 @@
+// internal/sort_test.go
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSortKeys(t *testing.T) {
+	tests := []struct {
+		sortBy   string
+		order    string
+		expected []SortKey
+		err      string
+	}{
+		{"", "", []SortKey{{"name", false}}, ""},
+		{"", "desc", []SortKey{{"name", true}}, ""},
+		{"created", "", []SortKey{{"created", false}}, ""},
+		{"description,created:desc", "asc", []SortKey{{"description", false}, {"created", true}}, ""},
+		{"description:asc, name", "desc", []SortKey{{"description", false}, {"name", true}}, ""},
+		{"size", "", nil, "Unknown sort field size, expected one of name,created,description"},
+		{"name:up", "", nil, "Unknown sort order up, expected asc or desc"},
+		{"name", "down", nil, "Unknown sort order down, expected asc or desc"},
+	}
+
+	for _, test := range tests {
+		keys, err := ParseSortKeys(test.sortBy, test.order)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err || !errors.Is(err, ErrInvalidSort) {
+				t.Errorf("ParseSortKeys(%s, %s) returned error %v; expected %s", test.sortBy, test.order, err, test.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(keys, test.expected) {
+			t.Errorf("ParseSortKeys(%s, %s) = %v, %v; expected %v", test.sortBy, test.order, keys, err, test.expected)
+		}
+	}
+}
+
+func TestListFoldersMultiKey(t *testing.T) {
+	setupMockData()
+	RegisterUser("user1")
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, folder := range []struct {
+		name        string
+		description string
+		createdAt   time.Time
+	}{
+		{"a", "work", day.Add(time.Hour)},
+		{"b", "home", day},
+		{"c", "work", day},
+		{"d", "home", day.Add(time.Hour)},
+	} {
+		CreateFolder("user1", folder.name, folder.description)
+		users["user1"].Folders[folder.name].CreatedAt = folder.createdAt
+	}
+
+	tests := []struct {
+		sortBy   string
+		order    string
+		expected []string
+	}{
+		{"description", "asc", []string{"b", "d", "a", "c"}},
+		{"description", "desc", []string{"a", "c", "b", "d"}},
+		{"created", "asc", []string{"b", "c", "a", "d"}},
+		{"created:desc,description", "", []string{"d", "a", "b", "c"}},
+		{"description:desc,created:desc", "", []string{"a", "c", "d", "b"}},
+		{"description,name", "desc", []string{"c", "a", "d", "b"}},
+	}
+
+	for _, test := range tests {
+		folders, err := ListFolders("user1", test.sortBy, test.order)
+		if err != nil {
+			t.Errorf("ListFolders(user1, %s, %s) returned error: %v", test.sortBy, test.order, err)
+			continue
+		}
+		names := make([]string, len(folders))
+		for i, folder := range folders {
+			names[i] = folder.Name
+		}
+		if strings.Join(names, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("ListFolders(user1, %s, %s) = %v; expected %v", test.sortBy, test.order, names, test.expected)
+		}
+	}
+
+	if _, err := ListFiles("user1", "a", "size", "asc"); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("ListFiles(user1, a, size, asc) returned error %v; expected ErrInvalidSort", err)
+	}
+}
@@ -8,42 +8,189 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 var dataFile = "data.json"
 var users = make(map[string]*User)
 var useMockData = false
 
+// mu guards users and the data file; dirty is set while changes haven't been saved,
+// and loaded once the data file was read
+var mu sync.Mutex
+var dirty = false
+var loaded = false
+
 // UseMockData sets the mock data for testing
 func UseMockData(mockUsers map[string]*User) {
+	mu.Lock()
+	defer mu.Unlock()
 	users = mockUsers
 	useMockData = true
+	dirty = false
+	loaded = true
 }
 
 // SaveData saves the current state of users to a JSON file
 func SaveData() error {
+	mu.Lock()
+	defer mu.Unlock()
+	return saveData()
+}
+
+// Flush saves the current state of users if the last change hasn't been saved yet,
+// e.g. because writing the data file failed.
+func Flush() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if !dirty {
+		return nil
+	}
+	return saveData()
+}
+
+// persist marks the users as changed and saves them. The caller must hold mu.
+func persist() error {
+	dirty = true
+	return saveData()
+}
+
+// saveData writes users to the data file. The caller must hold mu.
+func saveData() error {
 	if useMockData {
+		dirty = false
 		return nil
 	}
+	start := time.Now()
 	data, err := json.Marshal(users)
+	if err == nil {
+		err = ioutil.WriteFile(dataFile, data, 0644)
+	}
+	outcome := "ok"
 	if err != nil {
-		return err
+		outcome = "io_error"
 	}
-	return ioutil.WriteFile(dataFile, data, 0644)
+	saveDuration.Observe(time.Since(start).Seconds(), outcome)
+	if err != nil {
+		return &StorageError{Op: "saving data", Err: err}
+	}
+	dirty = false
+	return nil
 }
 
 // LoadData loads the state of users from a JSON file
 func LoadData() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if useMockData {
+		return nil
+	}
+	if err := readData(users); err != nil {
+		return err
+	}
+	loaded = true
+	return nil
+}
+
+// ReloadData replaces the users with the content of the data file, e.g. after it was restored
+// from a snapshot. It fails with ErrUnsavedChanges when the last change couldn't be saved.
+func ReloadData() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if useMockData {
+		return nil
+	}
+	if dirty {
+		return ErrUnsavedChanges
+	}
+	reloaded := make(map[string]*User)
+	if err := readData(reloaded); err != nil {
+		return err
+	}
+	users = reloaded
+	loaded = true
+	return nil
+}
+
+// readData reads the data file into into, a missing file has no users. The caller must hold mu.
+func readData(into map[string]*User) error {
 	if _, err := os.Stat(dataFile); os.IsNotExist(err) {
 		return nil // No file, skip loading
 	}
 
 	data, err := ioutil.ReadFile(dataFile)
 	if err != nil {
-		return err
+		return &StorageError{Op: "loading data", Err: err}
+	}
+
+	if err := json.Unmarshal(data, &into); err != nil {
+		return &StorageError{Op: "loading data", Err: err}
+	}
+	return nil
+}
+
+// Ready reports whether the data file was loaded and can be written, so operations can succeed
+func Ready() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if !loaded {
+		return errors.New("The data file hasn't been loaded yet.")
+	}
+	if useMockData {
+		return nil
+	}
+	// The data file is replaced as a whole, so its directory must be writable too
+	probe, err := os.CreateTemp(filepath.Dir(dataFile), ".vfs-ready-*")
+	if err != nil {
+		return &StorageError{Op: "checking data", Err: err}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	if file, err := os.OpenFile(dataFile, os.O_WRONLY, 0); err == nil {
+		file.Close()
+	} else if !os.IsNotExist(err) {
+		return &StorageError{Op: "checking data", Err: err}
+	}
+	return nil
+}
+
+// Snapshot writes a copy of the users next to the data file, named after it and the time,
+// e.g. data.snapshot-20240301T100000.000Z.json for data.json. It returns the path of the copy.
+func Snapshot() (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	data, err := json.Marshal(users)
+	if err != nil {
+		return "", &StorageError{Op: "writing snapshot", Err: err}
+	}
+	ext := filepath.Ext(dataFile)
+	path := strings.TrimSuffix(dataFile, ext) + ".snapshot-" + time.Now().UTC().Format("20060102T150405.000Z") + ext
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return "", &StorageError{Op: "writing snapshot", Err: err}
 	}
+	return path, nil
+}
+
+// CountEntries returns the numbers of users, folders and files
+func CountEntries() (int, int, int) {
+	mu.Lock()
+	defer mu.Unlock()
+	folders, files := 0, 0
+	for _, user := range users {
+		folders += len(user.Folders)
+		for _, folder := range user.Folders {
+			files += len(folder.Files)
+		}
+	}
+	return len(users), folders, files
+}
 
-	return json.Unmarshal(data, &users)
+// DataFile returns the path of the data file
+func DataFile() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return dataFile
 }
 
 // SetDataFile sets the data file path and checks if it's a valid path
@@ -71,6 +218,8 @@ func SetDataFile(path string) error {
 		return errors.New("provided path is a directory, please provide a valid file path")
 	}
 
+	mu.Lock()
+	defer mu.Unlock()
 	dataFile = absPath
 	return nil
 }
@@ -0,0 +1,181 @@
+// internal/token.go
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Scope is what a token may do: ScopeRead lists and reads, ScopeWrite changes too
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+)
+
+// ErrInvalidToken is reported when authenticating with a token that doesn't exist, was revoked
+// or is malformed
+var ErrInvalidToken = errors.New("The token is invalid.")
+
+// ErrTokenExpired is reported when authenticating with a token past its expiry
+var ErrTokenExpired = errors.New("The token has expired.")
+
+// tokenPrefix starts every token, so leaked tokens are easy to find
+const tokenPrefix = "vfs_"
+
+// Token is an API token of a user. Only the SHA-256 of its secret is kept.
+// A token restricted to a folder may only access that folder.
+type Token struct {
+	ID        string    `json:"id"`
+	Hash      string    `json:"hash"`
+	Scope     Scope     `json:"scope"`
+	Folder    string    `json:"folder,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is zero for a token that doesn't expire
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the token has expired at now
+func (t *Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// ParseScope parses read or write
+func ParseScope(s string) (Scope, error) {
+	switch Scope(s) {
+	case ScopeRead, ScopeWrite:
+		return Scope(s), nil
+	}
+	return "", fmt.Errorf("Invalid scope %s, expected read or write", QuoteIfNeeded(s))
+}
+
+// hashSecret returns the hex SHA-256 of a secret. Secrets are random, so they need no salt.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes in hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateToken creates a token of a user, restricted to a folder unless foldername is empty.
+// It expires after ttl, or never when ttl is 0. It returns the token, vfs_ followed by its id,
+// an underscore and its secret, which can't be read back later.
+func CreateToken(username string, scope Scope, foldername string, ttl time.Duration) (_ string, _ *Token, err error) {
+	defer observe("create_token", time.Now(), &err)
+	if _, err := ParseScope(string(scope)); err != nil {
+		return "", nil, err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	user, exists := users[username]
+	if !exists {
+		return "", nil, errorDoesntExisted(username)
+	}
+	if foldername != "" {
+		if _, exists := user.Folders[foldername]; !exists {
+			return "", nil, errorDoesntExisted(foldername)
+		}
+	}
+
+	token := &Token{ID: id, Hash: hashSecret(secret), Scope: scope, Folder: foldername, CreatedAt: time.Now()}
+	if ttl > 0 {
+		token.ExpiresAt = token.CreatedAt.Add(ttl)
+	}
+	user.Tokens = append(user.Tokens, token)
+	copied := *token
+	return tokenPrefix + id + "_" + secret, &copied, persist()
+}
+
+// ListTokens returns copies of the tokens of a user, oldest first
+func ListTokens(username string) (_ []*Token, err error) {
+	defer observe("list_tokens", time.Now(), &err)
+	mu.Lock()
+	defer mu.Unlock()
+
+	user, exists := users[username]
+	if !exists {
+		return nil, errorDoesntExisted(username)
+	}
+	tokens := make([]*Token, len(user.Tokens))
+	for i, token := range user.Tokens {
+		copied := *token
+		tokens[i] = &copied
+	}
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+// RevokeToken deletes a token of a user by its id
+func RevokeToken(username, id string) (err error) {
+	defer observe("revoke_token", time.Now(), &err)
+	mu.Lock()
+	defer mu.Unlock()
+
+	user, exists := users[username]
+	if !exists {
+		return errorDoesntExisted(username)
+	}
+	for i, token := range user.Tokens {
+		if token.ID == id {
+			user.Tokens = append(user.Tokens[:i], user.Tokens[i+1:]...)
+			return persist()
+		}
+	}
+	return errorDoesntExisted(id)
+}
+
+// Authenticate returns the user of a token and a copy of it. It fails with ErrInvalidToken
+// or ErrTokenExpired.
+func Authenticate(token string) (_ string, _ *Token, err error) {
+	defer observe("authenticate", time.Now(), &err)
+	id, secret, ok := strings.Cut(strings.TrimPrefix(token, tokenPrefix), "_")
+	if !strings.HasPrefix(token, tokenPrefix) || !ok {
+		return "", nil, ErrInvalidToken
+	}
+	hash := hashSecret(secret)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for username, user := range users {
+		for _, t := range user.Tokens {
+			if t.ID != id {
+				continue
+			}
+			if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) != 1 {
+				return "", nil, ErrInvalidToken
+			}
+			if t.Expired(time.Now()) {
+				return "", nil, ErrTokenExpired
+			}
+			copied := *t
+			return username, &copied, nil
+		}
+	}
+	return "", nil, ErrInvalidToken
+}
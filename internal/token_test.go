@@ -0,0 +1,85 @@
+// internal/token_test.go
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokens(t *testing.T) {
+	setupMockData()
+	RegisterUser("user1")
+	CreateFolder("user1", "folder1", "")
+
+	secret, token, err := CreateToken("user1", ScopeWrite, "folder1", time.Hour)
+	if err != nil || !strings.HasPrefix(secret, "vfs_"+token.ID+"_") || len(token.ID) != 16 || token.Scope != ScopeWrite || token.Folder != "folder1" || token.ExpiresAt.Sub(token.CreatedAt) != time.Hour {
+		t.Fatalf("CreateToken = %s, %+v, %v", secret, token, err)
+	}
+	if strings.Contains(token.Hash, strings.TrimPrefix(secret, "vfs_"+token.ID+"_")) {
+		t.Errorf("expected only the hash of the secret to be kept")
+	}
+	readSecret, readToken, _ := CreateToken("user1", ScopeRead, "", 0)
+
+	username, got, err := Authenticate(secret)
+	if err != nil || username != "user1" || got.ID != token.ID {
+		t.Errorf("Authenticate = %s, %+v, %v; expected user1", username, got, err)
+	}
+	if _, got, _ := Authenticate(readSecret); got == nil || !got.ExpiresAt.IsZero() || got.Scope != ScopeRead {
+		t.Errorf("expected a read token that doesn't expire but got %+v", got)
+	}
+	for _, invalid := range []string{"", "vfs_", secret + "0", strings.Replace(secret, "vfs_", "xyz_", 1), "vfs_" + token.ID + "_" + strings.Repeat("0", 64)} {
+		if _, _, err := Authenticate(invalid); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Authenticate(%q) = %v; expected ErrInvalidToken", invalid, err)
+		}
+	}
+
+	RenameFolder("user1", "folder1", "folder2")
+	tokens, err := ListTokens("user1")
+	if err != nil || len(tokens) != 2 || tokens[0].ID != token.ID || tokens[0].Folder != "folder2" || tokens[1].ID != readToken.ID {
+		t.Errorf("ListTokens = %+v, %v; expected the tokens oldest first, following the renamed folder", tokens, err)
+	}
+
+	if err := RevokeToken("user1", token.ID); err != nil {
+		t.Errorf("RevokeToken returned error: %v", err)
+	}
+	if _, _, err := Authenticate(secret); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected a revoked token to be invalid but got %v", err)
+	}
+	if err := RevokeToken("user1", token.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the token not to exist anymore but got %v", err)
+	}
+}
+
+func TestTokenErrors(t *testing.T) {
+	setupMockData()
+	RegisterUser("user1")
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{createErr(CreateToken("user2", ScopeRead, "", 0)), "The user2 doesn't exist."},
+		{createErr(CreateToken("user1", ScopeRead, "folder1", 0)), "The folder1 doesn't exist."},
+		{createErr(CreateToken("user1", "admin", "", 0)), "Invalid scope admin, expected read or write"},
+		{listErr(ListTokens("user2")), "The user2 doesn't exist."},
+		{RevokeToken("user1", "0123"), "The 0123 doesn't exist."},
+	}
+	for _, test := range tests {
+		if test.err == nil || test.err.Error() != test.expected {
+			t.Errorf("got %v; expected %s", test.err, test.expected)
+		}
+	}
+
+	// Tokens are checked when they're used
+	secret, _, _ := CreateToken("user1", ScopeRead, "", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, _, err := Authenticate(secret); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expected the token to expire but got %v", err)
+	}
+}
+
+// createErr and listErr keep the error of CreateToken and ListTokens
+func createErr(_ string, _ *Token, err error) error { return err }
+func listErr(_ []*Token, err error) error           { return err }
@@ -7,6 +7,7 @@ import "time"
 type User struct {
 	Username string             `json:"username"`
 	Folders  map[string]*Folder `json:"folders"`
+	Tokens   []*Token           `json:"tokens,omitempty"`
 }
 
 // Folder represents a folder in the file system
@@ -25,12 +25,30 @@ func windowsSleep() {
 	}
 }
 
-// QuoteIfNeeded adds double quotes around a string if it contains spaces
+// QuoteIfNeeded adds double quotes around a string if it contains spaces, quotes or backslashes,
+// escaping the double quotes and backslashes inside so the command parser reads it back unchanged.
+// The empty string becomes two single quotes, which read back as an empty argument.
 func QuoteIfNeeded(s string) string {
-	if strings.Contains(s, " ") {
-		return fmt.Sprintf("\"%s\"", s)
+	if s == "" {
+		return "''"
 	}
-	return s
+	if !strings.ContainsAny(s, " \t\n\r\"'\\") {
+		return s
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+	return fmt.Sprintf("\"%s\"", escaped)
+}
+
+// CaseInsensitive lowercases the names the servers are sent, as the REPL lowercases the names
+// it's given. The servers are case-insensitive unless it's cleared before they start.
+var CaseInsensitive = true
+
+// NormalizeName applies CaseInsensitive to a name
+func NormalizeName(name string) string {
+	if CaseInsensitive {
+		return strings.ToLower(name)
+	}
+	return name
 }
 
 // isValidName validates the name, allowing letters, numbers, spaces, underscores, and hyphens, with a length of 1-50 characters.
@@ -40,20 +58,13 @@ func isValidName(name string) bool {
 	return validNameRegex.MatchString(name)
 }
 
-func errorAlreayExisted(name string) error {
-	return fmt.Errorf("The %s has already existed.", QuoteIfNeeded(name))
-}
-
-func errorDoesntExisted(name string) error {
-	return fmt.Errorf("The %s doesn't exist.", QuoteIfNeeded(name))
-}
+// RegisterUser registers a new user with a unique username
+func RegisterUser(username string) (err error) {
+	defer observe("register_user", time.Now(), &err)
 
-func errorInvalidChars(name string) error {
-	return fmt.Errorf("The %s contains invalid chars.", QuoteIfNeeded(name))
-}
+	mu.Lock()
+	defer mu.Unlock()
 
-// RegisterUser registers a new user with a unique username
-func RegisterUser(username string) error {
 	if _, exists := users[username]; exists {
 		return errorAlreayExisted(username)
 	}
@@ -64,11 +75,16 @@ func RegisterUser(username string) error {
 		Username: username,
 		Folders:  make(map[string]*Folder),
 	}
-	return SaveData()
+	return commit(Event{Type: UserRegistered, Username: username})
 }
 
 // CreateFolder creates a new folder for a user
-func CreateFolder(username, foldername string, description string) error {
+func CreateFolder(username, foldername string, description string) (err error) {
+	defer observe("create_folder", time.Now(), &err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
 	user, exists := users[username]
 	if !exists {
 		return errorDoesntExisted(username)
@@ -89,11 +105,16 @@ func CreateFolder(username, foldername string, description string) error {
 		Files:       make(map[string]*File),
 	}
 	windowsSleep()
-	return SaveData()
+	return commit(Event{Type: FolderCreated, Username: username, Folder: foldername, Description: description})
 }
 
 // CreateFile creates a new file in a user's folder
-func CreateFile(username, foldername, filename string, description string) error {
+func CreateFile(username, foldername, filename string, description string) (err error) {
+	defer observe("create_file", time.Now(), &err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
 	user, exists := users[username]
 	if !exists {
 		return errorDoesntExisted(username)
@@ -118,119 +139,185 @@ func CreateFile(username, foldername, filename string, description string) error
 		CreatedAt:   time.Now(),
 	}
 	windowsSleep()
-	return SaveData()
+	return commit(Event{Type: FileCreated, Username: username, Folder: foldername, File: filename, Description: description})
 }
 
-// ListFolders lists all folders for a user with optional sorting
+// ListFolders lists all folders for a user sorted by sortBy, a comma-separated list of
+// sort fields as accepted by ParseSortKeys, in the given order
 func ListFolders(username, sortBy, order string) ([]*Folder, error) {
+	folders, _, err := QueryFolders(username, Query{Sort: sortBy, Order: order})
+	return folders, err
+}
+
+// ListFiles lists all files in a user's folder sorted by sortBy, a comma-separated list of
+// sort fields as accepted by ParseSortKeys, in the given order
+func ListFiles(username, foldername, sortBy, order string) ([]*File, error) {
+	files, _, err := QueryFiles(username, foldername, Query{Sort: sortBy, Order: order})
+	return files, err
+}
+
+// DeleteFolder deletes a folder for a user
+func DeleteFolder(username, foldername string) (err error) {
+	defer observe("delete_folder", time.Now(), &err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
 	user, exists := users[username]
 	if !exists {
-		return nil, errorDoesntExisted(username)
+		return errorDoesntExisted(username)
 	}
 
-	folders := make([]*Folder, 0, len(user.Folders))
-	for _, folder := range user.Folders {
-		folders = append(folders, folder)
+	if _, exists := user.Folders[foldername]; !exists {
+		return errorDoesntExisted(foldername)
 	}
 
-	// Default sorting by name in ascending order
-	if sortBy == "" {
-		sortBy = "name"
+	delete(user.Folders, foldername)
+	return commit(Event{Type: FolderDeleted, Username: username, Folder: foldername})
+}
+
+// DeleteFile deletes a file in a user's folder
+func DeleteFile(username, foldername, filename string) (err error) {
+	defer observe("delete_file", time.Now(), &err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	user, exists := users[username]
+	if !exists {
+		return errorDoesntExisted(username)
 	}
-	if order == "" {
-		order = "asc"
+
+	folder, exists := user.Folders[foldername]
+	if !exists {
+		return errorDoesntExisted(foldername)
 	}
 
-	switch sortBy {
-	case "name":
-		sort.Slice(folders, func(i, j int) bool {
-			if order == "desc" {
-				return folders[i].Name > folders[j].Name
-			}
-			return folders[i].Name < folders[j].Name
-		})
-	case "created":
-		sort.Slice(folders, func(i, j int) bool {
-			if order == "desc" {
-				return !folders[i].CreatedAt.Before(folders[j].CreatedAt)
-			}
-			return folders[i].CreatedAt.Before(folders[j].CreatedAt)
-		})
-	default:
-		sort.Slice(folders, func(i, j int) bool {
-			return folders[i].Name < folders[j].Name
-		})
+	if _, exists := folder.Files[filename]; !exists {
+		return errorDoesntExisted(filename)
 	}
 
-	return folders, nil
+	delete(folder.Files, filename)
+	return commit(Event{Type: FileDeleted, Username: username, Folder: foldername, File: filename})
 }
 
-// ListFiles lists all files in a user's folder with optional sorting
-func ListFiles(username, foldername, sortBy, order string) ([]*File, error) {
+// RenameFolder renames a folder for a user
+func RenameFolder(username, foldername, newFolderName string) (err error) {
+	defer observe("rename_folder", time.Now(), &err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
 	user, exists := users[username]
 	if !exists {
-		return nil, errorDoesntExisted(username)
+		return errorDoesntExisted(username)
 	}
 
-	folder, exists := user.Folders[foldername]
-	if !exists {
-		return nil, errorDoesntExisted(foldername)
+	if _, exists := user.Folders[foldername]; !exists {
+		return errorDoesntExisted(foldername)
 	}
 
-	files := make([]*File, 0, len(folder.Files))
-	for _, file := range folder.Files {
-		files = append(files, file)
+	if !isValidName(newFolderName) {
+		return errorInvalidChars(newFolderName)
+	}
+
+	if _, exists := user.Folders[newFolderName]; exists {
+		return errorAlreayExisted(newFolderName)
+	}
+
+	folder := user.Folders[foldername]
+	folder.Name = newFolderName
+	user.Folders[newFolderName] = folder
+	delete(user.Folders, foldername)
+	// Tokens restricted to the folder follow it
+	for _, token := range user.Tokens {
+		if token.Folder == foldername {
+			token.Folder = newFolderName
+		}
 	}
+	return commit(Event{Type: FolderRenamed, Username: username, Folder: foldername, NewFolder: newFolderName})
+}
 
-	// Default sorting by name in ascending order
-	if sortBy == "" {
-		sortBy = "name"
+// ListUsers lists the names of all users in ascending order
+func ListUsers() []string {
+	// Listing users can't fail
+	defer observe("list_users", time.Now(), new(error))
+	mu.Lock()
+	defer mu.Unlock()
+
+	usernames := make([]string, 0, len(users))
+	for username := range users {
+		usernames = append(usernames, username)
 	}
-	if order == "" {
-		order = "asc"
+	sort.Strings(usernames)
+	return usernames
+}
+
+// GetUser returns a copy of a user without its folders
+func GetUser(username string) (_ *User, err error) {
+	defer observe("get_user", time.Now(), &err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	user, exists := users[username]
+	if !exists {
+		return nil, errorDoesntExisted(username)
 	}
+	return &User{Username: user.Username}, nil
+}
+
+// GetFolder returns a copy of a user's folder without its files
+func GetFolder(username, foldername string) (_ *Folder, err error) {
+	defer observe("get_folder", time.Now(), &err)
 
-	switch sortBy {
-	case "name":
-		sort.Slice(files, func(i, j int) bool {
-			if order == "desc" {
-				return files[i].Name > files[j].Name
-			}
-			return files[i].Name < files[j].Name
-		})
-	case "created":
-		sort.Slice(files, func(i, j int) bool {
-			if order == "desc" {
-				return !files[i].CreatedAt.Before(files[j].CreatedAt)
-			}
-			return files[i].CreatedAt.Before(files[j].CreatedAt)
-		})
-	default:
-		sort.Slice(files, func(i, j int) bool {
-			return files[i].Name < files[j].Name
-		})
+	mu.Lock()
+	defer mu.Unlock()
+
+	user, exists := users[username]
+	if !exists {
+		return nil, errorDoesntExisted(username)
 	}
 
-	return files, nil
+	folder, exists := user.Folders[foldername]
+	if !exists {
+		return nil, errorDoesntExisted(foldername)
+	}
+	return &Folder{Name: folder.Name, Description: folder.Description, CreatedAt: folder.CreatedAt}, nil
 }
 
-// DeleteFolder deletes a folder for a user
-func DeleteFolder(username, foldername string) error {
+// GetFile returns a copy of a file in a user's folder
+func GetFile(username, foldername, filename string) (_ *File, err error) {
+	defer observe("get_file", time.Now(), &err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
 	user, exists := users[username]
 	if !exists {
-		return errorDoesntExisted(username)
+		return nil, errorDoesntExisted(username)
 	}
 
-	if _, exists := user.Folders[foldername]; !exists {
-		return errorDoesntExisted(foldername)
+	folder, exists := user.Folders[foldername]
+	if !exists {
+		return nil, errorDoesntExisted(foldername)
 	}
 
-	delete(user.Folders, foldername)
-	return SaveData()
+	file, exists := folder.Files[filename]
+	if !exists {
+		return nil, errorDoesntExisted(filename)
+	}
+	copied := *file
+	return &copied, nil
 }
 
-// DeleteFile deletes a file in a user's folder
-func DeleteFile(username, foldername, filename string) error {
+// SetFileDescription replaces the description of a file in a user's folder
+func SetFileDescription(username, foldername, filename, description string) (err error) {
+	defer observe("set_file_description", time.Now(), &err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
 	user, exists := users[username]
 	if !exists {
 		return errorDoesntExisted(username)
@@ -241,36 +328,53 @@ func DeleteFile(username, foldername, filename string) error {
 		return errorDoesntExisted(foldername)
 	}
 
-	if _, exists := folder.Files[filename]; !exists {
+	file, exists := folder.Files[filename]
+	if !exists {
 		return errorDoesntExisted(filename)
 	}
 
-	delete(folder.Files, filename)
-	return SaveData()
+	file.Description = description
+	return commit(Event{Type: FileUpdated, Username: username, Folder: foldername, File: filename, Description: description})
 }
 
-// RenameFolder renames a folder for a user
-func RenameFolder(username, foldername, newFolderName string) error {
+// MoveFile moves a file to another folder of the same user and renames it to newFileName,
+// keeping its description and creation time
+func MoveFile(username, foldername, filename, newFolderName, newFileName string) (err error) {
+	defer observe("move_file", time.Now(), &err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
 	user, exists := users[username]
 	if !exists {
 		return errorDoesntExisted(username)
 	}
 
-	if _, exists := user.Folders[foldername]; !exists {
+	folder, exists := user.Folders[foldername]
+	if !exists {
 		return errorDoesntExisted(foldername)
 	}
 
-	if !isValidName(newFolderName) {
-		return errorInvalidChars(newFolderName)
+	file, exists := folder.Files[filename]
+	if !exists {
+		return errorDoesntExisted(filename)
 	}
 
-	if _, exists := user.Folders[newFolderName]; exists {
-		return errorAlreayExisted(newFolderName)
+	newFolder, exists := user.Folders[newFolderName]
+	if !exists {
+		return errorDoesntExisted(newFolderName)
 	}
 
-	folder := user.Folders[foldername]
-	folder.Name = newFolderName
-	user.Folders[newFolderName] = folder
-	delete(user.Folders, foldername)
-	return SaveData()
+	if !isValidName(newFileName) {
+		return errorInvalidChars(newFileName)
+	}
+
+	if _, exists := newFolder.Files[newFileName]; exists {
+		return errorAlreayExisted(newFileName)
+	}
+
+	delete(folder.Files, filename)
+	file.Name = newFileName
+	newFolder.Files[newFileName] = file
+	return commit(Event{Type: FileMoved, Username: username, Folder: foldername, File: filename, NewFolder: newFolderName, NewFile: newFileName})
 }
@@ -2,6 +2,7 @@
 package internal
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -17,8 +18,12 @@ func TestQuoteIfNeeded(t *testing.T) {
 	}{
 		{"hello", "hello"},
 		{"hello world", "\"hello world\""},
-		{"", ""},
+		{"", "''"},
 		{" ", "\" \""},
+		{`say "hi"`, `"say \"hi\""`},
+		{`it's`, `"it's"`},
+		{`back\slash`, `"back\\slash"`},
+		{"tab\there", "\"tab\there\""},
 	}
 
 	for _, test := range tests {
@@ -274,3 +279,124 @@ func TestRenameFolder(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorCategories(t *testing.T) {
+	setupMockData()
+	RegisterUser("user1")
+
+	tests := []struct {
+		err      error
+		category error
+	}{
+		{RegisterUser("user1"), ErrAlreadyExists},
+		{RegisterUser("invalid/user"), ErrInvalidName},
+		{CreateFolder("user2", "folder1", ""), ErrNotFound},
+	}
+
+	for _, test := range tests {
+		if !errors.Is(test.err, test.category) {
+			t.Errorf("errors.Is(%v, %v) = false; expected true", test.err, test.category)
+		}
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	setupMockData()
+	RegisterUser("user2")
+	RegisterUser("user1")
+
+	usernames := ListUsers()
+	if len(usernames) != 2 || usernames[0] != "user1" || usernames[1] != "user2" {
+		t.Errorf("ListUsers() = %v; expected [user1 user2]", usernames)
+	}
+}
+
+func TestGetters(t *testing.T) {
+	setupMockData()
+	RegisterUser("user1")
+	CreateFolder("user1", "folder1", "desc1")
+	CreateFile("user1", "folder1", "file1", "descA")
+
+	if user, err := GetUser("user1"); err != nil || user.Username != "user1" || user.Folders != nil {
+		t.Errorf("GetUser(user1) = %+v, %v; expected a copy of user1 without folders", user, err)
+	}
+	if folder, err := GetFolder("user1", "folder1"); err != nil || folder.Description != "desc1" || folder.Files != nil {
+		t.Errorf("GetFolder(user1, folder1) = %+v, %v; expected a copy of folder1 without files", folder, err)
+	}
+	file, err := GetFile("user1", "folder1", "file1")
+	if err != nil || file.Description != "descA" {
+		t.Errorf("GetFile(user1, folder1, file1) = %+v, %v; expected file1", file, err)
+	}
+	file.Description = "changed"
+	if file, _ := GetFile("user1", "folder1", "file1"); file.Description != "descA" {
+		t.Errorf("GetFile returned the stored file instead of a copy")
+	}
+
+	for _, err := range []error{
+		func() error { _, err := GetUser("user2"); return err }(),
+		func() error { _, err := GetFolder("user1", "folder2"); return err }(),
+		func() error { _, err := GetFile("user1", "folder1", "file2"); return err }(),
+	} {
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound but got %v", err)
+		}
+	}
+}
+
+func TestSetFileDescription(t *testing.T) {
+	setupMockData()
+	RegisterUser("user1")
+	CreateFolder("user1", "folder1", "")
+	CreateFile("user1", "folder1", "file1", "old")
+
+	if err := SetFileDescription("user1", "folder1", "file1", "new"); err != nil {
+		t.Errorf("SetFileDescription returned error: %v", err)
+	}
+	if file, _ := GetFile("user1", "folder1", "file1"); file.Description != "new" {
+		t.Errorf("expected the description to be replaced but got %q", file.Description)
+	}
+	if err := SetFileDescription("user1", "folder1", "file2", "new"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound but got %v", err)
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	setupMockData()
+	RegisterUser("user1")
+	CreateFolder("user1", "folder1", "")
+	CreateFolder("user1", "folder2", "")
+	CreateFile("user1", "folder1", "file1", "desc1")
+	CreateFile("user1", "folder1", "file2", "desc2")
+	CreateFile("user1", "folder2", "taken", "")
+	created, _ := GetFile("user1", "folder1", "file1")
+
+	tests := []struct {
+		foldername    string
+		filename      string
+		newFolderName string
+		newFileName   string
+		expected      error
+	}{
+		{"folder1", "file1", "folder2", "moved", nil},
+		{"folder1", "file2", "folder1", "renamed", nil},
+		{"folder1", "file1", "folder2", "again", ErrNotFound},
+		{"folder1", "renamed", "folder3", "x", ErrNotFound},
+		{"folder1", "renamed", "folder2", "taken", ErrAlreadyExists},
+		{"folder1", "renamed", "folder2", "bad/name", ErrInvalidName},
+	}
+
+	for _, test := range tests {
+		err := MoveFile("user1", test.foldername, test.filename, test.newFolderName, test.newFileName)
+		if (test.expected == nil && err != nil) || !errors.Is(err, test.expected) {
+			t.Errorf("MoveFile(user1, %s, %s, %s, %s) = %v; expected %v", test.foldername, test.filename, test.newFolderName, test.newFileName, err, test.expected)
+		}
+	}
+
+	moved, err := GetFile("user1", "folder2", "moved")
+	if err != nil || moved.Description != "desc1" || !moved.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("expected the moved file to keep its description and creation time but got %+v, %v", moved, err)
+	}
+	if _, err := GetFile("user1", "folder1", "renamed"); err != nil {
+		t.Errorf("expected the renamed file in folder1 but got %v", err)
+	}
+}
@@ -0,0 +1,698 @@
+// internal/webdav/webdav.go
+
+// Package webdav serves the virtual file system over WebDAV (RFC 4918, class 1).
+// The first path segment is a user, the second a folder and the third a file. Files have no
+// content besides their description, so reading a file returns its description and writing
+// a file replaces it.
+package webdav
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// vfsNamespace is the XML namespace of the properties specific to the virtual file system
+const vfsNamespace = "urn:virtual-file-system:"
+
+// maxBodySize limits the size of request bodies, and so of descriptions
+const maxBodySize = 1 << 20
+
+// Levels of the tree a path points to
+const (
+	levelRoot = iota
+	levelUser
+	levelFolder
+	levelFile
+)
+
+// target is a path of the tree, split into its names
+type target struct {
+	level  int
+	user   string
+	folder string
+	file   string
+}
+
+// parent returns the path of the collection holding t
+func (t target) parent() target {
+	switch t.level {
+	case levelFile:
+		return target{level: levelFolder, user: t.user, folder: t.folder}
+	case levelFolder:
+		return target{level: levelUser, user: t.user}
+	}
+	return target{level: levelRoot}
+}
+
+// resource describes a user, folder or file for PROPFIND and GET
+type resource struct {
+	target      target
+	name        string
+	collection  bool
+	description string
+	createdAt   time.Time
+}
+
+// handler serves WebDAV requests for paths under prefix
+type handler struct {
+	prefix string
+}
+
+// NewHandler returns the WebDAV handler of the paths under prefix, e.g. "/dav"
+func NewHandler(prefix string) http.Handler {
+	return &handler{prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t, err := h.parsePath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("DAV", "1")
+		w.Header().Set("MS-Author-Via", "DAV")
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, MKCOL, PROPFIND, PROPPATCH, COPY, MOVE")
+	case "GET", "HEAD":
+		h.handleGet(w, r, t)
+	case "PUT":
+		h.handlePut(w, r, t)
+	case "DELETE":
+		h.handleDelete(w, t)
+	case "MKCOL":
+		h.handleMkcol(w, r, t)
+	case "PROPFIND":
+		h.handlePropfind(w, r, t)
+	case "PROPPATCH":
+		h.handleProppatch(w, r, t)
+	case "COPY", "MOVE":
+		h.handleCopyMove(w, r, t)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// parsePath splits a path under the prefix into a target
+func (h *handler) parsePath(path string) (target, error) {
+	rest, ok := strings.CutPrefix(path, h.prefix)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return target{}, errors.New("Not under " + h.prefix)
+	}
+	var names []string
+	for _, name := range strings.Split(strings.Trim(rest, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		// Clients keep the case of what they created, so mixed-case paths still resolve
+		names = append(names, internal.NormalizeName(name))
+	}
+	if len(names) > levelFile {
+		return target{}, errors.New("Files can't contain anything")
+	}
+
+	t := target{level: len(names)}
+	for i, name := range names {
+		switch i {
+		case 0:
+			t.user = name
+		case 1:
+			t.folder = name
+		case 2:
+			t.file = name
+		}
+	}
+	return t, nil
+}
+
+// href returns the escaped path of t, ending with a slash for collections
+func (h *handler) href(t target) string {
+	href := h.prefix + "/"
+	for _, name := range []string{t.user, t.folder, t.file}[:t.level] {
+		href += url.PathEscape(name) + "/"
+	}
+	if t.level == levelFile {
+		href = strings.TrimSuffix(href, "/")
+	}
+	return href
+}
+
+// stat returns the resource t points to
+func stat(t target) (*resource, error) {
+	switch t.level {
+	case levelRoot:
+		return &resource{target: t, collection: true}, nil
+	case levelUser:
+		user, err := internal.GetUser(t.user)
+		if err != nil {
+			return nil, err
+		}
+		return &resource{target: t, name: user.Username, collection: true}, nil
+	case levelFolder:
+		folder, err := internal.GetFolder(t.user, t.folder)
+		if err != nil {
+			return nil, err
+		}
+		return &resource{target: t, name: folder.Name, collection: true, description: folder.Description, createdAt: folder.CreatedAt}, nil
+	}
+	file, err := internal.GetFile(t.user, t.folder, t.file)
+	if err != nil {
+		return nil, err
+	}
+	return &resource{target: t, name: file.Name, description: file.Description, createdAt: file.CreatedAt}, nil
+}
+
+// children returns the resources inside the collection t
+func children(t target) ([]*resource, error) {
+	var result []*resource
+	switch t.level {
+	case levelRoot:
+		for _, username := range internal.ListUsers() {
+			result = append(result, &resource{target: target{level: levelUser, user: username}, name: username, collection: true})
+		}
+	case levelUser:
+		folders, err := internal.ListFolders(t.user, "name", "asc")
+		if err != nil {
+			return nil, err
+		}
+		for _, folder := range folders {
+			child := target{level: levelFolder, user: t.user, folder: folder.Name}
+			result = append(result, &resource{target: child, name: folder.Name, collection: true, description: folder.Description, createdAt: folder.CreatedAt})
+		}
+	case levelFolder:
+		files, err := internal.ListFiles(t.user, t.folder, "name", "asc")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			child := target{level: levelFile, user: t.user, folder: t.folder, file: file.Name}
+			result = append(result, &resource{target: child, name: file.Name, description: file.Description, createdAt: file.CreatedAt})
+		}
+	}
+	return result, nil
+}
+
+// statusOf maps an error of the internal operations to a status code. A missing parent
+// of a resource being created is a conflict rather than a missing resource.
+func statusOf(err error, creating target) int {
+	var nameErr *internal.NameError
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		if errors.As(err, &nameErr) && creating.level > levelRoot && nameErr.Name != []string{"", creating.user, creating.folder, creating.file}[creating.level] {
+			return http.StatusConflict
+		}
+		return http.StatusNotFound
+	case errors.Is(err, internal.ErrAlreadyExists):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, internal.ErrInvalidName):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError writes an error of the internal operations
+func writeError(w http.ResponseWriter, err error, creating target) {
+	http.Error(w, err.Error(), statusOf(err, creating))
+}
+
+func (h *handler) handleGet(w http.ResponseWriter, r *http.Request, t target) {
+	res, err := stat(t)
+	if err != nil {
+		writeError(w, err, target{})
+		return
+	}
+
+	var body string
+	if res.collection {
+		list, err := children(t)
+		if err != nil {
+			writeError(w, err, target{})
+			return
+		}
+		for _, child := range list {
+			body += child.name
+			if child.collection {
+				body += "/"
+			}
+			body += "\n"
+		}
+	} else {
+		body = res.description
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if !res.createdAt.IsZero() {
+		w.Header().Set("Last-Modified", res.createdAt.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != "HEAD" {
+		io.WriteString(w, body)
+	}
+}
+
+func (h *handler) handlePut(w http.ResponseWriter, r *http.Request, t target) {
+	if t.level != levelFile {
+		http.Error(w, "Only files can be written", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	description := string(data)
+	err = internal.SetFileDescription(t.user, t.folder, t.file, description)
+	if err == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !errors.Is(err, internal.ErrNotFound) {
+		writeError(w, err, t)
+		return
+	}
+	if err := internal.CreateFile(t.user, t.folder, t.file, description); err != nil {
+		writeError(w, err, t)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *handler) handleDelete(w http.ResponseWriter, t target) {
+	var err error
+	switch t.level {
+	case levelFile:
+		err = internal.DeleteFile(t.user, t.folder, t.file)
+	case levelFolder:
+		err = internal.DeleteFolder(t.user, t.folder)
+	default:
+		http.Error(w, "Users can't be deleted", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		writeError(w, err, target{})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) handleMkcol(w http.ResponseWriter, r *http.Request, t target) {
+	if r.ContentLength > 0 {
+		http.Error(w, "MKCOL with a body isn't supported", http.StatusUnsupportedMediaType)
+		return
+	}
+	var err error
+	switch t.level {
+	case levelUser:
+		err = internal.RegisterUser(t.user)
+	case levelFolder:
+		err = internal.CreateFolder(t.user, t.folder, "")
+	case levelFile:
+		http.Error(w, "Folders can't contain folders", http.StatusForbidden)
+		return
+	default:
+		http.Error(w, "The root already exists", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		writeError(w, err, t)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// errOtherServer is reported for a Destination on another server
+var errOtherServer = errors.New("The destination is on another server")
+
+// destination parses the Destination header of COPY and MOVE
+func (h *handler) destination(r *http.Request) (target, error) {
+	value := r.Header.Get("Destination")
+	if value == "" {
+		return target{}, errors.New("Missing Destination header")
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return target{}, errors.New("Invalid Destination header")
+	}
+	if u.Host != "" && u.Host != r.Host {
+		return target{}, errOtherServer
+	}
+	return h.parsePath(u.Path)
+}
+
+// handleCopyMove copies or moves a folder or a file.
+// Moves stay within a user, since only copies can be made between users.
+func (h *handler) handleCopyMove(w http.ResponseWriter, r *http.Request, src target) {
+	dst, err := h.destination(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errOtherServer) {
+			status = http.StatusBadGateway
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	move := r.Method == "MOVE"
+	switch {
+	case src.level < levelFolder:
+		http.Error(w, "Only folders and files can be copied or moved", http.StatusForbidden)
+		return
+	case dst.level != src.level:
+		http.Error(w, "A folder can only become a folder, and a file a file", http.StatusConflict)
+		return
+	case dst == src:
+		http.Error(w, "The source and the destination are the same", http.StatusForbidden)
+		return
+	case move && dst.user != src.user:
+		http.Error(w, "Moving between users isn't supported", http.StatusForbidden)
+		return
+	}
+
+	res, err := stat(src)
+	if err != nil {
+		writeError(w, err, target{})
+		return
+	}
+
+	deep := r.Header.Get("Depth") != "0"
+	if _, err := stat(dst); err != nil {
+		if err := transfer(src, dst, res.description, move, deep); err != nil {
+			writeError(w, err, dst)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if r.Header.Get("Overwrite") == "F" {
+		http.Error(w, "The destination exists", http.StatusPreconditionFailed)
+		return
+	}
+	if err := overwrite(src, dst, res.description, move, deep); err != nil {
+		writeError(w, err, dst)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// transfer copies or moves src to dst, which doesn't exist
+func transfer(src, dst target, description string, move, deep bool) error {
+	switch {
+	case move && src.level == levelFile:
+		return internal.MoveFile(src.user, src.folder, src.file, dst.folder, dst.file)
+	case move:
+		return internal.RenameFolder(src.user, src.folder, dst.folder)
+	case src.level == levelFile:
+		return internal.CreateFile(dst.user, dst.folder, dst.file, description)
+	}
+	return copyFolder(src, dst, description, deep)
+}
+
+// overwrite replaces the existing dst with src. The copy or move is made under a temporary
+// name next to dst first, so dst is only deleted once it succeeded.
+func overwrite(src, dst target, description string, move, deep bool) error {
+	staged := dst
+	name, err := temporaryName()
+	if err != nil {
+		return err
+	}
+	if dst.level == levelFile {
+		staged.file = name
+	} else {
+		staged.folder = name
+	}
+	if err := transfer(src, staged, description, move, deep); err != nil {
+		if !move && staged.level == levelFolder {
+			// A deep copy may have failed halfway
+			internal.DeleteFolder(staged.user, staged.folder)
+		}
+		return err
+	}
+
+	if dst.level == levelFile {
+		if err := internal.DeleteFile(dst.user, dst.folder, dst.file); err != nil {
+			return err
+		}
+		return internal.MoveFile(dst.user, dst.folder, staged.file, dst.folder, dst.file)
+	}
+	if err := internal.DeleteFolder(dst.user, dst.folder); err != nil {
+		return err
+	}
+	return internal.RenameFolder(dst.user, staged.folder, dst.folder)
+}
+
+// temporaryName returns a random valid name for the entries being overwritten
+func temporaryName() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "webdav-overwrite-" + hex.EncodeToString(b), nil
+}
+
+// copyFolder creates dst with description and, when deep is set, copies the files of src into it
+func copyFolder(src, dst target, description string, deep bool) error {
+	if err := internal.CreateFolder(dst.user, dst.folder, description); err != nil {
+		return err
+	}
+	if !deep {
+		return nil
+	}
+	files, err := internal.ListFiles(src.user, src.folder, "name", "asc")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := internal.CreateFile(dst.user, dst.folder, file.Name, file.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// propfindRequest is the body of PROPFIND. An empty body asks for all properties.
+type propfindRequest struct {
+	AllProp  *struct{}  `xml:"DAV: allprop"`
+	PropName *struct{}  `xml:"DAV: propname"`
+	Prop     *namesList `xml:"DAV: prop"`
+}
+
+// namesList holds the names of the properties listed in a prop element
+type namesList struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+// properties returns the values of the properties of res, as XML
+func properties(res *resource) map[xml.Name]string {
+	props := map[xml.Name]string{
+		{Space: "DAV:", Local: "displayname"}:  escape(res.name),
+		{Space: "DAV:", Local: "resourcetype"}: "",
+	}
+	if res.collection {
+		props[xml.Name{Space: "DAV:", Local: "resourcetype"}] = "<D:collection/>"
+	} else {
+		props[xml.Name{Space: "DAV:", Local: "getcontentlength"}] = strconv.Itoa(len(res.description))
+		props[xml.Name{Space: "DAV:", Local: "getcontenttype"}] = "text/plain; charset=utf-8"
+	}
+	if !res.createdAt.IsZero() {
+		props[xml.Name{Space: "DAV:", Local: "creationdate"}] = res.createdAt.UTC().Format(time.RFC3339)
+		props[xml.Name{Space: "DAV:", Local: "getlastmodified"}] = res.createdAt.UTC().Format(http.TimeFormat)
+	}
+	if res.target.level >= levelFolder {
+		props[xml.Name{Space: vfsNamespace, Local: "description"}] = escape(res.description)
+	}
+	return props
+}
+
+// propertyOrder lists the properties in the order they're written
+var propertyOrder = []xml.Name{
+	{Space: "DAV:", Local: "displayname"},
+	{Space: "DAV:", Local: "resourcetype"},
+	{Space: "DAV:", Local: "creationdate"},
+	{Space: "DAV:", Local: "getlastmodified"},
+	{Space: "DAV:", Local: "getcontentlength"},
+	{Space: "DAV:", Local: "getcontenttype"},
+	{Space: vfsNamespace, Local: "description"},
+}
+
+// escape escapes text for XML
+func escape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// element writes an XML element with a prefix of the namespaces declared by the multistatus
+func element(name xml.Name, value string) string {
+	prefix := "D"
+	switch name.Space {
+	case "DAV:":
+	case vfsNamespace:
+		prefix = "V"
+	default:
+		return fmt.Sprintf(`<X:%s xmlns:X="%s">%s</X:%s>`, name.Local, escape(name.Space), value, name.Local)
+	}
+	if value == "" {
+		return fmt.Sprintf("<%s:%s/>", prefix, name.Local)
+	}
+	return fmt.Sprintf("<%s:%s>%s</%s:%s>", prefix, name.Local, value, prefix, name.Local)
+}
+
+// propstat writes the properties answered with the same status
+func propstat(b *strings.Builder, status int, props []string) {
+	if len(props) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "<D:propstat><D:prop>%s</D:prop><D:status>HTTP/1.1 %d %s</D:status></D:propstat>", strings.Join(props, ""), status, http.StatusText(status))
+}
+
+// writeMultistatus writes a 207 response around the response elements
+func writeMultistatus(w http.ResponseWriter, responses string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+`<D:multistatus xmlns:D="DAV:" xmlns:V="%s">%s</D:multistatus>`, vfsNamespace, responses)
+}
+
+func (h *handler) handlePropfind(w http.ResponseWriter, r *http.Request, t target) {
+	depth := r.Header.Get("Depth")
+	if depth == "" || depth == "infinity" {
+		http.Error(w, "PROPFIND with an infinite depth isn't supported", http.StatusForbidden)
+		return
+	}
+
+	var req propfindRequest
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		err = xml.Unmarshal(data, &req)
+	}
+	if err != nil {
+		http.Error(w, "Invalid PROPFIND body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := stat(t)
+	if err != nil {
+		writeError(w, err, target{})
+		return
+	}
+	resources := []*resource{res}
+	if depth == "1" && res.collection {
+		list, err := children(t)
+		if err != nil {
+			writeError(w, err, target{})
+			return
+		}
+		resources = append(resources, list...)
+	}
+
+	var b strings.Builder
+	for _, res := range resources {
+		props := properties(res)
+		var found, missing []string
+		switch {
+		case req.Prop != nil:
+			for _, requested := range req.Prop.Names {
+				if value, ok := props[requested.XMLName]; ok {
+					found = append(found, element(requested.XMLName, value))
+				} else {
+					missing = append(missing, element(requested.XMLName, ""))
+				}
+			}
+		default:
+			for _, name := range propertyOrder {
+				if value, ok := props[name]; ok {
+					if req.PropName != nil {
+						value = ""
+					}
+					found = append(found, element(name, value))
+				}
+			}
+		}
+		fmt.Fprintf(&b, "<D:response><D:href>%s</D:href>", escape(h.href(res.target)))
+		propstat(&b, http.StatusOK, found)
+		propstat(&b, http.StatusNotFound, missing)
+		b.WriteString("</D:response>")
+	}
+	writeMultistatus(w, b.String())
+}
+
+// proppatchRequest is the body of PROPPATCH
+type proppatchRequest struct {
+	Set []struct {
+		Prop struct {
+			Values []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"DAV: prop"`
+	} `xml:"DAV: set"`
+	Remove []struct {
+		Prop namesList `xml:"DAV: prop"`
+	} `xml:"DAV: remove"`
+}
+
+// handleProppatch sets the description of a file. Every other property is read-only.
+// Since the changes must be all or nothing, nothing is changed when any of them is refused.
+func (h *handler) handleProppatch(w http.ResponseWriter, r *http.Request, t target) {
+	var req proppatchRequest
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err == nil {
+		err = xml.Unmarshal(data, &req)
+	}
+	if err != nil {
+		http.Error(w, "Invalid PROPPATCH body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := stat(t); err != nil {
+		writeError(w, err, target{})
+		return
+	}
+
+	description := xml.Name{Space: vfsNamespace, Local: "description"}
+	var allowed, refused []string
+	var value *string
+	for _, set := range req.Set {
+		for _, prop := range set.Prop.Values {
+			if prop.XMLName == description && t.level == levelFile {
+				allowed = append(allowed, element(prop.XMLName, ""))
+				value = &prop.Value
+			} else {
+				refused = append(refused, element(prop.XMLName, ""))
+			}
+		}
+	}
+	for _, remove := range req.Remove {
+		for _, prop := range remove.Prop.Names {
+			refused = append(refused, element(prop.XMLName, ""))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<D:response><D:href>%s</D:href>", escape(h.href(t)))
+	if len(refused) > 0 {
+		propstat(&b, http.StatusFailedDependency, allowed)
+		propstat(&b, http.StatusForbidden, refused)
+	} else {
+		if value != nil {
+			if err := internal.SetFileDescription(t.user, t.folder, t.file, *value); err != nil {
+				writeError(w, err, target{})
+				return
+			}
+		}
+		propstat(&b, http.StatusOK, allowed)
+	}
+	b.WriteString("</D:response>")
+	writeMultistatus(w, b.String())
+}
@@ -0,0 +1,236 @@
+// internal/webdav/webdav_test.go
+package webdav
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// multistatus is the part of a PROPFIND response the tests look at
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"href"`
+		Propstats []struct {
+			Prop struct {
+				DisplayName  string    `xml:"displayname"`
+				Collection   *struct{} `xml:"resourcetype>collection"`
+				CreationDate string    `xml:"creationdate"`
+				Length       string    `xml:"getcontentlength"`
+				Description  string    `xml:"urn:virtual-file-system: description"`
+				Any          []struct {
+					XMLName xml.Name
+				} `xml:",any"`
+			} `xml:"prop"`
+			Status string `xml:"status"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// send sends a request to the server and returns its status and body
+func send(t *testing.T, server *httptest.Server, method, path, body string, headers ...string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	internal.UseMockData(make(map[string]*internal.User))
+	mux := http.NewServeMux()
+	mux.Handle("/dav/", NewHandler("/dav"))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebDAV(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		headers  []string
+		status   int
+		expected string
+	}{
+		{"MKCOL", "/dav/Alice/", "", nil, 201, ""},
+		{"MKCOL", "/dav/alice/", "", nil, 405, "The alice has already existed.\n"},
+		{"MKCOL", "/dav/alice/Docs/", "", nil, 201, ""},
+		{"MKCOL", "/dav/bob/docs/", "", nil, 409, "The bob doesn't exist.\n"},
+		{"MKCOL", "/dav/alice/docs/file/", "", nil, 403, "Folders can't contain folders\n"},
+		{"MKCOL", "/dav/alice/bad.name/", "", nil, 400, "The bad.name contains invalid chars.\n"},
+		{"PUT", "/dav/alice/docs/notes", "first", nil, 201, ""},
+		{"PUT", "/dav/alice/docs/notes", "second", nil, 204, ""},
+		{"PUT", "/dav/alice/nothing/notes", "", nil, 409, "The nothing doesn't exist.\n"},
+		{"PUT", "/dav/alice/docs/", "", nil, 405, "Only files can be written\n"},
+		{"GET", "/dav/alice/docs/notes", "", nil, 200, "second"},
+		{"GET", "/dav/alice/docs/missing", "", nil, 404, "The missing doesn't exist.\n"},
+		{"GET", "/dav/alice/", "", nil, 200, "docs/\n"},
+		{"COPY", "/dav/alice/docs/notes", "", []string{"Destination", "/dav/alice/docs/copy"}, 201, ""},
+		{"COPY", "/dav/alice/docs/notes", "", []string{"Destination", "/dav/alice/docs/copy", "Overwrite", "F"}, 412, "The destination exists\n"},
+		{"COPY", "/dav/alice/docs/notes", "", []string{"Destination", "/dav/alice/docs/copy"}, 204, ""},
+		{"COPY", "/dav/alice/docs/", "", []string{"Destination", "/dav/alice/backup/"}, 201, ""},
+		{"GET", "/dav/alice/backup/", "", nil, 200, "copy\nnotes\n"},
+		{"COPY", "/dav/alice/docs/", "", []string{"Destination", "/dav/alice/docs/x"}, 409, "A folder can only become a folder, and a file a file\n"},
+		{"MOVE", "/dav/alice/docs/copy", "", []string{"Destination", "/dav/alice/backup/moved"}, 201, ""},
+		{"GET", "/dav/alice/backup/moved", "", nil, 200, "second"},
+		{"MOVE", "/dav/alice/backup/", "", []string{"Destination", "/dav/alice/archive/"}, 201, ""},
+		{"MOVE", "/dav/alice/archive/", "", []string{"Destination", "/dav/bob/archive/"}, 403, "Moving between users isn't supported\n"},
+		{"MOVE", "/dav/alice/archive/", "", nil, 400, "Missing Destination header\n"},
+		{"MOVE", "/dav/alice/archive/", "", []string{"Destination", "/dav/%zz/"}, 400, "Invalid Destination header\n"},
+		{"MOVE", "/dav/alice/archive/", "", []string{"Destination", "http://example.com/dav/alice/old/"}, 502, "The destination is on another server\n"},
+		{"GET", "/dav/alice/", "", nil, 200, "archive/\ndocs/\n"},
+		{"DELETE", "/dav/alice/archive/moved", "", nil, 204, ""},
+		{"DELETE", "/dav/alice/archive/", "", nil, 204, ""},
+		{"DELETE", "/dav/alice/archive/", "", nil, 404, "The archive doesn't exist.\n"},
+		{"DELETE", "/dav/alice/", "", nil, 403, "Users can't be deleted\n"},
+		{"GET", "/dav/", "", nil, 200, "alice/\n"},
+		{"GET", "/dav/a/b/c/d", "", nil, 404, "Files can't contain anything\n"},
+		{"PROPFIND", "/dav/", "", []string{"Depth", "infinity"}, 403, "PROPFIND with an infinite depth isn't supported\n"},
+		{"LOCK", "/dav/alice/", "", nil, 405, "Method not allowed\n"},
+	}
+
+	for _, tt := range tests {
+		status, body := send(t, server, tt.method, tt.path, tt.body, tt.headers...)
+		if status != tt.status || body != tt.expected {
+			t.Errorf("%s %s\nexpected %d %q\nbut got %d %q", tt.method, tt.path, tt.status, tt.expected, status, body)
+		}
+	}
+}
+
+func TestOverwrite(t *testing.T) {
+	server := newTestServer(t)
+	internal.RegisterUser("alice")
+	internal.CreateFolder("alice", "docs", "")
+	internal.CreateFolder("alice", "old", "")
+	internal.CreateFile("alice", "docs", "notes", "new")
+	internal.CreateFile("alice", "docs", "draft", "draft")
+	internal.CreateFile("alice", "old", "notes", "old")
+	internal.CreateFile("alice", "old", "stale", "")
+
+	tests := []struct {
+		method   string
+		path     string
+		headers  []string
+		status   int
+		expected string
+	}{
+		{"MOVE", "/dav/alice/docs/draft", []string{"Destination", "/dav/alice/old/notes"}, 204, ""},
+		{"GET", "/dav/alice/old/notes", nil, 200, "draft"},
+		{"COPY", "/dav/alice/docs/", []string{"Destination", "/dav/alice/old/"}, 204, ""},
+		{"GET", "/dav/alice/old/", nil, 200, "notes\n"},
+		{"GET", "/dav/alice/old/notes", nil, 200, "new"},
+		{"MOVE", "/dav/alice/old/", []string{"Destination", "/dav/alice/docs/"}, 204, ""},
+		{"GET", "/dav/alice/", nil, 200, "docs/\n"},
+	}
+
+	for _, tt := range tests {
+		status, body := send(t, server, tt.method, tt.path, "", tt.headers...)
+		if status != tt.status || body != tt.expected {
+			t.Errorf("%s %s\nexpected %d %q\nbut got %d %q", tt.method, tt.path, tt.status, tt.expected, status, body)
+		}
+	}
+}
+
+func TestPropfind(t *testing.T) {
+	server := newTestServer(t)
+	internal.RegisterUser("alice")
+	internal.CreateFolder("alice", "docs", "Documents & more")
+	internal.CreateFile("alice", "docs", "notes", "hello")
+
+	status, body := send(t, server, "PROPFIND", "/dav/alice/docs/", "", "Depth", "1")
+	if status != http.StatusMultiStatus {
+		t.Fatalf("expected 207 but got %d %s", status, body)
+	}
+	var result multistatus
+	if err := xml.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatalf("invalid multistatus %s: %v", body, err)
+	}
+	if len(result.Responses) != 2 {
+		t.Fatalf("expected the folder and its file but got %s", body)
+	}
+
+	folder, file := result.Responses[0], result.Responses[1]
+	if folder.Href != "/dav/alice/docs/" || folder.Propstats[0].Prop.Collection == nil || folder.Propstats[0].Prop.Description != "Documents & more" {
+		t.Errorf("unexpected folder properties %+v", folder)
+	}
+	prop := file.Propstats[0].Prop
+	if file.Href != "/dav/alice/docs/notes" || prop.Collection != nil || prop.DisplayName != "notes" || prop.Length != "5" || prop.Description != "hello" {
+		t.Errorf("unexpected file properties %+v", file)
+	}
+	created, _ := internal.GetFile("alice", "docs", "notes")
+	if prop.CreationDate != created.CreatedAt.UTC().Format(time.RFC3339) {
+		t.Errorf("expected creationdate %s but got %q", created.CreatedAt.UTC().Format(time.RFC3339), prop.CreationDate)
+	}
+
+	// Named properties, one of them unknown
+	request := `<?xml version="1.0"?><propfind xmlns="DAV:" xmlns:V="urn:virtual-file-system:"><prop><V:description/><quota/></prop></propfind>`
+	status, body = send(t, server, "PROPFIND", "/dav/alice/docs/notes", request, "Depth", "0")
+	result = multistatus{}
+	if err := xml.Unmarshal([]byte(body), &result); err != nil || status != http.StatusMultiStatus || len(result.Responses) != 1 {
+		t.Fatalf("expected a single response but got %d %s", status, body)
+	}
+	propstats := result.Responses[0].Propstats
+	if len(propstats) != 2 || propstats[0].Prop.Description != "hello" || !strings.Contains(propstats[1].Status, "404") ||
+		len(propstats[1].Prop.Any) != 1 || propstats[1].Prop.Any[0].XMLName.Local != "quota" {
+		t.Errorf("expected the description and a missing quota but got %s", body)
+	}
+}
+
+func TestProppatch(t *testing.T) {
+	server := newTestServer(t)
+	internal.RegisterUser("alice")
+	internal.CreateFolder("alice", "docs", "")
+	internal.CreateFile("alice", "docs", "notes", "hello")
+
+	request := `<?xml version="1.0"?><propertyupdate xmlns="DAV:" xmlns:V="urn:virtual-file-system:"><set><prop><V:description>updated</V:description></prop></set></propertyupdate>`
+	status, body := send(t, server, "PROPPATCH", "/dav/alice/docs/notes", request)
+	if status != http.StatusMultiStatus || !strings.Contains(body, "200 OK") {
+		t.Errorf("expected the description to be set but got %d %s", status, body)
+	}
+	if file, _ := internal.GetFile("alice", "docs", "notes"); file.Description != "updated" {
+		t.Errorf("expected description updated but got %q", file.Description)
+	}
+
+	// Read-only properties fail the whole update
+	request = `<?xml version="1.0"?><propertyupdate xmlns="DAV:" xmlns:V="urn:virtual-file-system:"><set><prop><V:description>again</V:description><displayname>x</displayname></prop></set></propertyupdate>`
+	status, body = send(t, server, "PROPPATCH", "/dav/alice/docs/notes", request)
+	if status != http.StatusMultiStatus || !strings.Contains(body, "403 Forbidden") || !strings.Contains(body, "424 Failed Dependency") {
+		t.Errorf("expected the update to be refused but got %d %s", status, body)
+	}
+	if file, _ := internal.GetFile("alice", "docs", "notes"); file.Description != "updated" {
+		t.Errorf("expected description updated but got %q", file.Description)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	server := newTestServer(t)
+	req, _ := http.NewRequest("OPTIONS", server.URL+"/dav/", nil)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if dav := resp.Header.Get("DAV"); dav != "1" || !strings.Contains(resp.Header.Get("Allow"), "PROPFIND") {
+		t.Errorf("expected DAV class 1 with PROPFIND allowed but got %q %q", dav, resp.Header.Get("Allow"))
+	}
+}
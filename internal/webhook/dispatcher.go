@@ -0,0 +1,259 @@
+// internal/webhook/dispatcher.go
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// TestEvent is the type of the events sent by Test
+const TestEvent internal.EventType = "webhook.test"
+
+// Headers of a delivery
+const (
+	HeaderEvent     = "X-VFS-Event"
+	HeaderDelivery  = "X-VFS-Delivery"
+	HeaderSignature = "X-VFS-Signature"
+)
+
+// Sign returns the signature of a body, sent in the X-VFS-Signature header as
+// sha256= followed by the hex HMAC-SHA256 of the body keyed with the secret of the webhook
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher delivers the events of the operations to the webhooks of a store
+type Dispatcher struct {
+	Store  *Store
+	Client *http.Client
+	// MaxAttempts is how many times a delivery is tried before it becomes a dead letter
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled after each one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	mu         sync.Mutex
+	sub        *internal.Subscription
+	loopDone   chan struct{}
+	deliveries sync.WaitGroup
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// NewDispatcher returns a dispatcher trying each delivery 5 times over about 15 seconds
+func NewDispatcher(store *Store) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		Store:       store,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Minute,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Start subscribes to the events of the operations and delivers them in the background
+func (d *Dispatcher) Start() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sub, err := internal.Subscribe(internal.EventFilter{}, 0)
+	if err != nil {
+		return err
+	}
+	d.sub = sub
+	d.loopDone = make(chan struct{})
+	go d.loop(sub)
+	return nil
+}
+
+// loop starts the deliveries of the events. It resubscribes when it fell behind, after the
+// last event it saw if it's still kept.
+func (d *Dispatcher) loop(sub *internal.Subscription) {
+	defer close(d.loopDone)
+	var last uint64
+	for {
+		for e := range sub.Events() {
+			last = e.Seq
+			d.dispatch(e)
+		}
+		if sub.Err() == nil {
+			return
+		}
+
+		resumed, err := internal.Subscribe(internal.EventFilter{}, last)
+		if errors.Is(err, internal.ErrEventsExpired) {
+			resumed, err = internal.Subscribe(internal.EventFilter{}, 0)
+		}
+		if err != nil {
+			return
+		}
+		d.mu.Lock()
+		if d.sub == nil {
+			d.mu.Unlock()
+			resumed.Close()
+			return
+		}
+		d.sub, sub = resumed, resumed
+		d.mu.Unlock()
+	}
+}
+
+// dispatch starts the delivery of an event to each webhook it matches
+func (d *Dispatcher) dispatch(e internal.Event) {
+	webhooks, err := d.Store.List()
+	if err != nil {
+		return
+	}
+	for _, w := range webhooks {
+		if w.Match(e) {
+			d.deliveries.Add(1)
+			go func(w Webhook) {
+				defer d.deliveries.Done()
+				d.deliverWithRetries(w, e)
+			}(w)
+		}
+	}
+}
+
+// deliverWithRetries tries a delivery until it succeeds or runs out of attempts, and then
+// queues it as a dead letter. Close stops the retries early.
+func (d *Dispatcher) deliverWithRetries(w Webhook, e internal.Event) {
+	backoff := d.Backoff
+	attempts := 0
+	var err error
+retries:
+	for attempts < d.MaxAttempts {
+		attempts++
+		if _, err = d.Deliver(d.ctx, w, e); err == nil {
+			return
+		}
+		if attempts == d.MaxAttempts {
+			break
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			timer.Stop()
+			err = fmt.Errorf("stopped before delivery: %w", err)
+			break retries
+		}
+		if backoff *= 2; backoff > d.MaxBackoff {
+			backoff = d.MaxBackoff
+		}
+	}
+	d.Store.AddDeadLetter(DeadLetter{Webhook: w.ID, Event: e, Attempts: attempts, Error: err.Error(), FailedAt: time.Now()})
+}
+
+// Deliver posts an event to a webhook once and returns the status code of the answer.
+// Answers other than 2xx are errors.
+func (d *Dispatcher) Deliver(ctx context.Context, w Webhook, e internal.Event) (int, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	delivery := fmt.Sprintf("%d-%d", w.ID, e.Seq)
+	if e.Type == TestEvent {
+		delivery = fmt.Sprintf("%d-test", w.ID)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "vfs-webhook")
+	req.Header.Set(HeaderEvent, string(e.Type))
+	req.Header.Set(HeaderDelivery, delivery)
+	req.Header.Set(HeaderSignature, Sign(w.Secret, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%s answered %s", w.URL, resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Test delivers a webhook.test event to a webhook once, without retries
+func (d *Dispatcher) Test(ctx context.Context, id int) (int, error) {
+	w, err := d.Store.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	e := internal.Event{Type: TestEvent, Time: time.Now(), Username: w.Username, Folder: w.Folder}
+	return d.Deliver(ctx, w, e)
+}
+
+// Redeliver tries the dead letters of a webhook once more, oldest first, and keeps the ones
+// that failed again. It returns how many were delivered and how many are left.
+func (d *Dispatcher) Redeliver(ctx context.Context, id int) (int, int, error) {
+	w, err := d.Store.Get(id)
+	if err != nil {
+		return 0, 0, err
+	}
+	letters, err := d.Store.DeadLetters(id)
+	if err != nil {
+		return 0, 0, err
+	}
+	var failed []DeadLetter
+	for _, letter := range letters {
+		if _, err := d.Deliver(ctx, w, letter.Event); err != nil {
+			letter.Attempts++
+			letter.Error = err.Error()
+			letter.FailedAt = time.Now()
+			failed = append(failed, letter)
+		}
+	}
+	if err := d.Store.ReplaceDeadLetters(letters, failed); err != nil {
+		return 0, 0, err
+	}
+	return len(letters) - len(failed), len(failed), nil
+}
+
+// Close stops taking events and waits up to timeout for the deliveries in progress.
+// Deliveries still waiting to be retried after that become dead letters.
+func (d *Dispatcher) Close(timeout time.Duration) {
+	d.mu.Lock()
+	sub := d.sub
+	d.sub = nil
+	d.mu.Unlock()
+	if sub != nil {
+		// The events received before are still delivered
+		sub.Close()
+		<-d.loopDone
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.deliveries.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		d.cancel()
+		<-done
+	}
+	d.cancel()
+}
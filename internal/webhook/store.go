@@ -0,0 +1,284 @@
+// internal/webhook/store.go
+
+// Package webhook delivers the events of the virtual file system to registered URLs.
+// Deliveries are signed with HMAC-SHA256, retried with exponential backoff, and kept in a
+// dead-letter queue when every attempt failed. Webhooks and dead letters are kept in a JSON
+// file, which is read again on every event so other processes can change it.
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// Webhook is a URL receiving the events selected by its filters.
+// Empty filters select everything.
+type Webhook struct {
+	ID        int                  `json:"id"`
+	URL       string               `json:"url"`
+	Secret    string               `json:"secret"`
+	Username  string               `json:"username,omitempty"`
+	Folder    string               `json:"folder,omitempty"`
+	Events    []internal.EventType `json:"events,omitempty"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+// Match reports whether the webhook receives e
+func (w Webhook) Match(e internal.Event) bool {
+	if !(internal.EventFilter{Username: w.Username, Folder: w.Folder}).Match(e) {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, t := range w.Events {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// DeadLetter is an event that couldn't be delivered to a webhook
+type DeadLetter struct {
+	Webhook  int            `json:"webhook"`
+	Event    internal.Event `json:"event"`
+	Attempts int            `json:"attempts"`
+	Error    string         `json:"error"`
+	FailedAt time.Time      `json:"failed_at"`
+}
+
+// NotFoundError reports a webhook that doesn't exist
+type NotFoundError struct {
+	ID int
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("The webhook %d doesn't exist.", e.ID)
+}
+
+// Unwrap makes errors.Is match internal.ErrNotFound
+func (e *NotFoundError) Unwrap() error {
+	return internal.ErrNotFound
+}
+
+// Validate checks the URL and the filters of a webhook
+func Validate(w Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid URL %s, expected an http or https URL", internal.QuoteIfNeeded(w.URL))
+	}
+	if w.Folder != "" && w.Username == "" {
+		return errors.New("Invalid folder filter: a user is needed too")
+	}
+	for _, t := range w.Events {
+		known := false
+		for _, eventType := range internal.EventTypes {
+			known = known || t == eventType
+		}
+		if !known {
+			names := make([]string, len(internal.EventTypes))
+			for i, eventType := range internal.EventTypes {
+				names[i] = string(eventType)
+			}
+			return fmt.Errorf("Unknown event type %s, expected one of %s", internal.QuoteIfNeeded(string(t)), strings.Join(names, ","))
+		}
+	}
+	return nil
+}
+
+// state is the content of the webhooks file
+type state struct {
+	NextID      int          `json:"next_id"`
+	Webhooks    []Webhook    `json:"webhooks"`
+	DeadLetters []DeadLetter `json:"dead_letters"`
+}
+
+// Store keeps webhooks and dead letters in a JSON file
+type Store struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewStore returns the store of the file at path, which is created on the first change
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path returns the path of the file
+func (s *Store) Path() string {
+	return s.path
+}
+
+// load reads the file, a missing file has no webhooks. The caller must hold mu.
+func (s *Store) load() (*state, error) {
+	st := &state{NextID: 1}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	} else if err != nil {
+		return nil, &internal.StorageError{Op: "loading webhooks", Err: err}
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, &internal.StorageError{Op: "loading webhooks", Err: err}
+	}
+	return st, nil
+}
+
+// save writes the file. It holds secrets, so only the owner may read it. The caller must hold mu.
+func (s *Store) save(st *state) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return &internal.StorageError{Op: "saving webhooks", Err: err}
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return &internal.StorageError{Op: "saving webhooks", Err: err}
+	}
+	return nil
+}
+
+// update applies change to the content of the file and saves it
+func (s *Store) update(change func(st *state) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := change(st); err != nil {
+		return err
+	}
+	return s.save(st)
+}
+
+// List returns the webhooks in the order they were added
+func (s *Store) List() ([]Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return st.Webhooks, nil
+}
+
+// Get returns a webhook
+func (s *Store) Get(id int) (Webhook, error) {
+	webhooks, err := s.List()
+	if err != nil {
+		return Webhook{}, err
+	}
+	for _, w := range webhooks {
+		if w.ID == id {
+			return w, nil
+		}
+	}
+	return Webhook{}, &NotFoundError{ID: id}
+}
+
+// Add validates and adds a webhook, numbering it and generating a secret when it has none
+func (s *Store) Add(w Webhook) (Webhook, error) {
+	if err := Validate(w); err != nil {
+		return Webhook{}, err
+	}
+	if w.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return Webhook{}, err
+		}
+		w.Secret = hex.EncodeToString(secret)
+	}
+	err := s.update(func(st *state) error {
+		w.ID = st.NextID
+		w.CreatedAt = time.Now()
+		st.NextID++
+		st.Webhooks = append(st.Webhooks, w)
+		return nil
+	})
+	return w, err
+}
+
+// Remove removes a webhook and its dead letters
+func (s *Store) Remove(id int) error {
+	return s.update(func(st *state) error {
+		for i, w := range st.Webhooks {
+			if w.ID == id {
+				st.Webhooks = append(st.Webhooks[:i], st.Webhooks[i+1:]...)
+				st.DeadLetters = without(st.DeadLetters, id)
+				return nil
+			}
+		}
+		return &NotFoundError{ID: id}
+	})
+}
+
+// DeadLetters returns the dead letters of a webhook, oldest first
+func (s *Store) DeadLetters(id int) ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var letters []DeadLetter
+	for _, letter := range st.DeadLetters {
+		if letter.Webhook == id {
+			letters = append(letters, letter)
+		}
+	}
+	return letters, nil
+}
+
+// AddDeadLetter queues an event that couldn't be delivered
+func (s *Store) AddDeadLetter(letter DeadLetter) error {
+	return s.update(func(st *state) error {
+		st.DeadLetters = append(st.DeadLetters, letter)
+		return nil
+	})
+}
+
+// ReplaceDeadLetters replaces dead letters read before with others, keeping the ones
+// queued in the meantime
+func (s *Store) ReplaceDeadLetters(taken, replacements []DeadLetter) error {
+	return s.update(func(st *state) error {
+		kept := []DeadLetter{}
+		for _, letter := range st.DeadLetters {
+			if !contains(taken, letter) {
+				kept = append(kept, letter)
+			}
+		}
+		st.DeadLetters = append(kept, replacements...)
+		return nil
+	})
+}
+
+// contains reports whether letters holds letter. Times are compared with Equal since
+// zones read from the file are different values.
+func contains(letters []DeadLetter, letter DeadLetter) bool {
+	for _, l := range letters {
+		if l.Webhook == letter.Webhook && l.Event.Seq == letter.Event.Seq && l.Event.Type == letter.Event.Type && l.FailedAt.Equal(letter.FailedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns the dead letters of the other webhooks
+func without(letters []DeadLetter, id int) []DeadLetter {
+	kept := []DeadLetter{}
+	for _, letter := range letters {
+		if letter.Webhook != id {
+			kept = append(kept, letter)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,214 @@
+// internal/webhook/webhook_test.go
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"virtual-file-system/internal"
+)
+
+// delivery is a request received by a test receiver
+type delivery struct {
+	header http.Header
+	body   string
+}
+
+// newReceiver serves a webhook URL answering the statuses of status in turn, 200 after them,
+// and passes on the requests it receives
+func newReceiver(t *testing.T, statuses ...int) (*httptest.Server, chan delivery) {
+	t.Helper()
+	received := make(chan delivery, 100)
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{r.Header, string(body)}
+		if n := int(atomic.AddInt32(&count, 1)); n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+// newTestDispatcher returns a started dispatcher with a store in a temp dir and short backoffs
+func newTestDispatcher(t *testing.T) *Dispatcher {
+	t.Helper()
+	internal.UseMockData(make(map[string]*internal.User))
+	d := NewDispatcher(NewStore(filepath.Join(t.TempDir(), "webhooks.json")))
+	d.MaxAttempts = 3
+	d.Backoff = time.Millisecond
+	d.MaxBackoff = 2 * time.Millisecond
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "webhooks.json"))
+	if webhooks, err := store.List(); err != nil || len(webhooks) != 0 {
+		t.Fatalf("expected no webhooks before the file exists but got %v, %v", webhooks, err)
+	}
+
+	first, err := store.Add(Webhook{URL: "http://localhost/a"})
+	if err != nil || first.ID != 1 || len(first.Secret) != 64 || first.CreatedAt.IsZero() {
+		t.Fatalf("expected the first webhook with a generated secret but got %+v, %v", first, err)
+	}
+	second, _ := store.Add(Webhook{URL: "https://example.com/b", Secret: "s", Username: "alice", Folder: "docs", Events: []internal.EventType{internal.FileCreated}})
+	store.AddDeadLetter(DeadLetter{Webhook: 1, Attempts: 5})
+	store.AddDeadLetter(DeadLetter{Webhook: 2, Attempts: 5})
+
+	if err := store.Remove(1); err != nil {
+		t.Errorf("Remove returned error: %v", err)
+	}
+	if webhooks, _ := store.List(); len(webhooks) != 1 || webhooks[0].ID != second.ID || webhooks[0].Secret != "s" {
+		t.Errorf("expected the second webhook to be left but got %+v", webhooks)
+	}
+	if letters, _ := store.DeadLetters(1); len(letters) != 0 {
+		t.Errorf("expected the dead letters of a removed webhook to be dropped but got %+v", letters)
+	}
+	if letters, _ := store.DeadLetters(2); len(letters) != 1 {
+		t.Errorf("expected a dead letter but got %+v", letters)
+	}
+	// Numbers aren't reused
+	if third, _ := store.Add(Webhook{URL: "http://localhost/c"}); third.ID != 3 {
+		t.Errorf("expected webhook 3 but got %d", third.ID)
+	}
+	if info, err := os.Stat(store.Path()); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the file to be private but got %v, %v", info.Mode(), err)
+	}
+
+	var notFound *NotFoundError
+	if err := store.Remove(1); !errors.As(err, &notFound) || !errors.Is(err, internal.ErrNotFound) || err.Error() != "The webhook 1 doesn't exist." {
+		t.Errorf("expected webhook 1 not to exist but got %v", err)
+	}
+	if _, err := store.Get(9); !errors.Is(err, internal.ErrNotFound) {
+		t.Errorf("expected webhook 9 not to exist but got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		webhook  Webhook
+		expected string
+	}{
+		{Webhook{URL: "http://localhost:8080/hook", Username: "alice", Folder: "docs", Events: internal.EventTypes}, ""},
+		{Webhook{URL: "ftp://localhost/hook"}, "Invalid URL ftp://localhost/hook, expected an http or https URL"},
+		{Webhook{URL: "/hook"}, "Invalid URL /hook, expected an http or https URL"},
+		{Webhook{URL: "http://localhost", Folder: "docs"}, "Invalid folder filter: a user is needed too"},
+		{Webhook{URL: "http://localhost", Events: []internal.EventType{"file.renamed"}}, "Unknown event type file.renamed, expected one of user.registered,folder.created,folder.renamed,folder.deleted,file.created,file.updated,file.moved,file.deleted"},
+	}
+
+	for _, tt := range tests {
+		err := Validate(tt.webhook)
+		if (err == nil && tt.expected != "") || (err != nil && err.Error() != tt.expected) {
+			t.Errorf("%+v: expected %q but got %v", tt.webhook, tt.expected, err)
+		}
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	d := newTestDispatcher(t)
+	server, received := newReceiver(t)
+	w, _ := d.Store.Add(Webhook{URL: server.URL, Secret: "secret", Username: "alice", Folder: "docs", Events: []internal.EventType{internal.FileCreated, internal.FileDeleted}})
+
+	internal.RegisterUser("alice")
+	internal.CreateFolder("alice", "docs", "")
+	internal.CreateFolder("alice", "tmp", "")
+	internal.CreateFile("alice", "tmp", "a", "")
+	internal.CreateFile("alice", "docs", "b", "first")
+	d.Close(time.Second)
+
+	if len(received) != 1 {
+		t.Fatalf("expected one delivery but got %d", len(received))
+	}
+	got := <-received
+	if !strings.Contains(got.body, `"type":"file.created"`) || !strings.Contains(got.body, `"file":"b"`) {
+		t.Errorf("expected the creation of b but got %s", got.body)
+	}
+	if got.header.Get(HeaderSignature) != Sign("secret", []byte(got.body)) || got.header.Get(HeaderEvent) != "file.created" || !strings.HasPrefix(got.header.Get(HeaderDelivery), "1-") || got.header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected a signed delivery but got %v", got.header)
+	}
+	if letters, _ := d.Store.DeadLetters(w.ID); len(letters) != 0 {
+		t.Errorf("expected no dead letters but got %+v", letters)
+	}
+}
+
+func TestRetriesAndDeadLetters(t *testing.T) {
+	d := newTestDispatcher(t)
+	flaky, flakyReceived := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	down, downReceived := newReceiver(t, 500, 500, 500, 500)
+	d.Store.Add(Webhook{URL: flaky.URL})
+	failing, _ := d.Store.Add(Webhook{URL: down.URL})
+
+	internal.RegisterUser("alice")
+	d.Close(time.Second)
+
+	if len(flakyReceived) != 3 {
+		t.Errorf("expected the delivery to succeed at the third attempt but got %d attempts", len(flakyReceived))
+	}
+	if len(downReceived) != 3 {
+		t.Errorf("expected 3 attempts but got %d", len(downReceived))
+	}
+	letters, _ := d.Store.DeadLetters(failing.ID)
+	if len(letters) != 1 || letters[0].Attempts != 3 || letters[0].Event.Type != internal.UserRegistered || letters[0].Error != down.URL+" answered 500 Internal Server Error" {
+		t.Fatalf("expected a dead letter but got %+v", letters)
+	}
+
+	// The fourth attempt fails again, the fifth succeeds
+	for i := 0; i < 2; i++ {
+		delivered, left, err := d.Redeliver(context.Background(), failing.ID)
+		if err != nil || delivered != i || left != 1-i {
+			t.Errorf("redelivery %d: expected %d delivered and %d left but got %d, %d, %v", i, i, 1-i, delivered, left, err)
+		}
+	}
+	if letters, _ := d.Store.DeadLetters(failing.ID); len(letters) != 0 {
+		t.Errorf("expected the dead letter to be delivered but got %+v", letters)
+	}
+}
+
+func TestCloseStopsRetries(t *testing.T) {
+	d := newTestDispatcher(t)
+	d.Backoff = time.Hour
+	d.MaxBackoff = time.Hour
+	down, _ := newReceiver(t, 503)
+	w, _ := d.Store.Add(Webhook{URL: down.URL})
+
+	internal.RegisterUser("alice")
+	d.Close(10 * time.Millisecond)
+
+	letters, _ := d.Store.DeadLetters(w.ID)
+	if len(letters) != 1 || letters[0].Attempts != 1 || !strings.HasPrefix(letters[0].Error, "stopped before delivery: ") {
+		t.Errorf("expected the pending retry to become a dead letter but got %+v", letters)
+	}
+}
+
+func TestTest(t *testing.T) {
+	d := newTestDispatcher(t)
+	defer d.Close(time.Second)
+	server, received := newReceiver(t, http.StatusNotFound)
+	w, _ := d.Store.Add(Webhook{URL: server.URL, Username: "alice"})
+
+	if status, err := d.Test(context.Background(), w.ID); status != http.StatusNotFound || err == nil || err.Error() != server.URL+" answered 404 Not Found" {
+		t.Errorf("expected the test to fail with 404 but got %d, %v", status, err)
+	}
+	if status, err := d.Test(context.Background(), w.ID); status != http.StatusOK || err != nil {
+		t.Errorf("expected the test to succeed but got %d, %v", status, err)
+	}
+	got := <-received
+	if got.header.Get(HeaderEvent) != "webhook.test" || got.header.Get(HeaderDelivery) != "1-test" || !strings.Contains(got.body, `"username":"alice"`) {
+		t.Errorf("expected a test event but got %v %s", got.header, got.body)
+	}
+	if _, err := d.Test(context.Background(), 7); !errors.Is(err, internal.ErrNotFound) {
+		t.Errorf("expected webhook 7 not to exist but got %v", err)
+	}
+}